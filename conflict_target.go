@@ -0,0 +1,18 @@
+package pggen
+
+// conflict_target.go defines the typed conflict targets that can be passed to
+// the generated upsert methods
+
+// A ConflictTarget is a unique index or constraint that an upsert can use to
+// detect conflicting records. pggen generates a `<Entity>ConflictTarget` type
+// for each table, along with a `<Entity>ConflictOn<Target>` value for each of
+// the table's unique indexes and constraints. Pass one to the
+// UpsertConflictTarget option.
+type ConflictTarget interface {
+	// The name of the table that the index or constraint is on
+	ConflictTable() string
+	// What goes after `ON CONFLICT` in the upsert statement, either
+	// `ON CONSTRAINT <name>` or a list of columns with an optional
+	// index predicate
+	ConflictTargetSQL() string
+}
@@ -1,6 +1,8 @@
 package pggen
 
 import (
+	"fmt"
+
 	"github.com/ferumlabs/pggen/unstable"
 )
 
@@ -31,3 +33,59 @@ func IsNotFoundError(err error) bool {
 		err = u.Unwrap()
 	}
 }
+
+// RowCountError is returned by generated statement methods configured with
+// `expect_rows` when the statement affects (or, for a `returning` statement,
+// returns) a number of rows outside of the expected range. Note that by the
+// time the error is returned, the statement has already run, so statements
+// that need to be undone should be run in a transaction.
+type RowCountError struct {
+	// The name of the statement
+	Stmt string
+	// The smallest number of rows expected
+	Min int64
+	// The largest number of rows expected, or a negative number if
+	// there is no upper bound
+	Max int64
+	// The number of rows that were actually affected
+	Actual int64
+}
+
+func (e *RowCountError) Error() string {
+	var expected string
+	switch {
+	case e.Max < 0:
+		expected = fmt.Sprintf("at least %d", e.Min)
+	case e.Min == e.Max:
+		expected = fmt.Sprintf("%d", e.Min)
+	default:
+		expected = fmt.Sprintf("between %d and %d", e.Min, e.Max)
+	}
+	return fmt.Sprintf("%s: expected %s rows, got %d", e.Stmt, expected, e.Actual)
+}
+
+// ConcurrentModificationError is returned by the generated `Update` and `Upsert`
+// methods for tables with a `version_field` when the version of a record in the
+// database no longer matches the version of the value being written, which means
+// that someone else changed the record after it was read.
+type ConcurrentModificationError struct {
+	// The name of the table
+	Table string
+	// The primary key of the record, or nil if it is not known, as with bulk
+	// upserts which leave the primary keys to the database
+	ID interface{}
+	// The version that the record was expected to have
+	Version int64
+}
+
+func (e *ConcurrentModificationError) Error() string {
+	if e.ID == nil {
+		return fmt.Sprintf("%s: records were modified concurrently", e.Table)
+	}
+	return fmt.Sprintf(
+		"%s: record %v was modified concurrently (expected version %d)",
+		e.Table,
+		e.ID,
+		e.Version,
+	)
+}
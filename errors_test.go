@@ -41,6 +41,56 @@ func TestIsNotFoundError(t *testing.T) {
 	}
 }
 
+func TestRowCountError(t *testing.T) {
+	type testCase struct {
+		err      RowCountError
+		expected string
+	}
+	cases := []testCase{
+		{
+			err:      RowCountError{Stmt: "DeleteUser", Min: 1, Max: 1, Actual: 0},
+			expected: "DeleteUser: expected 1 rows, got 0",
+		},
+		{
+			err:      RowCountError{Stmt: "ArchiveOrgs", Min: 1, Max: -1, Actual: 0},
+			expected: "ArchiveOrgs: expected at least 1 rows, got 0",
+		},
+		{
+			err:      RowCountError{Stmt: "Touch", Min: 1, Max: 3, Actual: 4},
+			expected: "Touch: expected between 1 and 3 rows, got 4",
+		},
+	}
+
+	for _, c := range cases {
+		if c.err.Error() != c.expected {
+			t.Fatalf("expected '%s', got '%s'", c.expected, c.err.Error())
+		}
+	}
+}
+
+func TestConcurrentModificationError(t *testing.T) {
+	type testCase struct {
+		err      ConcurrentModificationError
+		expected string
+	}
+	cases := []testCase{
+		{
+			err:      ConcurrentModificationError{Table: "users", ID: int64(5), Version: 3},
+			expected: "users: record 5 was modified concurrently (expected version 3)",
+		},
+		{
+			err:      ConcurrentModificationError{Table: "users"},
+			expected: "users: records were modified concurrently",
+		},
+	}
+
+	for _, c := range cases {
+		if c.err.Error() != c.expected {
+			t.Fatalf("expected '%s', got '%s'", c.expected, c.err.Error())
+		}
+	}
+}
+
 // we define this manually rather than using %w to maintain our msgv
 type causedErr struct {
 	cause error
@@ -3,17 +3,16 @@ package gen
 import (
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
 
-	"github.com/BurntSushi/toml"
 	_ "github.com/jackc/pgx/v4/stdlib"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
 	"github.com/ferumlabs/pggen/gen/internal/log"
 	"github.com/ferumlabs/pggen/gen/internal/meta"
+	"github.com/ferumlabs/pggen/gen/internal/names"
 	"github.com/ferumlabs/pggen/gen/internal/types"
 	"github.com/ferumlabs/pggen/gen/internal/utils"
 )
@@ -61,6 +60,8 @@ type Generator struct {
 	disabledByEnableVar bool
 	// Used to map postgres types to information we can use to codegen go types
 	typeResolver *types.Resolver
+	// Used to convert postgres names into go names
+	goNames *names.Converter
 }
 
 func FromConfig(config Config) (*Generator, error) {
@@ -254,44 +255,44 @@ import (
 
 func (g *Generator) setupGenEnv() (*config.DbConfig, error) {
 	g.log.Infof("pggen: using config '%s'\n", g.config.ConfigFilePath)
-	confData, err := ioutil.ReadFile(g.config.ConfigFilePath)
+	// parse the config file along with everything it includes
+	conf, err := config.Load(g.config.ConfigFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	// parse the config file
-	var conf config.DbConfig
-	tomlMd, err := toml.Decode(string(confData), &conf)
+	// Expand the table patterns before normalizing so that the tables
+	// they add pick up the global timestamp settings.
+	err = g.metaResolver.ExpandTablePatterns(conf)
 	if err != nil {
-		return nil, fmt.Errorf("while parsing config file: %s", err.Error())
-	}
-	for _, unknownKey := range tomlMd.Undecoded() {
-		fmt.Fprintf(
-			os.Stderr,
-			"WARN: unknown config file key: '%s'\n",
-			unknownKey.String(),
-		)
+		return nil, err
 	}
+
 	err = conf.Normalize()
 	if err != nil {
 		return nil, err
 	}
+
 	err = conf.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	err = g.typeResolver.Resolve(&conf)
+	g.goNames = names.NewConverter(conf.Initialisms)
+
+	err = g.typeResolver.Resolve(conf)
 	if err != nil {
 		return nil, err
 	}
 
 	// Place metadata about all tables in a hashtable to later
 	// access by the table and query generation phases.
-	err = g.metaResolver.Resolve(&conf)
+	err = g.metaResolver.Resolve(conf)
 	if err != nil {
 		return nil, err
 	}
 
-	return &conf, nil
+	g.dropShadowedLookups(conf)
+
+	return conf, nil
 }
@@ -26,9 +26,13 @@ func (g *Generator) genInterfaces(into io.Writer, conf *config.DbConfig) error {
 		}
 
 		genCtx.Tables = append(genCtx.Tables, tableIfaceGenCtx{
-			GoName:     tableInfo.Info.GoName,
-			PkeyType:   tableInfo.Info.PkeyCol.TypeInfo.Name,
-			BoxResults: tableInfo.Config.BoxResults,
+			GoName:            tableInfo.Info.GoName,
+			PkeyType:          tableInfo.Info.PkeyCol.TypeInfo.Name,
+			BoxResults:        tableInfo.Config.BoxResults,
+			Iterators:         tableInfo.Config.Iterators,
+			UniqueLookups:     tableInfo.UniqueLookups,
+			FkLookups:         tableInfo.FkLookups,
+			HasDeletedAtField: tableInfo.HasDeletedAtField,
 		})
 	}
 
@@ -58,9 +62,14 @@ func (g *Generator) genInterfaces(into io.Writer, conf *config.DbConfig) error {
 }
 
 type tableIfaceGenCtx struct {
-	GoName     string
-	PkeyType   string
-	BoxResults bool
+	GoName        string
+	PkeyType      string
+	BoxResults    bool
+	Iterators     bool
+	UniqueLookups []meta.LookupMeta
+	FkLookups     []meta.LookupMeta
+	// Whether the table has soft deletes configured
+	HasDeletedAtField bool
 }
 
 type ifaceGenCtx struct {
@@ -84,10 +93,33 @@ type DBQueries interface {
 	Insert{{ .GoName }}(ctx context.Context, value {{ if .BoxResults }}*{{ end }}{{ .GoName }}, opts ...pggen.InsertOpt) ({{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
 	BulkInsert{{ .GoName }}(ctx context.Context, values []{{ .GoName }}, opts ...pggen.InsertOpt) ([]{{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
 	Update{{ .GoName }}(ctx context.Context, value {{ if .BoxResults }}*{{ end }}{{ .GoName }}, fieldMask pggen.FieldSet, opts ...pggen.UpdateOpt) ({{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
+	BulkUpdate{{ .GoName }}(ctx context.Context, values []{{ .GoName }}, fieldMask pggen.FieldSet, opts ...pggen.UpdateOpt) ([]{{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
 	Upsert{{ .GoName }}(ctx context.Context, value {{ if .BoxResults }}*{{ end }}{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ({{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
 	BulkUpsert{{ .GoName }}(ctx context.Context, values []{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ([]{{- if .BoxResults }}*{{- end }}{{ .GoName }}, error)
+	Upsert{{ .GoName }}WithOutcome(ctx context.Context, value {{ if .BoxResults }}*{{ end }}{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ({{- if .BoxResults }}*{{- end }}{{ .GoName }}, pggen.UpsertOutcome, error)
+	BulkUpsert{{ .GoName }}WithOutcomes(ctx context.Context, values []{{ .GoName }}, constraintNames []string, fieldMask pggen.FieldSet, opts ...pggen.UpsertOpt) ([]{{- if .BoxResults }}*{{- end }}{{ .GoName }}, []pggen.UpsertOutcome, error)
 	Delete{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}, opts ...pggen.DeleteOpt) error
 	BulkDelete{{ .GoName }}(ctx context.Context, ids []{{ .PkeyType }}, opts ...pggen.DeleteOpt) error
+	{{- $table := . }}
+	{{- range .UniqueLookups }}
+	Get{{ $table.GoName }}{{ .GoName }}(ctx context.Context, {{ range .Keys }}{{ .ArgName }} {{ .Col.TypeInfo.Name }}, {{ end }}opts ...pggen.GetOpt) ({{- if $table.BoxResults }}*{{- end }}{{ $table.GoName }}, error)
+	{{- end }}
+	{{- range .FkLookups }}
+	{{- $key := index .Keys 0 }}
+	List{{ $table.GoName }}{{ .GoName }}(ctx context.Context, {{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }}, opts ...pggen.ListOpt) ([]{{- if $table.BoxResults }}*{{- end }}{{ $table.GoName }}, error)
+	{{- end }}
+	{{- if .Iterators }}
+	All{{ .GoName }}(ctx context.Context, opts ...pggen.ListOpt) iter.Seq2[{{- if .BoxResults }}*{{- end }}{{ .GoName }}, error]
+	{{- end }}
+	Count{{ .GoName }}(ctx context.Context, filter {{ .GoName }}, filterFields pggen.FieldSet, opts ...pggen.CountOpt) (int64, error)
+	Exists{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}, opts ...pggen.ExistsOpt) (bool, error)
+	{{- if .HasDeletedAtField }}
+	Restore{{ .GoName }}(ctx context.Context, id {{ .PkeyType }}) error
+	BulkRestore{{ .GoName }}(ctx context.Context, ids []{{ .PkeyType }}) error
+	Purge{{ .GoName }}DeletedBefore(ctx context.Context, t time.Time) (int64, error)
+	{{- end }}
+	{{ .GoName }}FillIncludes(ctx context.Context, rec *{{ .GoName }}, includes *include.Spec, opts ...pggen.IncludeOpt) error
+	{{ .GoName }}BulkFillIncludes(ctx context.Context, recs []*{{ .GoName }}, includes *include.Spec, opts ...pggen.IncludeOpt) error
 	{{ end }}
 
 	//
@@ -95,29 +127,25 @@ type DBQueries interface {
 	//
 
 	{{ range $i, $query := .Queries }}
-	{{ if .ConfigData.SingleResult }}
+	{{ if (or .ConfigData.SingleResult .ConfigData.OptionalResult) }}
 	// {{ .ConfigData.Name }} query
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
 		{{- range .Args }}
-		{{- if $query.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ .GoName }} {{ .TypeInfo.NullName }},
 		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
 		{{- end }}
-	{{- if (not .MultiReturn) }}
-	) ({{ .ReturnTypeName }}, error)
-	{{- else }}
-	) (*{{ .ReturnTypeName }}, error)
-	{{- end }}
+	) ({{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}, {{ if .ConfigData.OptionalResult }}bool, {{ end }}error)
 
 	{{ else }}
 	// {{ .ConfigData.Name }} query
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
 		{{- range .Args }}
-		{{- if $query.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ .GoName }} {{ .TypeInfo.NullName }},
 		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
@@ -127,9 +155,25 @@ type DBQueries interface {
 	{{ .ConfigData.Name }}Query(
 		ctx context.Context,
 		{{- range .Args }}
+		{{- if .Nullable }}
+		{{ .GoName }} {{ .TypeInfo.NullName }},
+		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
 		{{- end }}
+		{{- end }}
 	) (*sql.Rows, error)
+	{{- if .ConfigData.Iterators }}
+	{{ .ConfigData.Name }}Iter(
+		ctx context.Context,
+		{{- range .Args }}
+		{{- if .Nullable }}
+		{{ .GoName }} {{ .TypeInfo.NullName }},
+		{{- else }}
+		{{ .GoName }} {{ .TypeInfo.Name }},
+		{{- end }}
+		{{- end }}
+	) iter.Seq2[{{- if .ConfigData.BoxResults }}*{{- end }}{{ .ReturnTypeName }}, error]
+	{{- end }}
 	{{ end }}
 	{{ end }}
 
@@ -162,9 +206,13 @@ type DBQueries interface {
 	{{ .ConfigData.Name }}(
 		ctx context.Context,
 		{{- range .Args}}
+		{{- if .Nullable }}
+		{{ .GoName }} {{ .TypeInfo.NullName }},
+		{{- else }}
 		{{ .GoName }} {{ .TypeInfo.Name }},
+		{{- end }}
 		{{- end}}
-	) (sql.Result, error)
+	) ({{ if .ConfigData.Returning }}[]{{ .ReturnTypeName }}{{ else }}sql.Result{{ end }}, error)
 	{{ end }}
 }
 
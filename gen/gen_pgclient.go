@@ -1,11 +1,11 @@
 package gen
 
 import (
+	"fmt"
 	"io"
 	"text/template"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
-	"github.com/ferumlabs/pggen/gen/internal/names"
 )
 
 func (g *Generator) genPGClient(into io.Writer, conf *config.DbConfig) error {
@@ -17,12 +17,23 @@ func (g *Generator) genPGClient(into io.Writer, conf *config.DbConfig) error {
 		ScanStructNames []string
 	}
 
+	// only the streaming methods need position tables
 	scanStructNames := make([]string, 0, len(conf.Tables))
 	for _, tc := range conf.Tables {
-		scanStructNames = append(scanStructNames, names.PgTableToGoModel(tc.Name))
+		if !tc.Iterators {
+			continue
+		}
+		tableInfo, ok := g.metaResolver.TableMeta(tc.Name)
+		if !ok {
+			return fmt.Errorf("could not find table '%s'", tc.Name)
+		}
+		scanStructNames = append(scanStructNames, tableInfo.Info.GoName)
 	}
 	for _, qc := range conf.Queries {
-		scanStructNames = append(scanStructNames, names.PgToGoName(qc.Name)+"Row")
+		if !(qc.Iterators || qc.CursorFetchSize > 0) || qc.SingleResult || qc.OptionalResult {
+			continue
+		}
+		scanStructNames = append(scanStructNames, g.goNames.PgToGoName(qc.Name)+"Row")
 	}
 
 	gCtx := genCtx{ScanStructNames: scanStructNames}
@@ -40,6 +51,15 @@ const BatchSize = 100
 type PGClient struct {
 	impl pgClientImpl
 	topLevelDB pggen.DBConn
+
+	// These column position tables are used at run time by the streaming methods
+	// to scan the results of a 'SELECT *' against a table that has the same columns
+	// in a different order from the ones that we saw at codegen time, or has picked
+	// up new columns since then.
+	{{- range .ScanStructNames }}
+	rwlockFor{{ . }} sync.RWMutex
+	colIdxTabFor{{ . }} []int
+	{{- end }}
 }
 
 // bogus usage so we can compile with no tables configured
@@ -76,6 +96,7 @@ func (p *PGClient) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxPGClien
 		impl: pgClientImpl{
 			db: tx,
 			client: p,
+			cursors: &cursorNames{},
 		},
 	}, nil
 }
@@ -124,6 +145,8 @@ type pgClientImpl struct {
 	db pggen.DBHandle
 	// a reference back to the owning PGClient so we can always get at the resolver tables
 	client *PGClient
+	// the names of the cursors open in the transaction, nil outside of a transaction
+	cursors *cursorNames
 }
 
 `))
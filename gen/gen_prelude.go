@@ -36,6 +36,8 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -43,11 +45,14 @@ import (
 	"github.com/sanyokbig/pqinterval"
 
 	"github.com/ferumlabs/pggen"
+	"github.com/ferumlabs/pggen/unstable"
 )
 
 type fieldNameAndIdx struct {
 	name string
 	idx int
+	// the postgres type of the field, for casting placeholders
+	pgType string
 }
 
 func genBulkInsertStmt(
@@ -120,12 +125,40 @@ func genInsertCommon(
 	}
 }
 
+// genSkipConflicts finishes an upsert which does nothing on conflict. It must
+// follow a 'WITH pggen_new AS (INSERT ...' clause written by genInsertCommon.
+// See unstable.SkipConflicts for the details.
+func genSkipConflicts(
+	into *strings.Builder,
+	table string,
+	fields []fieldNameAndIdx,
+	nrecords int,
+	defaultFieldSet pggen.FieldSet,
+	conflictTarget string,
+	conflictCols []string,
+) {
+	cols := make([]string, 0, len(fields))
+	insertCols := make([]string, 0, len(fields))
+	for _, field := range fields {
+		cols = append(cols, field.name)
+		if !defaultFieldSet.Test(field.idx) {
+			insertCols = append(insertCols, field.name)
+		}
+	}
+
+	unstable.SkipConflicts(into, table, cols, insertCols, nrecords, conflictTarget, conflictCols)
+}
+
+// genUpdateStmt generates a statement which updates the fields in 'fieldMask'
+// for a single record. It returns every column of the record, so callers get
+// back the bumped version along with any values changed by triggers.
 func genUpdateStmt(
 	table string,
 	pgPkey string,
 	fields []fieldNameAndIdx,
 	fieldMask pggen.FieldSet,
-	pkeyName string,
+	versionField string,
+	predicates string,
 ) string {
 	var ret strings.Builder
 
@@ -143,6 +176,11 @@ func genUpdateStmt(
 			argNo++
 		}
 	}
+	if versionField != "" {
+		// the caller leaves the version out of 'fieldMask', we always bump it
+		lhs = append(lhs, versionField)
+		rhs = append(rhs, fmt.Sprintf("\"%s\" + 1", versionField))
+	}
 
 	if len(lhs) > 1 {
 		ret.WriteRune('(')
@@ -170,18 +208,187 @@ func genUpdateStmt(
 	ret.WriteString(pgPkey)
 	ret.WriteString("\" = ")
 	ret.WriteString(fmt.Sprintf("$%d", argNo))
+	if versionField != "" {
+		ret.WriteString(fmt.Sprintf(" AND \"%s\" = $%d", versionField, argNo+1))
+	}
+	ret.WriteString(predicates)
+
+	// the columns are listed explicitly so that they come back in the order
+	// that the generated code scans them in
+	retCols := make([]string, 0, len(fields))
+	for _, f := range fields {
+		retCols = append(retCols, "\"" + f.name + "\"")
+	}
+	ret.WriteString(" RETURNING ")
+	ret.WriteString(strings.Join(retCols, ", "))
+
+	return ret.String()
+}
+
+// genBulkUpdateStmt generates a statement which updates the fields in 'fieldMask'
+// for 'nrecords' records at once. The arguments for each record are its primary
+// key, then the fields in 'fieldMask' in order, then its version if 'versionField'
+// is set. 'fieldMask' must not include the primary key or the version.
+func genBulkUpdateStmt(
+	table string,
+	pkey fieldNameAndIdx,
+	fields []fieldNameAndIdx,
+	fieldMask pggen.FieldSet,
+	nrecords int,
+	versionField string,
+) string {
+	var ret strings.Builder
+
+	valueCols := []fieldNameAndIdx{pkey}
+	sets := []string{}
+	for i, f := range fields {
+		if fieldMask.Test(i) {
+			valueCols = append(valueCols, f)
+			sets = append(sets, fmt.Sprintf("\"%s\" = v.\"%s\"", f.name, f.name))
+		}
+	}
+	if versionField != "" {
+		for _, f := range fields {
+			if f.name == versionField {
+				valueCols = append(valueCols, f)
+			}
+		}
+		sets = append(sets, fmt.Sprintf("\"%s\" = t.\"%s\" + 1", versionField, versionField))
+	}
+
+	ret.WriteString("UPDATE ")
+	ret.WriteString(table)
+	ret.WriteString(" AS t SET ")
+	ret.WriteString(strings.Join(sets, ", "))
+	ret.WriteString(" FROM (VALUES ")
+
+	argNo := 1
+	for recNo := 0; recNo < nrecords; recNo++ {
+		slots := make([]string, 0, len(valueCols))
+		for _, f := range valueCols {
+			// VALUES lists don't get their types from the table being updated,
+			// so we have to spell them out
+			slots = append(slots, fmt.Sprintf("$%d::%s", argNo, f.pgType))
+			argNo++
+		}
+		if recNo > 0 {
+			ret.WriteString(", ")
+		}
+		ret.WriteString(parenWrap(strings.Join(slots, ", ")))
+	}
 
-	ret.WriteString(" RETURNING \"")
-	ret.WriteString(pkeyName)
-	ret.WriteRune('"')
+	colNames := make([]string, 0, len(valueCols))
+	for _, f := range valueCols {
+		colNames = append(colNames, "\"" + f.name + "\"")
+	}
+	ret.WriteString(") AS v")
+	ret.WriteString(parenWrap(strings.Join(colNames, ", ")))
+
+	ret.WriteString(fmt.Sprintf(" WHERE t.\"%s\" = v.\"%s\"", pkey.name, pkey.name))
+	if versionField != "" {
+		ret.WriteString(fmt.Sprintf(" AND t.\"%s\" = v.\"%s\"", versionField, versionField))
+	}
+	// the columns are listed explicitly so that they come back in the order
+	// that the generated code scans them in
+	retCols := make([]string, 0, len(fields))
+	for _, f := range fields {
+		retCols = append(retCols, "t.\"" + f.name + "\"")
+	}
+	ret.WriteString(" RETURNING ")
+	ret.WriteString(strings.Join(retCols, ", "))
 
 	return ret.String()
 }
 
+var placeholderRE = regexp.MustCompile("\\$[0-9]+")
+
+// genPredicates renders the extra conditions for a conditional update or
+// delete, numbering their placeholders after the 'nargs' arguments that the
+// rest of the statement already uses. It returns SQL to append to the WHERE
+// clause of the statement along with the arguments for it. 'table' is the table
+// being written to, and predicates made for another table are rejected.
+func genPredicates(
+	preds []pggen.Predicate,
+	table string,
+	fields []fieldNameAndIdx,
+	nargs int,
+) (string, []interface{}, error) {
+	var (
+		ret  strings.Builder
+		args []interface{}
+	)
+
+	for _, pred := range preds {
+		ret.WriteString(" AND ")
+		if pred.SQL == "" {
+			if pred.Table != "" && pred.Table != table {
+				return "", nil, fmt.Errorf(
+					"predicate: for table '%s', not '%s'",
+					pred.Table,
+					table,
+				)
+			}
+			if pred.FieldIndex < 0 || len(fields) <= pred.FieldIndex {
+				return "", nil, fmt.Errorf("predicate: bad field index %d", pred.FieldIndex)
+			}
+			args = append(args, pred.Value)
+			ret.WriteString(fmt.Sprintf(
+				"\"%s\" IS NOT DISTINCT FROM $%d",
+				fields[pred.FieldIndex].name,
+				nargs+len(args),
+			))
+			continue
+		}
+
+		offset := nargs + len(args)
+		sql := placeholderRE.ReplaceAllStringFunc(pred.SQL, func(placeholder string) string {
+			n, err := strconv.Atoi(placeholder[1:])
+			if err != nil {
+				return placeholder
+			}
+			return fmt.Sprintf("$%d", n+offset)
+		})
+		ret.WriteString(parenWrap(sql))
+		args = append(args, pred.Args...)
+	}
+
+	return ret.String(), args, nil
+}
+
 func parenWrap(in string) string {
 	return "(" + in + ")"
 }
 
+// fieldNames returns the names of the given fields, in order
+func fieldNames(fields []fieldNameAndIdx) []string {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// genLockClause renders the locking clause to append to a SELECT statement
+// for the given lock options.
+func genLockClause(opt pggen.LockOptions) (string, error) {
+	if opt.NoWait && opt.SkipLocked {
+		return "", fmt.Errorf("NOWAIT and SKIP LOCKED cannot be used together")
+	}
+	switch opt.Strength {
+	case pggen.LockForUpdate, pggen.LockForNoKeyUpdate, pggen.LockForShare:
+	default:
+		return "", fmt.Errorf("unknown lock strength %d", opt.Strength)
+	}
+
+	clause := " FOR " + opt.Strength.String()
+	if opt.NoWait {
+		clause += " NOWAIT"
+	} else if opt.SkipLocked {
+		clause += " SKIP LOCKED"
+	}
+	return clause, nil
+}
+
 func (p *PGClient) fillColPosTab(
 	ctx context.Context,
 	genTimeColIdxTab map[string]int,
@@ -226,6 +433,84 @@ func (p *PGClient) fillColPosTab(
 	return nil
 }
 
+// colPosTab returns the position table for the columns of 'rows', using the
+// one cached in 'tab' if the columns still line up with it and refilling it
+// otherwise.
+func (p *PGClient) colPosTab(
+	ctx context.Context,
+	genTimeColIdxTab map[string]int,
+	rwlock *sync.RWMutex,
+	rows *sql.Rows,
+	tab *[]int, // in-out
+) ([]int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("reading column names: %s", err.Error())
+	}
+
+	rwlock.RLock()
+	posTab := *tab
+	rwlock.RUnlock()
+
+	if len(posTab) == len(cols) {
+		upToDate := true
+		for i, colName := range cols {
+			genIdx, inTable := genTimeColIdxTab[colName]
+			if !inTable {
+				genIdx = -1
+			}
+			if posTab[i] != genIdx {
+				upToDate = false
+				break
+			}
+		}
+		if upToDate {
+			return posTab, nil
+		}
+	}
+
+	err = p.fillColPosTab(ctx, genTimeColIdxTab, rwlock, rows, tab)
+	if err != nil {
+		return nil, err
+	}
+
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	return *tab, nil
+}
+
+// cursorNames hands out the names of the server-side cursors open within a
+// transaction. A query's cursor always has the same name so that its DECLARE
+// and FETCH statements can be cached like any other statement. It only gets a
+// numbered name when the same query already has a cursor open in the transaction,
+// as happens when its cursor loops are nested.
+type cursorNames struct {
+	mu   sync.Mutex
+	open map[string]bool
+}
+
+func (c *cursorNames) acquire(base string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.open == nil {
+		c.open = map[string]bool{}
+	}
+	name := base
+	for i := 1; c.open[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	c.open[name] = true
+	return name
+}
+
+func (c *cursorNames) release(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.open, name)
+}
+
 func (p *pgClientImpl) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	rows, err := p.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -2,12 +2,12 @@ package gen
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
 	"github.com/ferumlabs/pggen/gen/internal/meta"
-	"github.com/ferumlabs/pggen/gen/internal/names"
 )
 
 func (g *Generator) genQueries(
@@ -35,18 +35,31 @@ func (g *Generator) genQueries(
 
 	for i, query := range queries {
 		if requireComments && query.Comment == "" {
-			return fmt.Errorf("query '%s' is missing a comment but require_query_comments is set", query.Name)
+			return fmt.Errorf(
+				"query '%s'%s is missing a comment but require_query_comments is set",
+				query.Name,
+				definedAt(query.Source),
+			)
 		}
 
 		err := g.genQuery(into, &queries[i], nil)
 		if err != nil {
-			return fmt.Errorf("generating query '%s': %s", query.Name, err.Error())
+			return fmt.Errorf("generating query '%s'%s: %s", query.Name, definedAt(query.Source), err.Error())
 		}
 	}
 
 	return nil
 }
 
+// definedAt formats the source location of a query or statement that came from
+// a `.sql` file for inclusion in an error message.
+func definedAt(source string) string {
+	if source == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (defined at %s)", source)
+}
+
 // generate a query for the given config. If `args` is provided, use it
 // instead of the inferred argument types.
 func (g *Generator) genQuery(
@@ -57,7 +70,17 @@ func (g *Generator) genQuery(
 	g.log.Infof("		generating query '%s'\n", config.Name)
 
 	// ensure that the query name is in the right format for go
-	config.Name = names.PgToGoName(config.Name)
+	config.Name = g.goNames.PgToGoName(config.Name)
+
+	// optional result queries are single result queries which don't treat
+	// a missing row as an error
+	if config.OptionalResult {
+		config.SingleResult = true
+	}
+
+	if (config.Iterators || config.CursorFetchSize > 0) && !config.SingleResult {
+		g.imports[`"iter"`] = true
+	}
 
 	// not needed, but it does make the generated code a little nicer
 	config.Body = strings.TrimSpace(config.Body)
@@ -65,7 +88,7 @@ func (g *Generator) genQuery(
 	// tables in non-public schemas are allowed to have underscores in their names, so
 	// we don't want to convert in that case.
 	if !g.typeResolver.Probe(config.ReturnType) {
-		config.ReturnType = names.PgToGoName(config.ReturnType)
+		config.ReturnType = g.goNames.PgToGoName(config.ReturnType)
 	}
 
 	if config.Body == "" {
@@ -80,7 +103,12 @@ func (g *Generator) genQuery(
 		meta.Args = args
 	}
 
-	if meta.MultiReturn {
+	if len(meta.Nests) > 0 {
+		err = g.emitNestedRowType(&meta)
+		if err != nil {
+			return fmt.Errorf("generating return struct for '%s': %s", config.Name, err.Error())
+		}
+	} else if meta.MultiReturn {
 		genCtx := buildTableGenCtx(&meta)
 		err = g.typeResolver.EmitStructType(meta.ReturnTypeName, &genCtx)
 		if err != nil {
@@ -98,13 +126,14 @@ func (g *Generator) genQuery(
 func buildTableGenCtx(qm *meta.QueryMeta) meta.TableGenCtx {
 	return meta.TableGenCtx{
 		PgName:         "BOGUS_PGNAME",
-		GoName:         qm.ConfigData.Name + "Row",
+		GoName:         qm.ReturnTypeName,
 		PkeyColIdx:     -1,
 		AllIncludeSpec: "BOGUS_ALL_INCLUDE_SPEC",
 		Meta: &meta.TableMeta{
+			Config: &config.TableConfig{BoxResults: qm.ConfigData.BoxResults},
 			Info: meta.PgTableInfo{
 				PgName:       "BOGUS_PGNAME-inner",
-				GoName:       qm.ConfigData.Name + "Row",
+				GoName:       qm.ReturnTypeName,
 				PluralGoName: "BOGUS_PLURAL_GONAME-inner",
 				Cols:         qm.ReturnCols,
 			},
@@ -112,23 +141,219 @@ func buildTableGenCtx(qm *meta.QueryMeta) meta.TableGenCtx {
 	}
 }
 
+// nestedRowGenCtx is the template context for the return type of a query which
+// has table structs nested inside of it.
+type nestedRowGenCtx struct {
+	GoName string
+	// One scan target per result column
+	ScanTgts []nestedScanTgt
+	// The indices of the scan targets for fields which are not part of a nested struct
+	Loose []int
+	Nests []nestedStructGenCtx
+}
+
+type nestedStructGenCtx struct {
+	GoName   string
+	TypeName string
+	Nullable bool
+	// An expression which is true when every column of the nested struct is NULL
+	AllNull string
+	// The indices of the scan targets for the fields of the nested struct
+	Tgts []int
+}
+
+type nestedScanTgt struct {
+	// The name of the variable the column gets scanned into
+	Var string
+	// The type of the variable the column gets scanned into
+	TypeName string
+	// The expression to pass to `Rows.Scan`
+	Receiver string
+	// The field the column ends up in
+	Dst string
+	// The name and type of the field, for columns which are not part of
+	// a nested struct
+	FieldName string
+	FieldType string
+	// The quoted name of the result column, for error messages
+	QuotedPgName string
+	// If true, the column is scanned straight into a variable of the field's type
+	Direct bool
+	// If true, the field is nullable
+	Nullable bool
+	// An expression which converts the scanned value into the nullable version of
+	// the field's type
+	Convert string
+	// An expression which is true when the scanned value was NULL
+	IsNull string
+}
+
+// emitNestedRowType emits the return type and scan routine for a query that nests
+// table structs inside of its result.
+func (g *Generator) emitNestedRowType(qm *meta.QueryMeta) error {
+	genCtx := nestedRowGenCtx{
+		GoName:   qm.ReturnTypeName,
+		ScanTgts: make([]nestedScanTgt, len(qm.ReturnCols)),
+	}
+
+	addTgt := func(col meta.NestedCol, dst string) {
+		tyInfo := col.Field.TypeInfo
+		v := fmt.Sprintf("scanTgts.c%d", col.Idx)
+		tgt := nestedScanTgt{
+			Var:          v,
+			Dst:          dst,
+			QuotedPgName: strconv.Quote(qm.ReturnCols[col.Idx].PgName),
+			Nullable:     col.Field.Nullable,
+			Convert:      tyInfo.NullConvertFunc(v),
+		}
+
+		// Arrays are scanned into slices, which are left nil for a NULL value.
+		isArray := strings.HasPrefix(tyInfo.ScanNullName, "[]")
+		tgt.Direct = isArray && !col.Field.Nullable
+		if tgt.Direct {
+			tgt.TypeName = tyInfo.Name
+			tgt.Receiver = tyInfo.SqlReceiver(v)
+		} else {
+			tgt.TypeName = tyInfo.ScanNullName
+			tgt.Receiver = tyInfo.NullSqlReceiver(v)
+		}
+		if isArray {
+			tgt.IsNull = v + " == nil"
+		} else {
+			tgt.IsNull = tgt.Convert + " == nil"
+		}
+
+		genCtx.ScanTgts[col.Idx] = tgt
+	}
+
+	for _, col := range qm.LooseCols {
+		addTgt(col, "r."+col.Field.GoName)
+		genCtx.ScanTgts[col.Idx].FieldName = col.Field.GoName
+		genCtx.ScanTgts[col.Idx].FieldType = col.Field.TypeInfo.Name
+		if col.Field.Nullable {
+			genCtx.ScanTgts[col.Idx].FieldType = col.Field.TypeInfo.NullName
+		}
+		genCtx.Loose = append(genCtx.Loose, col.Idx)
+	}
+	for _, nest := range qm.Nests {
+		nestCtx := nestedStructGenCtx{
+			GoName:   nest.GoName,
+			TypeName: nest.Table.Info.GoName,
+			Nullable: nest.Nullable,
+		}
+		isNull := make([]string, 0, len(nest.Cols))
+		for _, col := range nest.Cols {
+			addTgt(col, fmt.Sprintf("r.%s.%s", nest.GoName, col.Field.GoName))
+			nestCtx.Tgts = append(nestCtx.Tgts, col.Idx)
+			isNull = append(isNull, genCtx.ScanTgts[col.Idx].IsNull)
+		}
+		nestCtx.AllNull = strings.Join(isNull, " &&\n\t\t")
+		genCtx.Nests = append(genCtx.Nests, nestCtx)
+	}
+
+	var typeBody strings.Builder
+	err := nestedRowTmpl.Execute(&typeBody, genCtx)
+	if err != nil {
+		return err
+	}
+	var typeSig strings.Builder
+	err = nestedRowSigTmpl.Execute(&typeSig, qm)
+	if err != nil {
+		return err
+	}
+
+	return g.typeResolver.EmitType(qm.ReturnTypeName, typeSig.String(), typeBody.String())
+}
+
+var nestedRowSigTmpl = template.Must(template.New("nested-row-sig-tmpl").Parse(`
+{{- range .Nests }}
+{{ .GoName }} {{ if .Nullable }}*{{ end }}{{ .Table.Info.GoName }}
+{{- end }}
+{{- range .LooseCols }}
+{{- if .Field.Nullable }}
+{{ .Field.GoName }} {{ .Field.TypeInfo.NullName }}
+{{- else }}
+{{ .Field.GoName }} {{ .Field.TypeInfo.Name }}
+{{- end }}
+{{- end }}
+`))
+
+var nestedRowTmpl = template.Must(template.New("nested-row-tmpl").Parse(`
+{{- define "assign" }}
+	{{- if .Direct }}
+	{{ .Dst }} = {{ .Var }}
+	{{- else if .Nullable }}
+	{{ .Dst }} = {{ .Convert }}
+	{{- else }}
+	if {{ .IsNull }} {
+		return fmt.Errorf("unexpected NULL in column '%s'", {{ .QuotedPgName }})
+	}
+	{{ .Dst }} = *{{ .Convert }}
+	{{- end }}
+{{- end }}
+type {{ .GoName }} struct {
+	{{- range .Nests }}
+	{{ .GoName }} {{ if .Nullable }}*{{ end }}{{ .TypeName }}
+	{{- end }}
+	{{- range .Loose }}
+	{{- with (index $.ScanTgts .) }}
+	{{ .FieldName }} {{ .FieldType }}
+	{{- end }}
+	{{- end }}
+}
+func (r *{{ .GoName }}) Scan(rs *sql.Rows) error {
+	var scanTgts struct {
+		{{- range $i, $tgt := .ScanTgts }}
+		c{{ $i }} {{ $tgt.TypeName }}
+		{{- end }}
+	}
+	err := rs.Scan(
+		{{- range .ScanTgts }}
+		{{ .Receiver }},
+		{{- end }}
+	)
+	if err != nil {
+		return err
+	}
+	{{- range .Loose }}
+	{{- template "assign" (index $.ScanTgts .) }}
+	{{- end }}
+	{{- range .Nests }}
+	{{- if .Nullable }}
+
+	r.{{ .GoName }} = nil
+	if !({{ .AllNull }}) {
+		r.{{ .GoName }} = &{{ .TypeName }}{}
+		{{- range .Tgts }}
+		{{- template "assign" (index $.ScanTgts .) }}
+		{{- end }}
+	}
+	{{- else }}
+
+	r.{{ .GoName }} = {{ .TypeName }}{}
+	{{- range .Tgts }}
+	{{- template "assign" (index $.ScanTgts .) }}
+	{{- end }}
+	{{- end }}
+	{{- end }}
+
+	return nil
+}
+`))
+
 var queryShimTmpl = template.Must(template.New("query-shim").Parse(`
 {{ if .ConfigData.SingleResult }}
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-{{- if (not .MultiReturn) }}
-) (ret {{ .ReturnTypeName }}, err error) {
-{{- else }}
-) (ret *{{ .ReturnTypeName }}, err error) {
-{{- end }}
+) (ret {{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}, {{ if .ConfigData.OptionalResult }}ok bool, {{ end }}err error) {
 	return p.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args }}
@@ -140,17 +365,13 @@ func (p *PGClient) {{ .ConfigData.Name }}(
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-{{- if (not .MultiReturn) }}
-) (ret {{ .ReturnTypeName }}, err error) {
-{{- else }}
-) (ret *{{ .ReturnTypeName }}, err error) {
-{{- end }}
+) (ret {{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}, {{ if .ConfigData.OptionalResult }}ok bool, {{ end }}err error) {
 	return tx.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args }}
@@ -162,17 +383,13 @@ func (tx *TxPGClient) {{ .ConfigData.Name }}(
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-{{- if (not .MultiReturn) }}
-) (ret {{ .ReturnTypeName }}, err error) {
-{{- else }}
-) (ret *{{ .ReturnTypeName }}, err error) {
-{{- end }}
+) (ret {{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}, {{ if .ConfigData.OptionalResult }}ok bool, {{ end }}err error) {
 	return conn.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args }}
@@ -183,22 +400,16 @@ func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end }}
-{{- if (not .MultiReturn) }}
-) ({{ .ReturnTypeName }}, error) {
-{{- else }}
-) (*{{ .ReturnTypeName }}, error) {
-{{- end }}
-	{{- if (not .MultiReturn) }}
-	var zero {{ .ReturnTypeName }}
-	{{- else }}
-	var zero *{{ .ReturnTypeName }}
-	{{- end }}
+) ({{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}, {{ if .ConfigData.OptionalResult }}bool, {{ end }}error) {
+	{{- $notOk := "" }}
+	{{- if .ConfigData.OptionalResult }}{{ $notOk = "false, " }}{{ end }}
+	var zero {{ if .MultiReturn }}*{{ end }}{{ .ReturnTypeName }}
 
 	// we still use QueryConfig rather than QueryRowContext so the scan
 	// impl remains consistant. We don't need to split out a seperate Query
@@ -210,7 +421,7 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
@@ -218,44 +429,59 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 		{{- end }}
 	)
 	if err != nil {
-		return zero, err
+		return zero, {{ $notOk }}err
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
+		{{- if .ConfigData.OptionalResult }}
+		return zero, false, rows.Err()
+		{{- else }}
 		return zero, &unstable.NotFoundError{ Msg: "{{ .ConfigData.Name }}: no results" }
+		{{- end }}
 	}
 
 	{{- if .MultiReturn }}
 	ret := &{{ .ReturnTypeName }}{}
-	err = ret.Scan(ctx, p.client, rows)
+	err = ret.Scan(rows)
 	if err != nil {
-		return zero, err
+		return zero, {{ $notOk }}err
 	}
 	{{- else }}
 	{{- if (index .ReturnCols 0).Nullable }}
 	var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
 	err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.NullSqlReceiver "scanTgt" }})
 	if err != nil {
-		return zero, err
+		return zero, {{ $notOk }}err
 	}
 	ret := {{ call (index .ReturnCols 0).TypeInfo.NullConvertFunc "scanTgt" }}
 	{{- else }}
+	var ret {{ .ReturnTypeName }}
 	err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.SqlReceiver "ret" }})
 	if err != nil {
-		return zero, err
+		return zero, {{ $notOk }}err
 	}
 	{{- end }}
 	{{- end }}
 
+	{{- if .ConfigData.OptionalResult }}
+
+	if rows.Next() {
+		return zero, false, fmt.Errorf("{{ .ConfigData.Name }}: expected at most one result row")
+	}
+
+	return ret, true, rows.Err()
+	{{- else }}
+
 	return ret, err
+	{{- end }}
 }
 {{- else }}{{/* if .ConfigData.SingleResult */}}
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -273,7 +499,7 @@ func (p *PGClient) {{ .ConfigData.Name }}(
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -291,7 +517,7 @@ func (tx *TxPGClient) {{ .ConfigData.Name }}(
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -308,7 +534,7 @@ func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -331,7 +557,10 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	for rows.Next() {
 		var row {{ .ReturnTypeName }}
 		{{- if .MultiReturn }}
-		err = row.Scan(ctx, p.client, rows)
+		err = row.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
 		{{- else }}
 		{{- if (index .ReturnCols 0).Nullable }}
 		var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
@@ -361,7 +590,7 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}(
 func (p *PGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -379,7 +608,7 @@ func (p *PGClient) {{ .ConfigData.Name }}Query(
 func (tx *TxPGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -397,7 +626,7 @@ func (tx *TxPGClient) {{ .ConfigData.Name }}Query(
 func (conn *ConnPGClient) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -414,7 +643,7 @@ func (conn *ConnPGClient) {{ .ConfigData.Name }}Query(
 func (p *pgClientImpl) {{ .ConfigData.Name }}Query(
 	ctx context.Context,
 	{{- range .Args }}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
@@ -427,7 +656,7 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}Query(
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
@@ -435,6 +664,284 @@ func (p *pgClientImpl) {{ .ConfigData.Name }}Query(
 		{{- end }}
 	)
 }
+{{- if .ConfigData.Iterators }}
+
+{{ .Comment }}
+func (p *PGClient) {{ .ConfigData.Name }}Iter(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return p.impl.{{ .ConfigData.Name }}Iter(
+		ctx,
+		{{- range .Args}}
+		{{ .GoName }},
+		{{- end}}
+	)
+}
+{{ .Comment }}
+func (tx *TxPGClient) {{ .ConfigData.Name }}Iter(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return tx.impl.{{ .ConfigData.Name }}Iter(
+		ctx,
+		{{- range .Args}}
+		{{ .GoName }},
+		{{- end}}
+	)
+}
+{{ .Comment }}
+func (conn *ConnPGClient) {{ .ConfigData.Name }}Iter(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return conn.impl.{{ .ConfigData.Name }}Iter(
+		ctx,
+		{{- range .Args}}
+		{{ .GoName }},
+		{{- end}}
+	)
+}
+func (p *pgClientImpl) {{ .ConfigData.Name }}Iter(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return func(yield func({{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error) bool) {
+		var zero {{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}
+
+		rows, err := p.{{ .ConfigData.Name }}Query(
+			ctx,
+			{{- range .Args}}
+			{{ .GoName }},
+			{{- end}}
+		)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+		{{- if (and .MultiReturn (not .Nests)) }}
+
+		posTab, err := p.client.colPosTab(
+			ctx,
+			genTimeColIdxTabFor{{ .ReturnTypeName }},
+			&p.client.rwlockFor{{ .ConfigData.Name }}Row,
+			rows,
+			&p.client.colIdxTabFor{{ .ConfigData.Name }}Row,
+		)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		{{- end }}
+
+		for rows.Next() {
+			var row {{ .ReturnTypeName }}
+			{{- if .MultiReturn }}
+			{{- if .Nests }}
+			err = row.Scan(rows)
+			{{- else }}
+			err = row.scanWithPosTab(rows, posTab)
+			{{- end }}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			{{- else }}
+			{{- if (index .ReturnCols 0).Nullable }}
+			var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
+			err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.NullSqlReceiver "scanTgt" }})
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			row = {{ call (index .ReturnCols 0).TypeInfo.NullConvertFunc "scanTgt" }}
+			{{- else }}
+			err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.SqlReceiver "row" }})
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			{{- end }}
+			{{- end }}
+			if !yield({{ if $.ConfigData.BoxResults }}&{{ end }}row, nil) {
+				return
+			}
+		}
+
+		err = rows.Err()
+		if err != nil {
+			yield(zero, err)
+		}
+	}
+}
+{{- end }}{{/* if .ConfigData.Iterators */}}
+{{- if .ConfigData.CursorFetchSize }}
+
+{{ .Comment }}
+// {{ .ConfigData.Name }}Cursor streams the results of the query through a
+// server-side cursor, fetching {{ .ConfigData.CursorFetchSize }} rows at a time. Each batch
+// of rows is read in full before any of them are yielded, so the transaction
+// can be used from within the loop body.
+func (tx *TxPGClient) {{ .ConfigData.Name }}Cursor(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return tx.impl.{{ .ConfigData.Name }}Cursor(
+		ctx,
+		{{- range .Args}}
+		{{ .GoName }},
+		{{- end}}
+	)
+}
+func (p *pgClientImpl) {{ .ConfigData.Name }}Cursor(
+	ctx context.Context,
+	{{- range .Args }}
+	{{- if .Nullable }}
+	{{ .GoName }} {{ .TypeInfo.NullName }},
+	{{- else }}
+	{{ .GoName }} {{ .TypeInfo.Name }},
+	{{- end }}
+	{{- end }}
+) iter.Seq2[{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error] {
+	return func(yield func({{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error) bool) {
+		var zero {{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}
+
+		cursor := p.cursors.acquire("pggen_{{ .ConfigData.Name }}_cursor")
+		defer p.cursors.release(cursor)
+		_, err := p.db.ExecContext(
+			ctx,
+			"DECLARE " + cursor + " NO SCROLL CURSOR FOR " + ` + "`" +
+	`{{ .ConfigData.Body }}` +
+	"`" + `,
+			{{- range .Args }}
+			{{- if .Nullable }}
+			{{ call .TypeInfo.NullSqlArgument .GoName }},
+			{{- else }}
+			{{ call .TypeInfo.SqlArgument .GoName }},
+			{{- end }}
+			{{- end }}
+		)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer func() {
+			// Use a fresh context so that the cursor still gets closed if ctx
+			// has been cancelled. If the transaction has been aborted, the
+			// cursor is already gone and this fails harmlessly.
+			_, _ = p.db.ExecContext(context.Background(), "CLOSE " + cursor)
+		}()
+
+		for {
+			err = ctx.Err()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			batch, err := p.fetch{{ .ConfigData.Name }}Batch(ctx, cursor)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, row := range batch {
+				if !yield(row, nil) {
+					return
+				}
+			}
+			if len(batch) < {{ .ConfigData.CursorFetchSize }} {
+				return
+			}
+		}
+	}
+}
+func (p *pgClientImpl) fetch{{ .ConfigData.Name }}Batch(
+	ctx context.Context,
+	cursor string,
+) ([]{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, error) {
+	rows, err := p.queryContext(ctx, "FETCH FORWARD {{ .ConfigData.CursorFetchSize }} FROM " + cursor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	{{- if (and .MultiReturn (not .Nests)) }}
+
+	posTab, err := p.client.colPosTab(
+		ctx,
+		genTimeColIdxTabFor{{ .ReturnTypeName }},
+		&p.client.rwlockFor{{ .ConfigData.Name }}Row,
+		rows,
+		&p.client.colIdxTabFor{{ .ConfigData.Name }}Row,
+	)
+	if err != nil {
+		return nil, err
+	}
+	{{- end }}
+
+	ret := make([]{{ if $.ConfigData.BoxResults }}*{{ end }}{{ .ReturnTypeName }}, 0, {{ .ConfigData.CursorFetchSize }})
+	for rows.Next() {
+		var row {{ .ReturnTypeName }}
+		{{- if .MultiReturn }}
+		{{- if .Nests }}
+		err = row.Scan(rows)
+		{{- else }}
+		err = row.scanWithPosTab(rows, posTab)
+		{{- end }}
+		if err != nil {
+			return nil, err
+		}
+		{{- else }}
+		{{- if (index .ReturnCols 0).Nullable }}
+		var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.NullSqlReceiver "scanTgt" }})
+		if err != nil {
+			return nil, err
+		}
+		row = {{ call (index .ReturnCols 0).TypeInfo.NullConvertFunc "scanTgt" }}
+		{{- else }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.SqlReceiver "row" }})
+		if err != nil {
+			return nil, err
+		}
+		{{- end }}
+		{{- end }}
+		ret = append(ret, {{ if $.ConfigData.BoxResults }}&{{ end }}row)
+	}
+
+	return ret, rows.Err()
+}
+{{- end }}{{/* if .ConfigData.CursorFetchSize */}}
 
 {{- end }}{{/* if .ConfigData.SingleResult */}}
 `))
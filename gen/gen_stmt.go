@@ -1,11 +1,12 @@
 package gen
 
 import (
+	"fmt"
 	"io"
 	"text/template"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
-	"github.com/ferumlabs/pggen/gen/internal/names"
+	"github.com/ferumlabs/pggen/gen/internal/meta"
 )
 
 func (g *Generator) genStmts(into io.Writer, stmts []config.StmtConfig) error {
@@ -18,10 +19,10 @@ func (g *Generator) genStmts(into io.Writer, stmts []config.StmtConfig) error {
 	g.imports[`"database/sql"`] = true
 	g.imports[`"context"`] = true
 
-	for i := range stmts {
+	for i, stmt := range stmts {
 		err := g.genStmt(into, &stmts[i])
 		if err != nil {
-			return err
+			return fmt.Errorf("generating statement '%s'%s: %s", stmt.Name, definedAt(stmt.Source), err.Error())
 		}
 	}
 
@@ -31,28 +32,63 @@ func (g *Generator) genStmts(into io.Writer, stmts []config.StmtConfig) error {
 func (g *Generator) genStmt(into io.Writer, stmt *config.StmtConfig) error {
 	g.log.Infof("		generating statement '%s'\n", stmt.Name)
 
-	stmt.Name = names.PgToGoName(stmt.Name)
+	stmt.Name = g.goNames.PgToGoName(stmt.Name)
 
-	meta, err := g.metaResolver.StmtMeta(stmt)
+	stmtMeta, err := g.metaResolver.StmtMeta(stmt)
 	if err != nil {
 		return err
 	}
 
-	return stmtShimTmpl.Execute(into, meta)
+	if stmtMeta.MultiReturn {
+		// the row type is generated just like the row type for a query
+		genCtx := buildTableGenCtx(&meta.QueryMeta{
+			ConfigData:     config.QueryConfig{Name: stmt.Name},
+			ReturnCols:     stmtMeta.ReturnCols,
+			MultiReturn:    true,
+			ReturnTypeName: stmtMeta.ReturnTypeName,
+		})
+		err = g.typeResolver.EmitStructType(stmtMeta.ReturnTypeName, &genCtx)
+		if err != nil {
+			return fmt.Errorf("generating return struct for '%s': %s", stmt.Name, err.Error())
+		}
+	}
+
+	return stmtShimTmpl.Execute(into, stmtMeta)
 }
 
 var stmtShimTmpl *template.Template = template.Must(template.New("stmt-shim").Parse(`
+{{- define "result" }}
+{{- if .ConfigData.Returning }}[]{{ .ReturnTypeName }}{{ else }}sql.Result{{ end }}
+{{- end }}
+{{- define "check-rows" }}
+	{{- with .ConfigData.ExpectRows }}
+	{{- if (eq .Min .Max) }}
+	if n != {{ .Min }} {
+	{{- else }}
+	if {{ if (gt .Min 0) }}n < {{ .Min }}{{ end }}
+	{{- if (and (gt .Min 0) (ge .Max 0)) }} || {{ end }}
+	{{- if (ge .Max 0) }}n > {{ .Max }}{{ end }} {
+	{{- end }}
+		return nil, &pggen.RowCountError{
+			Stmt:   "{{ $.ConfigData.Name }}",
+			Min:    {{ .Min }},
+			Max:    {{ .Max }},
+			Actual: n,
+		}
+	}
+	{{- end }}
+{{- end }}
 {{ .Comment }}
 func (p *PGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
-) (sql.Result, error) {
+) ({{ template "result" . }}, error) {
 	return p.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args}}
@@ -64,13 +100,13 @@ func (p *PGClient) {{ .ConfigData.Name }}(
 func (tx *TxPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
-) (sql.Result, error) {
+) ({{ template "result" . }}, error) {
 	return tx.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args}}
@@ -82,13 +118,13 @@ func (tx *TxPGClient) {{ .ConfigData.Name }}(
 func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
-) (sql.Result, error) {
+) ({{ template "result" . }}, error) {
 	return conn.impl.{{ .ConfigData.Name }}(
 		ctx,
 		{{- range .Args}}
@@ -99,26 +135,86 @@ func (conn *ConnPGClient) {{ .ConfigData.Name }}(
 func (p *pgClientImpl) {{ .ConfigData.Name }}(
 	ctx context.Context,
 	{{- range .Args}}
-	{{- if $.ConfigData.NullableArguments }}
+	{{- if .Nullable }}
 	{{ .GoName }} {{ .TypeInfo.NullName }},
 	{{- else }}
 	{{ .GoName }} {{ .TypeInfo.Name }},
 	{{- end }}
 	{{- end}}
-) (sql.Result, error) {
+) ({{ template "result" . }}, error) {
+	{{- if .ConfigData.Returning }}
+	rows, err := p.queryContext(
+	{{- else if .ConfigData.ExpectRows }}
+	res, err := p.db.ExecContext(
+	{{- else }}
 	return p.db.ExecContext(
+	{{- end }}
 		ctx,
 		` + "`" +
 	`{{ .ConfigData.Body }}` +
 	"`" + `,
 		{{- range .Args }}
-		{{- if $.ConfigData.NullableArguments }}
+		{{- if .Nullable }}
 		{{ call .TypeInfo.NullSqlArgument .GoName }},
 		{{- else }}
 		{{ call .TypeInfo.SqlArgument .GoName }},
 		{{- end }}
 		{{- end }}
 	)
+	{{- if .ConfigData.Returning }}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []{{ .ReturnTypeName }}{}
+	for rows.Next() {
+		{{- if .MultiReturn }}
+		var row {{ .ReturnTypeName }}
+		err = row.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		{{- else if (index .ReturnCols 0).Nullable }}
+		var scanTgt {{ (index .ReturnCols 0).TypeInfo.ScanNullName }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.NullSqlReceiver "scanTgt" }})
+		if err != nil {
+			return nil, err
+		}
+		row := {{ call (index .ReturnCols 0).TypeInfo.NullConvertFunc "scanTgt" }}
+		{{- else }}
+		var row {{ .ReturnTypeName }}
+		err = rows.Scan({{ call (index .ReturnCols 0).TypeInfo.SqlReceiver "row" }})
+		if err != nil {
+			return nil, err
+		}
+		{{- end }}
+		ret = append(ret, row)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	{{- if .ConfigData.ExpectRows }}
+
+	n := int64(len(ret))
+	{{- template "check-rows" . }}
+	{{- end }}
+
+	return ret, nil
+	{{- else if .ConfigData.ExpectRows }}
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	{{- template "check-rows" . }}
+
+	return res, nil
+	{{- end }}
 }
 
 `))
@@ -38,6 +38,41 @@ func (g *Generator) genTables(into io.Writer, tables []config.TableConfig) error
 	return nil
 }
 
+// dropShadowedLookups removes the lookup methods whose names are already taken
+// by a query or statement, so that adding an index to a table does not break
+// code which already has a hand-written lookup with the same name.
+func (g *Generator) dropShadowedLookups(conf *config.DbConfig) {
+	taken := map[string]bool{}
+	for _, q := range conf.Queries {
+		taken[g.goNames.PgToGoName(q.Name)] = true
+	}
+	for _, s := range conf.Stmts {
+		taken[g.goNames.PgToGoName(s.Name)] = true
+	}
+
+	keep := func(prefix string, lookups []meta.LookupMeta) []meta.LookupMeta {
+		var kept []meta.LookupMeta
+		for _, lookup := range lookups {
+			name := prefix + lookup.GoName
+			if taken[name] {
+				g.log.Warnf("not generating '%s' because a query or statement has that name\n", name)
+				continue
+			}
+			kept = append(kept, lookup)
+		}
+		return kept
+	}
+
+	for _, tc := range conf.Tables {
+		tableInfo, ok := g.metaResolver.TableMeta(tc.Name)
+		if !ok {
+			continue
+		}
+		tableInfo.UniqueLookups = keep("Get"+tableInfo.Info.GoName, tableInfo.UniqueLookups)
+		tableInfo.FkLookups = keep("List"+tableInfo.Info.GoName, tableInfo.FkLookups)
+	}
+}
+
 func tableGenCtxFromInfo(info *meta.TableMeta) meta.TableGenCtx {
 	return meta.TableGenCtx{
 		PgName:         info.Info.PgName,
@@ -72,7 +107,11 @@ func (g *Generator) genTable(
 		return
 	}
 
-	if tableInfo.HasUpdatedAtField || tableInfo.HasCreatedAtField {
+	if table.Iterators {
+		g.imports[`"iter"`] = true
+	}
+
+	if tableInfo.HasUpdatedAtField || tableInfo.HasCreatedAtField || tableInfo.HasDeletedAtField {
 		g.imports[`"time"`] = true
 	}
 
@@ -91,28 +130,37 @@ func (p *PGClient) Get{{ .GoName }}(
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) ({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
-	return p.impl.get{{ .GoName }}(ctx, id)
+	return p.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (tx *TxPGClient) Get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) ({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
-	return tx.impl.get{{ .GoName }}(ctx, id)
+	return tx.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (conn *ConnPGClient) Get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) ({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
-	return conn.impl.get{{ .GoName }}(ctx, id)
+	return conn.impl.get{{ .GoName }}(ctx, id, opts...)
 }
 func (p *pgClientImpl) get{{ .GoName }}(
 	ctx context.Context,
 	id {{ .PkeyCol.TypeInfo.Name }},
 	opts ...pggen.GetOpt,
 ) ({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
-	values, err := p.list{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id}, true /* isGet */)
+	opt := pggen.GetOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	var listOpts []pggen.ListOpt
+	if opt.IncludeDeleted {
+		listOpts = append(listOpts, pggen.ListIncludeDeleted)
+	}
+
+	values, err := p.list{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id}, true /* isGet */, listOpts...)
 	if err != nil {
 		return {{ if .Meta.Config.BoxResults }}nil{{- else }}{{ .GoName }}{}{{- end }}, err
 	}
@@ -179,12 +227,14 @@ func (p *pgClientImpl) listBatch{{ .GoName }}(
 		return []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}, nil
 	}
 
-	rows, err := p.queryContext(
-		ctx,
-		` + "`" + `SELECT {{ range $i, $col := .Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)
-		{{- if .Meta.HasDeletedAtField }} AND "{{ .Meta.PgDeletedAtField }}" IS NULL {{ end }}` + "`" + `,
-		pgtypes.Array(ids),
-	)
+	query := ` + "`" + `SELECT {{ range $i, $col := .Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `
+	{{- if .Meta.HasDeletedAtField }}
+	if !opt.IncludeDeleted {
+		query += ` + "`" + ` AND "{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+
+	rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
 	if err != nil {
 		return nil, err
 	}
@@ -218,207 +268,741 @@ func (p *pgClientImpl) listBatch{{ .GoName }}(
 
 	return ret, nil
 }
+{{- if .Meta.Config.Iterators }}
 
-// Insert a {{ .GoName }} into the database. Returns the primary
-// key of the inserted row.
-func (p *PGClient) Insert{{ .GoName }}(
+// All{{ .GoName }} streams every {{ .GoName }} in the database, in primary key order.
+func (p *PGClient) All{{ .GoName }}(
 	ctx context.Context,
-	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
-	return p.impl.insert{{ .GoName }}(ctx, value, opts...)
+	opts ...pggen.ListOpt,
+) iter.Seq2[{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error] {
+	return p.impl.all{{ .GoName }}(ctx, opts...)
 }
-// Insert a {{ .GoName }} into the database. Returns the primary
-// key of the inserted row.
-func (tx *TxPGClient) Insert{{ .GoName }}(
+func (tx *TxPGClient) All{{ .GoName }}(
 	ctx context.Context,
-	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
-	return tx.impl.insert{{ .GoName }}(ctx, value, opts...)
+	opts ...pggen.ListOpt,
+) iter.Seq2[{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error] {
+	return tx.impl.all{{ .GoName }}(ctx, opts...)
 }
-// Insert a {{ .GoName }} into the database. Returns the primary
-// key of the inserted row.
-func (conn *ConnPGClient) Insert{{ .GoName }}(
+func (conn *ConnPGClient) All{{ .GoName }}(
 	ctx context.Context,
-	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
-	return conn.impl.insert{{ .GoName }}(ctx, value, opts...)
+	opts ...pggen.ListOpt,
+) iter.Seq2[{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error] {
+	return conn.impl.all{{ .GoName }}(ctx, opts...)
 }
-// Insert a {{ .GoName }} into the database. Returns the primary
-// key of the inserted row.
-func (p *pgClientImpl) insert{{ .GoName }}(
+func (p *pgClientImpl) all{{ .GoName }}(
 	ctx context.Context,
-	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
-	var rets []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}
-	rets, err = p.bulkInsert{{ .GoName }}(ctx, []{{ .GoName }}{value}, opts...)
-	if err != nil {
-		return ret, err
+	opts ...pggen.ListOpt,
+) iter.Seq2[{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error] {
+	opt := pggen.ListOptions{}
+	for _, o := range opts {
+		o(&opt)
 	}
 
-	if len(rets) != 1 {
-		return ret, fmt.Errorf("inserting a {{ .GoName }}: %d rows (expected 1)", len(rets))
-	}
+	return func(yield func({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) bool) {
+		var zero {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}
 
-	ret = rets[0]
-	return
+		query := ` + "`" + `SELECT * FROM {{ .PgName }}` + "`" + `
+		{{- if .Meta.HasDeletedAtField }}
+		if !opt.IncludeDeleted {
+			query += ` + "`" + ` WHERE "{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+		}
+		{{- end }}
+		query += ` + "`" + ` ORDER BY "{{ .PkeyCol.PgName }}"` + "`" + `
+
+		rows, err := p.queryContext(ctx, query)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		posTab, err := p.client.colPosTab(
+			ctx,
+			genTimeColIdxTabFor{{ .GoName }},
+			&p.client.rwlockFor{{ .GoName }},
+			rows,
+			&p.client.colIdxTabFor{{ .GoName }},
+		)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		for rows.Next() {
+			var value {{ .GoName }}
+			err = value.scanWithPosTab(rows, posTab)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield({{- if .Meta.Config.BoxResults }}&{{- end }}value, nil) {
+				return
+			}
+		}
+
+		err = rows.Err()
+		if err != nil {
+			yield(zero, err)
+		}
+	}
 }
+{{- end }}
+{{- range .Meta.UniqueLookups }}
 
-// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
-// the inserted rows.
-func (p *PGClient) BulkInsert{{ .GoName }}(
+// Get{{ $.GoName }}{{ .GoName }} fetches the {{ $.GoName }} with the given
+{{- range $i, $key := .Keys }}{{ if $i }} and{{ end }} {{ $key.Col.PgName }}{{ end }}.
+func (p *PGClient) Get{{ $.GoName }}{{ .GoName }}(
 	ctx context.Context,
-	values []{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
-	return p.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+	{{- range .Keys }}
+	{{ .ArgName }} {{ .Col.TypeInfo.Name }},
+	{{- end }}
+	opts ...pggen.GetOpt,
+) ({{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return p.impl.get{{ $.GoName }}{{ .GoName }}(ctx, {{ range .Keys }}{{ .ArgName }}, {{ end }}opts...)
 }
-// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
-// the inserted rows.
-func (tx *TxPGClient) BulkInsert{{ .GoName }}(
+func (tx *TxPGClient) Get{{ $.GoName }}{{ .GoName }}(
 	ctx context.Context,
-	values []{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
-	return tx.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+	{{- range .Keys }}
+	{{ .ArgName }} {{ .Col.TypeInfo.Name }},
+	{{- end }}
+	opts ...pggen.GetOpt,
+) ({{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return tx.impl.get{{ $.GoName }}{{ .GoName }}(ctx, {{ range .Keys }}{{ .ArgName }}, {{ end }}opts...)
 }
-// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
-// the inserted rows.
-func (conn *ConnPGClient) BulkInsert{{ .GoName }}(
+func (conn *ConnPGClient) Get{{ $.GoName }}{{ .GoName }}(
 	ctx context.Context,
-	values []{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
-	return conn.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+	{{- range .Keys }}
+	{{ .ArgName }} {{ .Col.TypeInfo.Name }},
+	{{- end }}
+	opts ...pggen.GetOpt,
+) ({{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return conn.impl.get{{ $.GoName }}{{ .GoName }}(ctx, {{ range .Keys }}{{ .ArgName }}, {{ end }}opts...)
 }
-// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
-// the inserted rows.
-func (p *pgClientImpl) bulkInsert{{ .GoName }}(
+func (p *pgClientImpl) get{{ $.GoName }}{{ .GoName }}(
 	ctx context.Context,
-	values []{{ .GoName }},
-	opts ...pggen.InsertOpt,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
-	if len(values) == 0 {
-		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+	{{- range .Keys }}
+	{{ .ArgName }} {{ .Col.TypeInfo.Name }},
+	{{- end }}
+	opts ...pggen.GetOpt,
+) ({{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	opt := pggen.GetOptions{}
+	for _, o := range opts {
+		o(&opt)
 	}
 
-	opt := pggen.InsertOptions{}
+	query := ` + "`" + `SELECT {{ range $i, $col := $.Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ $.PgName }} WHERE
+		{{- range $i, $key := .Keys }}{{ if $i }} AND{{ end }} "{{ $key.Col.PgName }}" = ${{ $key.Idx }}{{ end }}` + "`" + `
+	{{- if $.Meta.HasDeletedAtField }}
+	if !opt.IncludeDeleted {
+		query += ` + "`" + ` AND "{{ $.Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+
+	rows, err := p.queryContext(
+		ctx,
+		query,
+		{{- range .Keys }}
+		{{ call .Col.TypeInfo.SqlArgument .ArgName }},
+		{{- end }}
+	)
+	if err != nil {
+		return {{ if $.Meta.Config.BoxResults }}nil{{ else }}{{ $.GoName }}{}{{ end }}, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		err = rows.Err()
+		if err != nil {
+			return {{ if $.Meta.Config.BoxResults }}nil{{ else }}{{ $.GoName }}{}{{ end }}, err
+		}
+		return {{ if $.Meta.Config.BoxResults }}nil{{ else }}{{ $.GoName }}{}{{ end }}, &unstable.NotFoundError{
+			Msg: "Get{{ $.GoName }}{{ .GoName }}: record not found",
+		}
+	}
+
+	var value {{ $.GoName }}
+	err = value.Scan(rows)
+	if err != nil {
+		return {{ if $.Meta.Config.BoxResults }}nil{{ else }}{{ $.GoName }}{}{{ end }}, err
+	}
+
+	return {{ if $.Meta.Config.BoxResults }}&{{ end }}value, nil
+}
+{{- end }}
+{{- range .Meta.FkLookups }}
+{{- $key := index .Keys 0 }}
+
+// List{{ $.GoName }}{{ .GoName }} returns every {{ $.GoName }} whose {{ $key.Col.PgName }}
+// is one of the given values.
+func (p *PGClient) List{{ $.GoName }}{{ .GoName }}(
+	ctx context.Context,
+	{{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) ([]{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return p.impl.list{{ $.GoName }}{{ .GoName }}(ctx, {{ $key.PluralArgName }}, opts...)
+}
+func (tx *TxPGClient) List{{ $.GoName }}{{ .GoName }}(
+	ctx context.Context,
+	{{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) ([]{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return tx.impl.list{{ $.GoName }}{{ .GoName }}(ctx, {{ $key.PluralArgName }}, opts...)
+}
+func (conn *ConnPGClient) List{{ $.GoName }}{{ .GoName }}(
+	ctx context.Context,
+	{{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) ([]{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	return conn.impl.list{{ $.GoName }}{{ .GoName }}(ctx, {{ $key.PluralArgName }}, opts...)
+}
+func (p *pgClientImpl) list{{ $.GoName }}{{ .GoName }}(
+	ctx context.Context,
+	{{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }},
+	opts ...pggen.ListOpt,
+) ([]{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	opt := pggen.ListOptions{}
 	for _, o := range opts {
 		o(&opt)
 	}
-	
-	rets := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
 
-	batches := batcher.Batch(values, BatchSize)
+	ret := []{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}{}
+	batches := batcher.Batch({{ $key.PluralArgName }}, BatchSize)
 	for _, batch := range batches {
-		batchRet, err := p.bulkInsertBatch{{ .GoName }}(ctx, batch, opt)
+		batchRet, err := p.listBatch{{ $.GoName }}{{ .GoName }}(ctx, batch, opt)
 		if err != nil {
 			return nil, err
 		}
-		rets = append(rets, batchRet...)
+		ret = append(ret, batchRet...)
 	}
 
-	return rets, nil
+	return ret, nil
 }
-func (p *pgClientImpl) bulkInsertBatch{{ .GoName }}(
+func (p *pgClientImpl) listBatch{{ $.GoName }}{{ .GoName }}(
 	ctx context.Context,
-	values []{{ .GoName }},
-	opt pggen.InsertOptions,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
-	if len(values) == 0 {
-		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+	{{ $key.PluralArgName }} []{{ $key.Col.TypeInfo.Name }},
+	opt pggen.ListOptions,
+) ([]{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}, error) {
+	if len({{ $key.PluralArgName }}) == 0 {
+		return []{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}{}, nil
 	}
 
-	{{- if (or .Meta.HasCreatedAtField .Meta.HasUpdatedAtField) }}
-	if !opt.DisableTimestamps {
-		now := time.Now()
-
-		{{- if .Meta.HasCreatedAtField }}
-		for i := range values {
-			{{- if .Meta.CreatedAtHasTimezone }}
-			createdAt := now
-			{{- else }}
-			createdAt := now.UTC()
-			{{- end }}
-	
-			{{- if .Meta.HasCreatedAtField }}
-			{{- if .Meta.CreatedAtFieldIsNullable }}
-			values[i].{{ .Meta.GoCreatedAtField }} = &createdAt
-			{{- else }}
-			values[i].{{ .Meta.GoCreatedAtField }} = createdAt
-			{{- end }}
-			{{- end }}
-		}
-		{{- end }}
-	
-		{{- if .Meta.HasUpdatedAtField }}
-		for i := range values {
-			{{- if .Meta.UpdatedAtHasTimezone }}
-			updatedAt := now
-			{{- else }}
-			updatedAt := now.UTC()
-			{{- end }}
-	
-			{{- if .Meta.HasUpdatedAtField }}
-			{{- if .Meta.UpdatedAtFieldIsNullable }}
-			values[i].{{ .Meta.GoUpdatedAtField }} = &updatedAt
-			{{- else }}
-			values[i].{{ .Meta.GoUpdatedAtField }} = updatedAt
-			{{- end }}
-			{{- end }}
-		}
-		{{- end }}
+	query := ` + "`" + `SELECT {{ range $i, $col := $.Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ $.PgName }} WHERE "{{ $key.Col.PgName }}" = ANY($1)` + "`" + `
+	{{- if $.Meta.HasDeletedAtField }}
+	if !opt.IncludeDeleted {
+		query += ` + "`" + ` AND "{{ $.Meta.PgDeletedAtField }}" IS NULL` + "`" + `
 	}
 	{{- end }}
 
-	defaultFields := opt.DefaultFields.Intersection(defaultableColsFor{{ .GoName }})
-	args := make([]interface{}, 0, {{ len .Meta.Info.Cols }} * len(values))
-	for _, v := range values {
-		{{- range .Meta.Info.Cols }}
-		{{- if (not .IsPrimary) }}
-		{{- if .Nullable }}
-		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
-			args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "v.%s" .GoName) }})
-		}
-		{{- else }}
-		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
-			args = append(args, {{ call .TypeInfo.SqlArgument (printf "v.%s" .GoName) }})
-		}
-		{{- end }}
-		{{- else }}
-		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
-			{{- if .Nullable }}
-			args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "v.%s" .GoName) }})
-			{{- else }}
-			args = append(args, {{ call .TypeInfo.SqlArgument (printf "v.%s" .GoName) }})
-			{{- end }}
-		}
-		{{- end }}
-		{{- end }}
-	}
-
-	bulkInsertQuery := genBulkInsertStmt(
-		` + "`" + `{{ .PgName }}` + "`" + `,
-		fieldsFor{{ .GoName }},
-		len(values),
-		"{{ .PkeyCol.PgName }}",
-		true,
-		defaultFields,
-	)
-
-	rows, err := p.queryContext(ctx, bulkInsertQuery, args...)
+	rows, err := p.queryContext(ctx, query, pgtypes.Array({{ $key.PluralArgName }}))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	rets := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	ret := []{{ if $.Meta.Config.BoxResults }}*{{ end }}{{ $.GoName }}{}
 	for rows.Next() {
-		var ret {{ .GoName }}
-		err = ret.Scan(rows)
+		var value {{ $.GoName }}
+		err = value.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, {{ if $.Meta.Config.BoxResults }}&{{ end }}value)
+	}
+
+	return ret, rows.Err()
+}
+{{- end }}
+
+// Count{{ .GoName }} returns the number of {{ .GoName }} records whose fields
+// match 'filter'. Only the fields in 'filterFields' are compared, so an empty
+// field set counts every record.
+func (p *PGClient) Count{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	opts ...pggen.CountOpt,
+) (int64, error) {
+	return p.impl.count{{ .GoName }}(ctx, filter, filterFields, opts...)
+}
+func (tx *TxPGClient) Count{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	opts ...pggen.CountOpt,
+) (int64, error) {
+	return tx.impl.count{{ .GoName }}(ctx, filter, filterFields, opts...)
+}
+func (conn *ConnPGClient) Count{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	opts ...pggen.CountOpt,
+) (int64, error) {
+	return conn.impl.count{{ .GoName }}(ctx, filter, filterFields, opts...)
+}
+func (p *pgClientImpl) count{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	opts ...pggen.CountOpt,
+) (int64, error) {
+	opt := pggen.CountOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	conds, args := filterConds{{ .GoName }}(filter, filterFields, opt.IncludeDeleted)
+	stmt := ` + "`" + `SELECT count(*) FROM {{ .PgName }}` + "`" + `
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var count int64
+	err := p.db.QueryRowContext(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// filterConds{{ .GoName }} returns the conditions, and the arguments for them, which
+// match the records whose fields in 'filterFields' are equal to those of 'filter'.
+func filterConds{{ .GoName }}(
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	includeDeleted bool,
+) ([]string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	{{- range .Meta.Info.Cols }}
+	if filterFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
+		{{- if .Nullable }}
+		args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "filter.%s" .GoName) }})
+		conds = append(conds, fmt.Sprintf(` + "`" + `"{{ .PgName }}" IS NOT DISTINCT FROM $%d` + "`" + `, len(args)))
+		{{- else }}
+		args = append(args, {{ call .TypeInfo.SqlArgument (printf "filter.%s" .GoName) }})
+		conds = append(conds, fmt.Sprintf(` + "`" + `"{{ .PgName }}" = $%d` + "`" + `, len(args)))
+		{{- end }}
+	}
+	{{- end }}
+	{{- if .Meta.HasDeletedAtField }}
+	if !includeDeleted {
+		conds = append(conds, ` + "`" + `"{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `)
+	}
+	{{- end }}
+	return conds, args
+}
+
+// Exists{{ .GoName }} reports whether there is a {{ .GoName }} with the given id.
+func (p *PGClient) Exists{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ExistsOpt,
+) (bool, error) {
+	return p.impl.exists{{ .GoName }}(ctx, id, opts...)
+}
+func (tx *TxPGClient) Exists{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ExistsOpt,
+) (bool, error) {
+	return tx.impl.exists{{ .GoName }}(ctx, id, opts...)
+}
+func (conn *ConnPGClient) Exists{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ExistsOpt,
+) (bool, error) {
+	return conn.impl.exists{{ .GoName }}(ctx, id, opts...)
+}
+func (p *pgClientImpl) exists{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.ExistsOpt,
+) (bool, error) {
+	opt := pggen.ExistsOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	stmt := ` + "`" + `SELECT EXISTS (SELECT 1 FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = $1` + "`" + `
+	{{- if .Meta.HasDeletedAtField }}
+	if !opt.IncludeDeleted {
+		stmt += ` + "`" + ` AND "{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+	}
+	{{- end }}
+	stmt += ")"
+
+	var exists bool
+	err := p.db.QueryRowContext(ctx, stmt, id).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Get{{ .GoName }}ForUpdate fetches the {{ .GoName }} with the given id and locks
+// it until the end of the transaction. By default it takes a FOR UPDATE lock and
+// waits for any conflicting locks to be released. With pggen.LockSkipLocked, a
+// record locked by another transaction is reported as not found.
+func (tx *TxPGClient) Get{{ .GoName }}ForUpdate(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.LockOpt,
+) ({{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
+	values, err := tx.impl.list{{ .GoName }}ForUpdate(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id}, true /* isGet */, opts...)
+	if err != nil {
+		return {{ if .Meta.Config.BoxResults }}nil{{- else }}{{ .GoName }}{}{{- end }}, err
+	}
+
+	// list{{ .GoName }}ForUpdate returns exactly one record for a get, so this is safe.
+	return values[0], nil
+}
+
+// List{{ .GoName }}ForUpdate fetches the {{ .GoName }} records with the given ids
+// and locks them until the end of the transaction. The records are locked in
+// primary key order to avoid deadlocks between transactions locking overlapping
+// sets of records. With pggen.LockSkipLocked, records locked by another
+// transaction are left out of the results rather than reported as an error.
+func (tx *TxPGClient) List{{ .GoName }}ForUpdate(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	opts ...pggen.LockOpt,
+) ([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
+	return tx.impl.list{{ .GoName }}ForUpdate(ctx, ids, false /* isGet */, opts...)
+}
+func (p *pgClientImpl) list{{ .GoName }}ForUpdate(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+	isGet bool,
+	opts ...pggen.LockOpt,
+) ([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
+	opt := pggen.LockOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	lockClause, err := genLockClause(opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}, nil
+	}
+
+	ret := make([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, 0, len(ids))
+	batches := batcher.Batch(ids, BatchSize)
+	for _, batch := range batches {
+		query := ` + "`" + `SELECT {{ range $i, $col := .Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `
+		{{- if .Meta.HasDeletedAtField }}
+		query += ` + "`" + ` AND "{{ .Meta.PgDeletedAtField }}" IS NULL` + "`" + `
+		{{- end }}
+		query += ` + "`" + ` ORDER BY "{{ .PkeyCol.PgName }}"` + "`" + ` + lockClause
+
+		rows, err := p.queryContext(ctx, query, pgtypes.Array(batch))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var value {{ .GoName }}
+			err = value.Scan(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ret = append(ret, {{- if .Meta.Config.BoxResults }}&{{- end }}value)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ret) != len(ids) {
+		if isGet {
+			return nil, &unstable.NotFoundError{
+				Msg: "Get{{ .GoName }}ForUpdate: record not found",
+			}
+		} else if !opt.SkipLocked {
+			return nil, &unstable.NotFoundError{
+				Msg: fmt.Sprintf(
+					"List{{ .GoName }}ForUpdate: asked for %d records, found %d",
+					len(ids),
+					len(ret),
+				),
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// Claim{{ .GoName }} locks and returns up to 'limit' {{ .GoName }} records whose
+// fields in 'filterFields' match 'filter', skipping over any records which are
+// already locked by another transaction. This makes it easy for several workers
+// to pull jobs off of the same table without stepping on each other's toes.
+// The records are claimed in primary key order and stay locked until the end
+// of the transaction. Claim{{ .GoName }} always skips locked records, so passing
+// pggen.LockNoWait is an error.
+func (tx *TxPGClient) Claim{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	limit int,
+	opts ...pggen.LockOpt,
+) ([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
+	return tx.impl.claim{{ .GoName }}(ctx, filter, filterFields, limit, opts...)
+}
+func (p *pgClientImpl) claim{{ .GoName }}(
+	ctx context.Context,
+	filter {{ .GoName }},
+	filterFields pggen.FieldSet,
+	limit int,
+	opts ...pggen.LockOpt,
+) ([]{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}, error) {
+	opt := pggen.LockOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	opt.SkipLocked = true
+	lockClause, err := genLockClause(opt)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		return []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}, nil
+	}
+
+	conds, args := filterConds{{ .GoName }}(filter, filterFields, false /* includeDeleted */)
+	query := ` + "`" + `SELECT {{ range $i, $col := .Meta.Info.Cols }}{{ if $i }},{{ end }}"{{ $col.PgName }}"{{ end }} FROM {{ .PgName }}` + "`" + `
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(` + "`" + ` ORDER BY "{{ .PkeyCol.PgName }}" LIMIT $%d` + "`" + `, len(args)) + lockClause
+
+	rows, err := p.queryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := []{{- if .Meta.Config.BoxResults }}*{{- end }}{{ .GoName }}{}
+	for rows.Next() {
+		var value {{ .GoName }}
+		err = value.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, {{- if .Meta.Config.BoxResults }}&{{- end }}value)
+	}
+
+	return ret, rows.Err()
+}
+
+// Insert a {{ .GoName }} into the database. Returns the primary
+// key of the inserted row.
+func (p *PGClient) Insert{{ .GoName }}(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
+	return p.impl.insert{{ .GoName }}(ctx, value, opts...)
+}
+// Insert a {{ .GoName }} into the database. Returns the primary
+// key of the inserted row.
+func (tx *TxPGClient) Insert{{ .GoName }}(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
+	return tx.impl.insert{{ .GoName }}(ctx, value, opts...)
+}
+// Insert a {{ .GoName }} into the database. Returns the primary
+// key of the inserted row.
+func (conn *ConnPGClient) Insert{{ .GoName }}(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
+	return conn.impl.insert{{ .GoName }}(ctx, value, opts...)
+}
+// Insert a {{ .GoName }} into the database. Returns the primary
+// key of the inserted row.
+func (p *pgClientImpl) insert{{ .GoName }}(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) (ret {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
+	var rets []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}
+	rets, err = p.bulkInsert{{ .GoName }}(ctx, []{{ .GoName }}{value}, opts...)
+	if err != nil {
+		return ret, err
+	}
+
+	if len(rets) != 1 {
+		return ret, fmt.Errorf("inserting a {{ .GoName }}: %d rows (expected 1)", len(rets))
+	}
+
+	ret = rets[0]
+	return
+}
+
+// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
+// the inserted rows.
+func (p *PGClient) BulkInsert{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return p.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+}
+// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
+// the inserted rows.
+func (tx *TxPGClient) BulkInsert{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return tx.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+}
+// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
+// the inserted rows.
+func (conn *ConnPGClient) BulkInsert{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return conn.impl.bulkInsert{{ .GoName }}(ctx, values, opts...)
+}
+// Insert a list of {{ .GoName }}. Returns a list of the primary keys of
+// the inserted rows.
+func (p *pgClientImpl) bulkInsert{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	opts ...pggen.InsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	if len(values) == 0 {
+		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+	}
+
+	opt := pggen.InsertOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	
+	rets := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+
+	batches := batcher.Batch(values, BatchSize)
+	for _, batch := range batches {
+		batchRet, err := p.bulkInsertBatch{{ .GoName }}(ctx, batch, opt)
+		if err != nil {
+			return nil, err
+		}
+		rets = append(rets, batchRet...)
+	}
+
+	return rets, nil
+}
+func (p *pgClientImpl) bulkInsertBatch{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	opt pggen.InsertOptions,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	if len(values) == 0 {
+		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+	}
+
+	{{- if (or .Meta.HasCreatedAtField .Meta.HasUpdatedAtField) }}
+	if !opt.DisableTimestamps {
+		now := time.Now()
+
+		{{- if .Meta.HasCreatedAtField }}
+		for i := range values {
+			{{- if .Meta.CreatedAtHasTimezone }}
+			createdAt := now
+			{{- else }}
+			createdAt := now.UTC()
+			{{- end }}
+	
+			{{- if .Meta.HasCreatedAtField }}
+			{{- if .Meta.CreatedAtFieldIsNullable }}
+			values[i].{{ .Meta.GoCreatedAtField }} = &createdAt
+			{{- else }}
+			values[i].{{ .Meta.GoCreatedAtField }} = createdAt
+			{{- end }}
+			{{- end }}
+		}
+		{{- end }}
+	
+		{{- if .Meta.HasUpdatedAtField }}
+		for i := range values {
+			{{- if .Meta.UpdatedAtHasTimezone }}
+			updatedAt := now
+			{{- else }}
+			updatedAt := now.UTC()
+			{{- end }}
+	
+			{{- if .Meta.HasUpdatedAtField }}
+			{{- if .Meta.UpdatedAtFieldIsNullable }}
+			values[i].{{ .Meta.GoUpdatedAtField }} = &updatedAt
+			{{- else }}
+			values[i].{{ .Meta.GoUpdatedAtField }} = updatedAt
+			{{- end }}
+			{{- end }}
+		}
+		{{- end }}
+	}
+	{{- end }}
+
+	defaultFields := opt.DefaultFields.Intersection(defaultableColsFor{{ .GoName }})
+	args := make([]interface{}, 0, {{ len .Meta.Info.Cols }} * len(values))
+	for _, v := range values {
+		{{- range .Meta.Info.Cols }}
+		{{- if (not .IsPrimary) }}
+		{{- if .Nullable }}
+		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
+			args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "v.%s" .GoName) }})
+		}
+		{{- else }}
+		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
+			args = append(args, {{ call .TypeInfo.SqlArgument (printf "v.%s" .GoName) }})
+		}
+		{{- end }}
+		{{- else }}
+		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
+			{{- if .Nullable }}
+			args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "v.%s" .GoName) }})
+			{{- else }}
+			args = append(args, {{ call .TypeInfo.SqlArgument (printf "v.%s" .GoName) }})
+			{{- end }}
+		}
+		{{- end }}
+		{{- end }}
+	}
+
+	bulkInsertQuery := genBulkInsertStmt(
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		fieldsFor{{ .GoName }},
+		len(values),
+		"{{ .PkeyCol.PgName }}",
+		true,
+		defaultFields,
+	)
+
+	rows, err := p.queryContext(ctx, bulkInsertQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rets := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	for rows.Next() {
+		var ret {{ .GoName }}
+		err = ret.Scan(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -435,6 +1019,23 @@ const (
 	{{- end }}
 	{{ $.GoName }}MaxFieldIndex int = ({{ len .Meta.Info.Cols }} - 1)
 )
+{{- range .Meta.Info.Cols }}
+
+// {{ $.GoName }}{{ .GoName }}Equals returns a predicate for conditional updates and
+// deletes of {{ $.GoName }} records which holds when {{ .PgName }} is 'v'.
+{{- if .Nullable }} A nil 'v' matches NULL.{{ end }}
+func {{ $.GoName }}{{ .GoName }}Equals(v {{ if .Nullable }}{{ .TypeInfo.NullName }}{{ else }}{{ .TypeInfo.Name }}{{ end }}) pggen.Predicate {
+	return pggen.Predicate{
+		Table:      ` + "`" + `{{ $.PgName }}` + "`" + `,
+		FieldIndex: {{ $.GoName }}{{ .GoName }}FieldIndex,
+		{{- if .Nullable }}
+		Value:      {{ call .TypeInfo.NullSqlArgument "v" }},
+		{{- else }}
+		Value:      {{ call .TypeInfo.SqlArgument "v" }},
+		{{- end }}
+	}
+}
+{{- end }}
 
 // A field set saying that all fields in {{ .GoName }} should be updated.
 // For use as a 'fieldMask' parameter
@@ -459,11 +1060,43 @@ var defaultableColsFor{{ .GoName }} = func() pggen.FieldSet {
 	return fs
 }()
 
-var fieldsFor{{ .GoName }} []fieldNameAndIdx = []fieldNameAndIdx{
-	{{- range .Meta.Info.Cols }}
-	{ name: ` + "`" + `{{ .PgName }}` + "`" + `, idx: {{ $.GoName }}{{ .GoName }}FieldIndex },
-	{{- end }}
+var fieldsFor{{ .GoName }} []fieldNameAndIdx = []fieldNameAndIdx{
+	{{- range .Meta.Info.Cols }}
+	{ name: ` + "`" + `{{ .PgName }}` + "`" + `, idx: {{ $.GoName }}{{ .GoName }}FieldIndex, pgType: ` + "`" + `{{ .PgType }}` + "`" + ` },
+	{{- end }}
+}
+
+// {{ .GoName }}ConflictTarget is a unique index or constraint on {{ .PgName }}
+// that upserts can use to detect conflicting records. Pass one of the
+// {{ .GoName }}ConflictOn values to pggen.UpsertConflictTarget.
+type {{ .GoName }}ConflictTarget struct {
+	sql string
+	// the indexed columns, used to find the existing records that an upsert
+	// conflicted with, or nil for partial and expression indexes
+	cols []string
+}
+
+func (t {{ .GoName }}ConflictTarget) ConflictTable() string {
+	return {{ printf "%q" .PgName }}
+}
+
+func (t {{ .GoName }}ConflictTarget) ConflictTargetSQL() string {
+	return t.sql
 }
+{{- if .Meta.ConflictTargets }}
+
+var (
+	{{- range .Meta.ConflictTargets }}
+	// Conflict on {{ .PgName }}
+	{{ $.GoName }}Conflict{{ .GoName }} = {{ $.GoName }}ConflictTarget{
+		sql: {{ printf "%q" .SQL }},
+		{{- if .PgCols }}
+		cols: []string{ {{- range $i, $col := .PgCols }}{{ if $i }}, {{ end }}{{ printf "%q" $col }}{{ end -}} },
+		{{- end }}
+	}
+	{{- end }}
+)
+{{- end }}
 
 // Update a {{ .GoName }}. 'value' must at the least have
 // a primary key set. The 'fieldMask' field set indicates which fields
@@ -537,13 +1170,11 @@ func (p *pgClientImpl) update{{ .GoName }}(
 	}
 	{{- end }}
 
-	updateStmt := genUpdateStmt(
-		` + "`" + `{{ .PgName }}` + "`" + `,
-		"{{ .PkeyCol.PgName }}",
-		fieldsFor{{ .GoName }},
-		fieldMask,
-		"{{ .PkeyCol.PgName }}",
-	)
+	{{- if .Meta.HasVersionField }}
+
+	// the version is checked against the database and bumped rather than written
+	fieldMask = fieldMask.Clone().Set({{ .GoName }}{{ .Meta.GoVersionField }}FieldIndex, false)
+	{{- end }}
 
 	args := make([]interface{}, 0, {{ len .Meta.Info.Cols }})
 
@@ -559,13 +1190,53 @@ func (p *pgClientImpl) update{{ .GoName }}(
 
 	// add the primary key arg for the WHERE condition
 	args = append(args, value.{{ .PkeyCol.GoName }})
+	{{- if .Meta.HasVersionField }}
+	args = append(args, value.{{ .Meta.GoVersionField }})
+	{{- end }}
+
+	predicates, predicateArgs, err := genPredicates(
+		opt.Where,
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		fieldsFor{{ .GoName }},
+		len(args),
+	)
+	if err != nil {
+		return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, err
+	}
+	args = append(args, predicateArgs...)
+
+	updateStmt := genUpdateStmt(
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		"{{ .PkeyCol.PgName }}",
+		fieldsFor{{ .GoName }},
+		fieldMask,
+		"{{ .Meta.PgVersionField }}",
+		predicates,
+	)
 
 	rows, err := p.db.QueryContext(ctx, updateStmt, args...)
 	if err != nil {
 		return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, err
 	}
 	defer rows.Close()
-	rows.Next()
+	if !rows.Next() {
+		err = rows.Err()
+		if err != nil {
+			return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, err
+		}
+		if len(opt.Where) > 0 {
+			return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, &unstable.NotFoundError{
+				Msg: "Update{{ .GoName }}: no record matched the update predicates",
+			}
+		}
+		{{- if .Meta.HasVersionField }}
+		return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, &pggen.ConcurrentModificationError{
+			Table:   ` + "`" + `{{ .PgName }}` + "`" + `,
+			ID:      value.{{ .PkeyCol.GoName }},
+			Version: int64(value.{{ .Meta.GoVersionField }}),
+		}
+		{{- end }}
+	}
 	
 	err = ret.Scan(rows)
 	if err != nil {
@@ -575,6 +1246,189 @@ func (p *pgClientImpl) update{{ .GoName }}(
 	return {{ if .Meta.Config.BoxResults }}&{{ end }}ret, nil
 }
 
+// BulkUpdate{{ .GoName }} updates a list of {{ .GoName }} records in a single
+// statement per batch. Every value must have its primary key set, and the
+// 'fieldMask' field set indicates which fields should be updated for all of
+// them. Returns an unordered list of the updated records.
+func (p *PGClient) BulkUpdate{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpdateOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return p.impl.bulkUpdate{{ .GoName }}(ctx, values, fieldMask, opts...)
+}
+func (tx *TxPGClient) BulkUpdate{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpdateOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return tx.impl.bulkUpdate{{ .GoName }}(ctx, values, fieldMask, opts...)
+}
+func (conn *ConnPGClient) BulkUpdate{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpdateOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	return conn.impl.bulkUpdate{{ .GoName }}(ctx, values, fieldMask, opts...)
+}
+func (p *pgClientImpl) bulkUpdate{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpdateOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	if len(values) == 0 {
+		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+	}
+
+	opt := pggen.UpdateOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if len(opt.Where) > 0 {
+		return nil, fmt.Errorf("BulkUpdate{{ .GoName }}: update predicates are not supported for bulk updates")
+	}
+
+	// a record can only be updated once by a statement, so repeats would come
+	// back as missing records
+	seen := make(map[{{ .PkeyCol.TypeInfo.Name }}]bool, len(values))
+	for _, v := range values {
+		if seen[v.{{ .PkeyCol.GoName }}] {
+			return nil, fmt.Errorf(
+				"BulkUpdate{{ .GoName }}: record with primary key %v given more than once",
+				v.{{ .PkeyCol.GoName }},
+			)
+		}
+		seen[v.{{ .PkeyCol.GoName }}] = true
+	}
+
+	// the primary key identifies the records to update rather than being written
+	fieldMask = fieldMask.Clone().Set({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex, false)
+	{{- if .Meta.HasVersionField }}
+	// the version is checked against the database and bumped rather than written
+	fieldMask.Set({{ .GoName }}{{ .Meta.GoVersionField }}FieldIndex, false)
+	{{- end }}
+
+	{{- if .Meta.HasUpdatedAtField }}
+	if !opt.DisableTimestamps {
+		{{- if .Meta.UpdatedAtHasTimezone }}
+		now := time.Now()
+		{{- else }}
+		now := time.Now().UTC()
+		{{- end }}
+		for i := range values {
+			{{- if .Meta.UpdatedAtFieldIsNullable }}
+			values[i].{{ .Meta.GoUpdatedAtField }} = &now
+			{{- else }}
+			values[i].{{ .Meta.GoUpdatedAtField }} = now
+			{{- end }}
+		}
+		fieldMask.Set({{ .GoName }}{{ .Meta.GoUpdatedAtField }}FieldIndex, true)
+	}
+	{{- end }}
+
+	{{- if not .Meta.HasVersionField }}
+	if fieldMask.CountSetBits() == 0 {
+		return nil, fmt.Errorf("BulkUpdate{{ .GoName }}: no fields to update")
+	}
+	{{- end }}
+
+	ret := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	batches := batcher.Batch(values, BatchSize)
+	for _, batch := range batches {
+		batchRet, err := p.bulkUpdateBatch{{ .GoName }}(ctx, batch, fieldMask)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, batchRet...)
+	}
+
+	return ret, nil
+}
+func (p *pgClientImpl) bulkUpdateBatch{{ .GoName }}(
+	ctx context.Context,
+	values []{{ .GoName }},
+	fieldMask pggen.FieldSet,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	stmt := genBulkUpdateStmt(
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		fieldsFor{{ .GoName }}[{{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex],
+		fieldsFor{{ .GoName }},
+		fieldMask,
+		len(values),
+		"{{ .Meta.PgVersionField }}",
+	)
+
+	args := make([]interface{}, 0, (fieldMask.CountSetBits() + 2) * len(values))
+	for _, v := range values {
+		args = append(args, v.{{ .PkeyCol.GoName }})
+		{{- range .Meta.Info.Cols }}
+		if fieldMask.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
+			{{- if .Nullable }}
+			args = append(args, {{ call .TypeInfo.NullSqlArgument (printf "v.%s" .GoName) }})
+			{{- else }}
+			args = append(args, {{ call .TypeInfo.SqlArgument (printf "v.%s" .GoName) }})
+			{{- end }}
+		}
+		{{- end }}
+		{{- if .Meta.HasVersionField }}
+		args = append(args, v.{{ .Meta.GoVersionField }})
+		{{- end }}
+	}
+
+	rows, err := p.queryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	for rows.Next() {
+		var value {{ .GoName }}
+		err = value.Scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, {{ if .Meta.Config.BoxResults }}&{{ end }}value)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) != len(values) {
+		// report the first record that didn't come back
+		updated := make(map[{{ .PkeyCol.TypeInfo.Name }}]bool, len(ret))
+		for _, r := range ret {
+			updated[r.{{ .PkeyCol.GoName }}] = true
+		}
+		for _, v := range values {
+			if updated[v.{{ .PkeyCol.GoName }}] {
+				continue
+			}
+			{{- if .Meta.HasVersionField }}
+			return nil, &pggen.ConcurrentModificationError{
+				Table:   ` + "`" + `{{ .PgName }}` + "`" + `,
+				ID:      v.{{ .PkeyCol.GoName }},
+				Version: int64(v.{{ .Meta.GoVersionField }}),
+			}
+			{{- else }}
+			return nil, &unstable.NotFoundError{
+				Msg: fmt.Sprintf(
+					"BulkUpdate{{ .GoName }}: no record with primary key %v",
+					v.{{ .PkeyCol.GoName }},
+				),
+			}
+			{{- end }}
+		}
+	}
+
+	return ret, nil
+}
+
 // Upsert a {{ .GoName }} value. If the given value conflicts with
 // an existing row in the database, use the provided value to update that row
 // rather than inserting it. Only the fields specified by 'fieldMask' are
@@ -685,6 +1539,86 @@ func (conn *ConnPGClient) BulkUpsert{{ .GoName }}(
 ) (ret []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, err error) {
 	return conn.impl.bulkUpsert{{ .GoName }}(ctx, values, constraintNames, fieldMask, opts...)
 }
+// Upsert{{ .GoName }}WithOutcome behaves exactly like Upsert{{ .GoName }}, but it
+// also reports whether the record was inserted, updated or left unchanged.
+func (p *PGClient) Upsert{{ .GoName }}WithOutcome(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ({{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, pggen.UpsertOutcome, error) {
+	return p.impl.upsert{{ .GoName }}WithOutcome(ctx, value, constraintNames, fieldMask, opts...)
+}
+func (tx *TxPGClient) Upsert{{ .GoName }}WithOutcome(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ({{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, pggen.UpsertOutcome, error) {
+	return tx.impl.upsert{{ .GoName }}WithOutcome(ctx, value, constraintNames, fieldMask, opts...)
+}
+func (conn *ConnPGClient) Upsert{{ .GoName }}WithOutcome(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ({{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, pggen.UpsertOutcome, error) {
+	return conn.impl.upsert{{ .GoName }}WithOutcome(ctx, value, constraintNames, fieldMask, opts...)
+}
+func (p *pgClientImpl) upsert{{ .GoName }}WithOutcome(
+	ctx context.Context,
+	value {{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ({{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, pggen.UpsertOutcome, error) {
+	vals, outcomes, err := p.bulkUpsert{{ .GoName }}WithOutcomes(ctx, []{{ .GoName }}{ {{- if .Meta.Config.BoxResults }}*{{ end }}value}, constraintNames, fieldMask, opts...)
+	if err != nil {
+		return {{ if .Meta.Config.BoxResults }}nil{{ else }}{{ .GoName }}{}{{ end }}, 0, err
+	}
+
+	if len(vals) == 1 {
+		return vals[0], outcomes[0], nil
+	}
+
+	// only possible if no upsert fields were specified by the field mask and
+	// the conflicting record could not be looked up
+	return {{ if .Meta.Config.BoxResults }}nil{{ else }}{{ .GoName }}{}{{ end }}, pggen.UpsertUnchanged, nil
+}
+
+// BulkUpsert{{ .GoName }}WithOutcomes behaves exactly like BulkUpsert{{ .GoName }}, but it
+// also returns a slice parallel to the returned records saying whether each one
+// was inserted, updated or left unchanged.
+func (p *PGClient) BulkUpsert{{ .GoName }}WithOutcomes(
+	ctx context.Context,
+	values []{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, []pggen.UpsertOutcome, error) {
+	return p.impl.bulkUpsert{{ .GoName }}WithOutcomes(ctx, values, constraintNames, fieldMask, opts...)
+}
+func (tx *TxPGClient) BulkUpsert{{ .GoName }}WithOutcomes(
+	ctx context.Context,
+	values []{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, []pggen.UpsertOutcome, error) {
+	return tx.impl.bulkUpsert{{ .GoName }}WithOutcomes(ctx, values, constraintNames, fieldMask, opts...)
+}
+func (conn *ConnPGClient) BulkUpsert{{ .GoName }}WithOutcomes(
+	ctx context.Context,
+	values []{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, []pggen.UpsertOutcome, error) {
+	return conn.impl.bulkUpsert{{ .GoName }}WithOutcomes(ctx, values, constraintNames, fieldMask, opts...)
+}
 func (p *pgClientImpl) bulkUpsert{{ .GoName }}(
 	ctx context.Context,
 	values []{{ .GoName }},
@@ -692,8 +1626,18 @@ func (p *pgClientImpl) bulkUpsert{{ .GoName }}(
 	fieldMask pggen.FieldSet,
 	opts ...pggen.UpsertOpt,
 ) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+	vals, _, err := p.bulkUpsert{{ .GoName }}WithOutcomes(ctx, values, constraintNames, fieldMask, opts...)
+	return vals, err
+}
+func (p *pgClientImpl) bulkUpsert{{ .GoName }}WithOutcomes(
+	ctx context.Context,
+	values []{{ .GoName }},
+	constraintNames []string,
+	fieldMask pggen.FieldSet,
+	opts ...pggen.UpsertOpt,
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, []pggen.UpsertOutcome, error) {
 	if len(values) == 0 {
-		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, []pggen.UpsertOutcome{}, nil
 	}
 
 	options := pggen.UpsertOptions{}
@@ -701,30 +1645,55 @@ func (p *pgClientImpl) bulkUpsert{{ .GoName }}(
 		opt(&options)
 	}
 
-	if constraintNames == nil || len(constraintNames) == 0 {
-		constraintNames = []string{` + "`" + `{{ .PkeyCol.PgName }}` + "`" + `}
+	var (
+		conflictTarget string
+		conflictCols   []string
+	)
+	if options.ConflictTarget != nil {
+		if len(constraintNames) > 0 {
+			return nil, nil, fmt.Errorf("{{ .GoName }}: pass either constraint names or a conflict target, not both")
+		}
+		if options.ConflictTarget.ConflictTable() != {{ printf "%q" .PgName }} {
+			return nil, nil, fmt.Errorf(
+				"{{ .GoName }}: conflict target for table '%s' used in an upsert into {{ .PgName }}",
+				options.ConflictTarget.ConflictTable(),
+			)
+		}
+		conflictTarget = options.ConflictTarget.ConflictTargetSQL()
+		if target, ok := options.ConflictTarget.({{ .GoName }}ConflictTarget); ok {
+			conflictCols = target.cols
+		}
+	} else {
+		if len(constraintNames) == 0 {
+			constraintNames = []string{` + "`" + `{{ .PkeyCol.PgName }}` + "`" + `}
+		}
+		conflictTarget = "(" + strings.Join(constraintNames, ",") + ")"
+		conflictCols = constraintNames
 	}
 
 	vals := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	outcomes := make([]pggen.UpsertOutcome, 0, len(values))
 	batches := batcher.Batch(values, BatchSize)
 	for _, batch := range batches {
-		batchVals, err := p.bulkUpsertBatch{{ .GoName }}(ctx, batch, constraintNames, fieldMask, options)
+		batchVals, batchOutcomes, err := p.bulkUpsertBatch{{ .GoName }}(ctx, batch, conflictTarget, conflictCols, fieldMask, options)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		vals = append(vals, batchVals...)
+		outcomes = append(outcomes, batchOutcomes...)
 	}
-	return vals, nil
+	return vals, outcomes, nil
 }
 func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 	ctx context.Context,
 	values []{{ .GoName }},
-	constraintNames []string,
+	conflictTarget string,
+	conflictCols []string,
 	fieldMask pggen.FieldSet,
 	opt pggen.UpsertOptions,
-) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, error) {
+) ([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, []pggen.UpsertOutcome, error) {
 	if len(values) == 0 {
-		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, nil
+		return []{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}{}, []pggen.UpsertOutcome{}, nil
 	}
 
 	{{ if (or .Meta.HasCreatedAtField .Meta.HasUpdatedAtField) }}
@@ -765,7 +1734,15 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 	{{- end }}
 
 	defaultFields := opt.DefaultFields.Intersection(defaultableColsFor{{ .GoName }})
+	setBits := fieldMask.CountSetBits()
+	hasConflictAction := setBits > 1 ||
+		(setBits == 1 && fieldMask.Test({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex)) ||
+		(setBits == 1 && !fieldMask.Test({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex))
+
 	var stmt strings.Builder
+	if !hasConflictAction {
+		stmt.WriteString("WITH pggen_new AS (")
+	}
 	genInsertCommon(
 		&stmt,
 		` + "`" + `{{ .PgName }}` + "`" + `,
@@ -776,15 +1753,10 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 		defaultFields,
 	)
 
-	setBits := fieldMask.CountSetBits()
-	hasConflictAction := setBits > 1 ||
-		(setBits == 1 && fieldMask.Test({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex)) ||
-		(setBits == 1 && !fieldMask.Test({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex))
-
 	if hasConflictAction {
-		stmt.WriteString("ON CONFLICT (")
-		stmt.WriteString(strings.Join(constraintNames, ","))
-		stmt.WriteString(") DO UPDATE SET ")
+		stmt.WriteString("ON CONFLICT ")
+		stmt.WriteString(conflictTarget)
+		stmt.WriteString(" DO UPDATE SET ")
 
 		updateCols := make([]string, 0, {{ len .Meta.Info.Cols }})
 		updateExprs := make([]string, 0, {{ len .Meta.Info.Cols }})
@@ -792,12 +1764,19 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 		updateExprs = append(updateExprs, ` + "`" + `excluded.{{ .PkeyCol.PgName }}` + "`" + `)
 		{{- range $i, $col := .Meta.Info.Cols }}
 		{{- if (not (eq $i $.PkeyColIdx)) }}
+		{{- if (not (and $.Meta.HasVersionField (eq $col.PgName $.Meta.PgVersionField))) }}
 		if fieldMask.Test({{ $.GoName }}{{ $col.GoName }}FieldIndex) {
 			updateCols = append(updateCols, ` + "`" + `{{ $col.PgName }}` + "`" + `)
 			updateExprs = append(updateExprs, ` + "`" + `excluded.{{ $col.PgName }}` + "`" + `)
 		}
 		{{- end }}
 		{{- end }}
+		{{- end }}
+		{{- if .Meta.HasVersionField }}
+		// the version is checked against the database and bumped rather than written
+		updateCols = append(updateCols, ` + "`" + `{{ .Meta.PgVersionField }}` + "`" + `)
+		updateExprs = append(updateExprs, ` + "`" + `{{ .PgName }}.{{ .Meta.PgVersionField }} + 1` + "`" + `)
+		{{- end }}
 		if len(updateCols) > 1 {
 			stmt.WriteRune('(')
 		}
@@ -813,12 +1792,26 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 		if len(updateCols) > 1 {
 			stmt.WriteRune(')')
 		}
+		{{- if .Meta.HasVersionField }}
+		stmt.WriteString(` + "`" + ` WHERE {{ .PgName }}.{{ .Meta.PgVersionField }} = excluded.{{ .Meta.PgVersionField }}` + "`" + `)
+		{{- end }}
+
+		// xmax is only zero for freshly inserted rows
+		stmt.WriteString(` + "`" + ` RETURNING {{ range $i, $col := .Meta.Info.Cols }}{{ if $i }}, {{ end }}"{{ $col.PgName }}"{{ end }}, (xmax = 0) AS pggen_inserted` + "`" + `)
 	} else {
-		stmt.WriteString("ON CONFLICT DO NOTHING")
+		// Records which conflict are left alone, and the existing records
+		// are selected separately since DO NOTHING doesn't return them.
+		genSkipConflicts(
+			&stmt,
+			` + "`" + `{{ .PgName }}` + "`" + `,
+			fieldsFor{{ .GoName }},
+			len(values),
+			defaultFields,
+			conflictTarget,
+			conflictCols,
+		)
 	}
 
-	stmt.WriteString(` + "`" + ` RETURNING *` + "`" + `)
-
 	args := make([]interface{}, 0, {{ len .Meta.Info.Cols }} * len(values))
 	for _, v := range values {
 		{{- range $i, $col := .Meta.Info.Cols }}
@@ -827,12 +1820,12 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 			{{- if .Nullable }}
 			err := {{ call $col.TypeInfo.NullableCustomValidator (printf "v.%s" $col.GoName) $col.TableName $col.PgName }}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			args = append(args, {{ call $col.TypeInfo.NullSqlArgument (printf "v.%s" $col.GoName) }})
 			{{- else }}
 			if err := {{ call $col.TypeInfo.CustomValidator (printf "v.%s" $col.GoName) $col.TableName $col.PgName }}; err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			args = append(args, {{ call $col.TypeInfo.SqlArgument (printf "v.%s" $col.GoName) }})
 			{{- end }}
@@ -842,14 +1835,14 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
 			err := {{ call $col.TypeInfo.NullableCustomValidator (printf "v.%s" $col.GoName) $col.TableName $col.PgName }}
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			args = append(args, {{ call $col.TypeInfo.NullSqlArgument (printf "v.%s" $col.GoName) }})
 		}
 		{{- else }}
 		if !defaultFields.Test({{ $.GoName }}{{ .GoName }}FieldIndex) {
 			if err := {{ call $col.TypeInfo.CustomValidator (printf "v.%s" $col.GoName) $col.TableName $col.PgName }}; err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			args = append(args, {{ call $col.TypeInfo.SqlArgument (printf "v.%s" $col.GoName) }})
 		}
@@ -860,29 +1853,78 @@ func (p *pgClientImpl) bulkUpsertBatch{{ .GoName }}(
 
 	rows, err := p.queryContext(ctx, stmt.String(), args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	vals := make([]{{ if .Meta.Config.BoxResults }}*{{ end }}{{ .GoName }}, 0, len(values))
+	outcomes := make([]pggen.UpsertOutcome, 0, len(values))
 	for rows.Next() {
-		var val {{ .GoName }}
-		err = val.Scan(rows)
+		var (
+			val          {{ .GoName }}
+			nullableTgts nullableScanTgtsFor{{ .GoName }}
+			inserted     bool
+		)
+		scanTgts := make([]interface{}, 0, len(scannerTabFor{{ .GoName }})+1)
+		for _, scanner := range scannerTabFor{{ .GoName }} {
+			scanTgts = append(scanTgts, scanner(&val, &nullableTgts))
+		}
+		scanTgts = append(scanTgts, &inserted)
+		err = rows.Scan(scanTgts...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		val.fillFromNullableTgts(&nullableTgts)
 		vals = append(vals, {{ if .Meta.Config.BoxResults }}&{{ end }}val)
+
+		switch {
+		case inserted:
+			outcomes = append(outcomes, pggen.UpsertInserted)
+		case hasConflictAction:
+			outcomes = append(outcomes, pggen.UpsertUpdated)
+		default:
+			outcomes = append(outcomes, pggen.UpsertUnchanged)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if len(vals) != len(values) {
-		return nil, fmt.Errorf(
+	// With DO NOTHING, values which conflict with each other or with existing
+	// records that can't be matched against the conflict target are skipped.
+	if hasConflictAction && len(vals) != len(values) {
+		{{- if .Meta.HasVersionField }}
+		// Rows only go missing when the version check fails. We can only tell
+		// which record that was if the primary keys were given.
+		if !defaultFields.Test({{ .GoName }}{{ .PkeyCol.GoName }}FieldIndex) {
+			upserted := make(map[{{ .PkeyCol.TypeInfo.Name }}]bool, len(vals))
+			for _, v := range vals {
+				upserted[v.{{ .PkeyCol.GoName }}] = true
+			}
+			for _, v := range values {
+				if !upserted[v.{{ .PkeyCol.GoName }}] {
+					return nil, nil, &pggen.ConcurrentModificationError{
+						Table:   ` + "`" + `{{ .PgName }}` + "`" + `,
+						ID:      v.{{ .PkeyCol.GoName }},
+						Version: int64(v.{{ .Meta.GoVersionField }}),
+					}
+				}
+			}
+		}
+		return nil, nil, &pggen.ConcurrentModificationError{
+			Table: ` + "`" + `{{ .PgName }}` + "`" + `,
+		}
+		{{- else }}
+		return nil, nil, fmt.Errorf(
 			"BulkUpsert{{ .GoName }}: %d rows inserted, expected %d",
 			len(vals),
 			len(values),
 		)
+		{{- end }}
 	}
 
-	return vals, nil
+	return vals, outcomes, nil
 }
 
 func (p *PGClient) Delete{{ .GoName }}(
@@ -968,30 +2010,133 @@ func (p *pgClientImpl) bulkDeleteBatch{{ .GoName }}(
 	now := time.Now().UTC()
 	{{- end }}
 	var (
-		res sql.Result
-		err error
+		stmt string
+		args []interface{}
 	)
-	if options.DoHardDelete {
-		res, err = p.db.ExecContext(
-			ctx,
-			` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `,
-			pgtypes.Array(ids),
-		)
+	if opt.DoHardDelete {
+		stmt = ` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `
+		args = []interface{}{pgtypes.Array(ids)}
 	} else {
-		res, err = p.db.ExecContext(
-			ctx,
-			` + "`" + `UPDATE {{ .PgName }} SET "{{ .Meta.PgDeletedAtField }}" = $1 WHERE "{{ .PkeyCol.PgName }}" = ANY($2)` + "`" + `,
-			now,
-			pgtypes.Array(ids),
-		)
+		stmt = ` + "`" + `UPDATE {{ .PgName }} SET "{{ .Meta.PgDeletedAtField }}" = $1 WHERE "{{ .PkeyCol.PgName }}" = ANY($2)` + "`" + `
+		args = []interface{}{now, pgtypes.Array(ids)}
 	}
 	{{- else }}
+	stmt := ` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `
+	args := []interface{}{pgtypes.Array(ids)}
+	{{- end }}
+
+	predicates, predicateArgs, err := genPredicates(
+		opt.Where,
+		` + "`" + `{{ .PgName }}` + "`" + `,
+		fieldsFor{{ .GoName }},
+		len(args),
+	)
+	if err != nil {
+		return err
+	}
+	stmt += predicates
+	args = append(args, predicateArgs...)
+
+	res, err := p.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	nrows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if nrows != int64(len(ids)) && len(opt.Where) > 0 {
+		return &unstable.NotFoundError{
+			Msg: fmt.Sprintf(
+				"BulkDelete{{ .GoName }}: %d rows matched the delete predicates, expected %d",
+				nrows,
+				len(ids),
+			),
+		}
+	}
+
+	if nrows != int64(len(ids)) {
+		return fmt.Errorf(
+			"BulkDelete{{ .GoName }}: %d rows deleted, expected %d",
+			nrows,
+			len(ids),
+		)
+	}
+
+	return err
+}
+{{- if .Meta.HasDeletedAtField }}
+
+// Restore{{ .GoName }} undoes a soft delete of the {{ .GoName }} with the given id.
+// Restoring a record which has not been deleted has no effect.
+func (p *PGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return p.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+func (tx *TxPGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return tx.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+func (conn *ConnPGClient) Restore{{ .GoName }}(
+	ctx context.Context,
+	id {{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return conn.impl.bulkRestore{{ .GoName }}(ctx, []{{ .PkeyCol.TypeInfo.Name }}{id})
+}
+
+// BulkRestore{{ .GoName }} undoes the soft deletes of the {{ .GoName }} records
+// with the given ids.
+func (p *PGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return p.impl.bulkRestore{{ .GoName }}(ctx, ids)
+}
+func (tx *TxPGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return tx.impl.bulkRestore{{ .GoName }}(ctx, ids)
+}
+func (conn *ConnPGClient) BulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	return conn.impl.bulkRestore{{ .GoName }}(ctx, ids)
+}
+func (p *pgClientImpl) bulkRestore{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	batches := batcher.Batch(ids, BatchSize)
+	for _, batch := range batches {
+		err := p.bulkRestoreBatch{{ .GoName }}(ctx, batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+func (p *pgClientImpl) bulkRestoreBatch{{ .GoName }}(
+	ctx context.Context,
+	ids []{{ .PkeyCol.TypeInfo.Name }},
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
 	res, err := p.db.ExecContext(
 		ctx,
-		` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `,
+		` + "`" + `UPDATE {{ .PgName }} SET "{{ .Meta.PgDeletedAtField }}" = NULL WHERE "{{ .PkeyCol.PgName }}" = ANY($1)` + "`" + `,
 		pgtypes.Array(ids),
 	)
-	{{- end }}
 	if err != nil {
 		return err
 	}
@@ -1003,17 +2148,560 @@ func (p *pgClientImpl) bulkDeleteBatch{{ .GoName }}(
 
 	if nrows != int64(len(ids)) {
 		return fmt.Errorf(
-			"BulkDelete{{ .GoName }}: %d rows deleted, expected %d",
+			"BulkRestore{{ .GoName }}: %d rows restored, expected %d",
 			nrows,
 			len(ids),
 		)
 	}
 
-	return err
+	return nil
+}
+
+// Purge{{ .GoName }}DeletedBefore permanently removes every {{ .GoName }} which
+// was soft deleted before the given time. Returns the number of records removed.
+func (p *PGClient) Purge{{ .GoName }}DeletedBefore(
+	ctx context.Context,
+	t time.Time,
+) (int64, error) {
+	return p.impl.purge{{ .GoName }}DeletedBefore(ctx, t)
 }
+func (tx *TxPGClient) Purge{{ .GoName }}DeletedBefore(
+	ctx context.Context,
+	t time.Time,
+) (int64, error) {
+	return tx.impl.purge{{ .GoName }}DeletedBefore(ctx, t)
+}
+func (conn *ConnPGClient) Purge{{ .GoName }}DeletedBefore(
+	ctx context.Context,
+	t time.Time,
+) (int64, error) {
+	return conn.impl.purge{{ .GoName }}DeletedBefore(ctx, t)
+}
+func (p *pgClientImpl) purge{{ .GoName }}DeletedBefore(
+	ctx context.Context,
+	t time.Time,
+) (int64, error) {
+	{{- if not .Meta.DeletedAtHasTimezone }}
+	t = t.UTC()
+	{{- end }}
+	res, err := p.db.ExecContext(
+		ctx,
+		` + "`" + `DELETE FROM {{ .PgName }} WHERE "{{ .Meta.PgDeletedAtField }}" < $1` + "`" + `,
+		t,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+{{- end }}
 
 var {{ .GoName }}AllIncludes *include.Spec = include.Must(include.Parse(
 	` + "`" + `{{ .AllIncludeSpec }}` + "`" + `,
 ))
 
+// {{ .GoName }}IncludeSpec builds include specs for the {{ .PgName }} table. Building specs
+// with its methods rather than parsing them means that naming a relationship which
+// doesn't exist fails to compile instead of panicking at runtime. Each method returns
+// a new builder and leaves its receiver alone, so builders can be shared.
+type {{ .GoName }}IncludeSpec struct {
+	spec *include.Spec
+}
+
+// {{ .GoName }}Includes is the empty include spec for the {{ .PgName }} table, which
+// builders start from, e.g. ` + "`" + `{{ .GoName }}Includes.<Field>(...).Spec()` + "`" + `.
+var {{ .GoName }}Includes {{ .GoName }}IncludeSpec
+
+// Spec returns the include spec that has been built up. It may share sub-specs with
+// other specs built from the same builders, so it should not be modified.
+func (s {{ .GoName }}IncludeSpec) Spec() *include.Spec {
+	if s.spec == nil {
+		return &include.Spec{TableName: {{ printf "%q" .PgName }}}
+	}
+	return s.spec
+}
+
+// WithOrderBy sets the order in which the {{ .PgName }} records are loaded when this spec
+// is used as a sub-spec.
+func (s {{ .GoName }}IncludeSpec) WithOrderBy(order ...include.Order) {{ .GoName }}IncludeSpec {
+	return {{ .GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" .PgName }},
+		OrderBy:   order,
+	})}
+}
+
+// WithLimit sets the maximum number of {{ .PgName }} records loaded for each parent
+// record when this spec is used as a sub-spec.
+func (s {{ .GoName }}IncludeSpec) WithLimit(limit int) {{ .GoName }}IncludeSpec {
+	return {{ .GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" .PgName }},
+		Limit:     limit,
+	})}
+}
+
+// WithWhere sets a SQL condition that the {{ .PgName }} records must satisfy to be loaded
+// when this spec is used as a sub-spec.
+func (s {{ .GoName }}IncludeSpec) WithWhere(where string) {{ .GoName }}IncludeSpec {
+	return {{ .GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" .PgName }},
+		Where:     where,
+	})}
+}
+{{- range .Meta.AllIncomingReferences }}
+
+// {{ .GoPointsFromFieldName }} includes the {{ .PointsFrom.Info.PgName }} records which refer to
+// the {{ $.PgName }} records, along with everything included by 'children'.
+func (s {{ $.GoName }}IncludeSpec) {{ .GoPointsFromFieldName }}(children ...{{ .PointsFrom.Info.GoName }}IncludeSpec) {{ $.GoName }}IncludeSpec {
+	sub := &include.Spec{TableName: {{ printf "%q" .PointsFrom.Info.PgName }}}
+	for _, child := range children {
+		sub = include.Merge(sub, child.Spec())
+	}
+	return {{ $.GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" $.PgName }},
+		Includes:  map[string]*include.Spec{ {{- printf "%q" .PgPointsFromFieldName }}: sub},
+	})}
+}
+{{- end }}
+{{- range .Meta.AllOutgoingReferences }}
+
+// {{ .GoPointsToFieldName }} includes the {{ .PointsTo.Info.PgName }} record that each of the
+// {{ $.PgName }} records refers to, along with everything included by 'children'.
+func (s {{ $.GoName }}IncludeSpec) {{ .GoPointsToFieldName }}(children ...{{ .PointsTo.Info.GoName }}IncludeSpec) {{ $.GoName }}IncludeSpec {
+	sub := &include.Spec{TableName: {{ printf "%q" .PointsTo.Info.PgName }}}
+	for _, child := range children {
+		sub = include.Merge(sub, child.Spec())
+	}
+	return {{ $.GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" $.PgName }},
+		Includes:  map[string]*include.Spec{ {{- printf "%q" .PgPointsToFieldName }}: sub},
+	})}
+}
+{{- end }}
+{{- range .Meta.AllThroughReferences }}
+
+// {{ .GoFieldName }} includes the {{ .PointsTo.Info.PgName }} records linked to the {{ $.PgName }}
+// records through {{ .Through.Info.PgName }}, along with everything included by 'children'.
+func (s {{ $.GoName }}IncludeSpec) {{ .GoFieldName }}(children ...{{ .PointsTo.Info.GoName }}IncludeSpec) {{ $.GoName }}IncludeSpec {
+	sub := &include.Spec{TableName: {{ printf "%q" .PointsTo.Info.PgName }}}
+	for _, child := range children {
+		sub = include.Merge(sub, child.Spec())
+	}
+	return {{ $.GoName }}IncludeSpec{spec: include.Merge(s.Spec(), &include.Spec{
+		TableName: {{ printf "%q" $.PgName }},
+		Includes:  map[string]*include.Spec{ {{- printf "%q" .PgFieldName }}: sub},
+	})}
+}
+{{- end }}
+// {{ .GoName }}FillIncludes fills in the records included by 'includes' for the given
+// {{ .GoName }}, loading each relationship with a single query for each batch of records.
+func (p *PGClient) {{ .GoName }}FillIncludes(
+	ctx context.Context,
+	rec *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
+}
+func (tx *TxPGClient) {{ .GoName }}FillIncludes(
+	ctx context.Context,
+	rec *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
+}
+func (conn *ConnPGClient) {{ .GoName }}FillIncludes(
+	ctx context.Context,
+	rec *{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, []*{{ .GoName }}{rec}, includes, opts...)
+}
+
+// {{ .GoName }}BulkFillIncludes fills in the records included by 'includes' for all of the
+// given {{ .GoName }} records at once.
+func (p *PGClient) {{ .GoName }}BulkFillIncludes(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return p.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
+}
+func (tx *TxPGClient) {{ .GoName }}BulkFillIncludes(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return tx.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
+}
+func (conn *ConnPGClient) {{ .GoName }}BulkFillIncludes(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	return conn.impl.private{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opts...)
+}
+func (p *pgClientImpl) private{{ .GoName }}BulkFillIncludes(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opts ...pggen.IncludeOpt,
+) error {
+	opt := pggen.IncludeOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	loadedRecordTab := map[string]interface{}{}
+	return p.impl{{ .GoName }}BulkFillIncludes(ctx, recs, includes, opt, loadedRecordTab)
+}
+
+// impl{{ .GoName }}BulkFillIncludes fills in the includes for 'recs' and then recursively
+// for the records that it loaded. 'loadedRecordTab' maps table names to the records
+// from that table which have been loaded so far, so that a record which is reachable
+// along several paths is only loaded once.
+func (p *pgClientImpl) impl{{ .GoName }}BulkFillIncludes(
+	ctx context.Context,
+	recs []*{{ .GoName }},
+	includes *include.Spec,
+	opt pggen.IncludeOptions,
+	loadedRecordTab map[string]interface{},
+) error {
+	if includes.TableName != ` + "`" + `{{ .PgName }}` + "`" + ` {
+		return fmt.Errorf(
+			` + "`" + `expected includes for '{{ .PgName }}', got '%s'` + "`" + `,
+			includes.TableName,
+		)
+	}
+
+	loaded := loadedRecordTabFor{{ .GoName }}(loadedRecordTab)
+	for _, rec := range recs {
+		if _, inMap := loaded[rec.{{ .PkeyCol.GoName }}]; !inMap {
+			loaded[rec.{{ .PkeyCol.GoName }}] = rec
+		}
+	}
+	{{- range .Meta.AllIncomingReferences }}
+
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgPointsFromFieldName }}` + "`" + `]; inIncludeSet {
+		subRecs, err := p.private{{ $.GoName }}FillInclude{{ .GoPointsFromFieldName }}(ctx, recs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+		err = p.impl{{ .PointsFrom.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+	}
+	{{- end }}
+	{{- range .Meta.AllOutgoingReferences }}
+
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgPointsToFieldName }}` + "`" + `]; inIncludeSet {
+		subRecs, err := p.private{{ $.GoName }}FillInclude{{ .GoPointsToFieldName }}(ctx, recs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+		err = p.impl{{ .PointsTo.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+	}
+	{{- end }}
+	{{- range .Meta.AllThroughReferences }}
+
+	if subSpec, inIncludeSet := includes.Includes[` + "`" + `{{ .PgFieldName }}` + "`" + `]; inIncludeSet {
+		subRecs, err := p.private{{ $.GoName }}FillInclude{{ .GoFieldName }}(ctx, recs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+		err = p.impl{{ .PointsTo.Info.GoName }}BulkFillIncludes(ctx, subRecs, subSpec, opt, loadedRecordTab)
+		if err != nil {
+			return err
+		}
+	}
+	{{- end }}
+
+	return nil
+}
+
+// loadedRecordTabFor{{ .GoName }} returns the {{ .GoName }} records which have been loaded
+// so far while filling in includes, keyed by primary key.
+func loadedRecordTabFor{{ .GoName }}(
+	loadedRecordTab map[string]interface{},
+) map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }} {
+	tab, inMap := loadedRecordTab[` + "`" + `{{ .PgName }}` + "`" + `]
+	if !inMap {
+		tab = map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }}{}
+		loadedRecordTab[` + "`" + `{{ .PgName }}` + "`" + `] = tab
+	}
+	return tab.(map[{{ .PkeyCol.TypeInfo.Name }}]*{{ .GoName }})
+}
+{{- range .Meta.AllIncomingReferences }}
+
+// For a given set of {{ $.GoName }} records, fill in the {{ .GoPointsFromFieldName }} which refer
+// to them using a single query for each batch of records, returning the
+// {{ .PointsFrom.Info.GoName }} records which were loaded.
+func (p *pgClientImpl) private{{ $.GoName }}FillInclude{{ .GoPointsFromFieldName }}(
+	ctx context.Context,
+	recs []*{{ $.GoName }},
+	spec *include.Spec,
+	opt pggen.IncludeOptions,
+	loadedRecordTab map[string]interface{},
+) ([]*{{ .PointsFrom.Info.GoName }}, error) {
+	for _, rec := range recs {
+		{{- if .OneToOne }}
+		rec.{{ .GoPointsFromFieldName }} = nil
+		{{- else }}
+		rec.{{ .GoPointsFromFieldName }} = []*{{ .PointsFrom.Info.GoName }}{}
+		{{- end }}
+	}
+
+	edge := unstable.IncludeEdge{
+		Table:   ` + "`" + `{{ .PointsFrom.Info.PgName }}` + "`" + `,
+		PkeyCol: ` + "`" + `{{ .PointsFrom.Info.PkeyCol.PgName }}` + "`" + `,
+		Cols:    fieldNames(fieldsFor{{ .PointsFrom.Info.GoName }}),
+		KeyCol:  ` + "`" + `{{ .PointsFromField.PgName }}` + "`" + `,
+		{{- if .PointsFrom.HasDeletedAtField }}
+		DeletedAtCol: ` + "`" + `{{ .PointsFrom.PgDeletedAtField }}` + "`" + `,
+		{{- end }}
+	}
+	query := edge.Query(spec, opt.IncludeDeleted)
+	fill := unstable.IncludeFill[{{ $.GoName }}, {{ .PointsFrom.Info.GoName }}, {{ .PointsToField.TypeInfo.Name }}, {{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }}]{
+		Key: func(rec *{{ $.GoName }}) (id {{ .PointsToField.TypeInfo.Name }}, ok bool) {
+			{{- if .PointsToField.Nullable }}
+			if rec.{{ .PointsToField.GoName }} == nil {
+				return id, false
+			}
+			return *rec.{{ .PointsToField.GoName }}, true
+			{{- else }}
+			return rec.{{ .PointsToField.GoName }}, true
+			{{- end }}
+		},
+		Query: func(
+			ids []{{ .PointsToField.TypeInfo.Name }},
+			yield func({{ .PointsFrom.Info.GoName }}, {{ .PointsToField.TypeInfo.Name }}),
+		) error {
+			rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var (
+					value        {{ .PointsFrom.Info.GoName }}
+					nullableTgts nullableScanTgtsFor{{ .PointsFrom.Info.GoName }}
+					parentID     {{ .PointsToField.TypeInfo.Name }}
+				)
+				scanTgts := make([]interface{}, 0, len(scannerTabFor{{ .PointsFrom.Info.GoName }})+1)
+				for _, scanner := range scannerTabFor{{ .PointsFrom.Info.GoName }} {
+					scanTgts = append(scanTgts, scanner(&value, &nullableTgts))
+				}
+				scanTgts = append(scanTgts, {{ call .PointsToField.TypeInfo.SqlReceiver "parentID" }})
+				err = rows.Scan(scanTgts...)
+				if err != nil {
+					return err
+				}
+				value.fillFromNullableTgts(&nullableTgts)
+				yield(value, parentID)
+			}
+			return rows.Err()
+		},
+		Pkey: func(rec *{{ .PointsFrom.Info.GoName }}) {{ .PointsFrom.Info.PkeyCol.TypeInfo.Name }} {
+			return rec.{{ .PointsFrom.Info.PkeyCol.GoName }}
+		},
+		Attach: func(parent *{{ $.GoName }}, rec *{{ .PointsFrom.Info.GoName }}) {
+			{{- if .OneToOne }}
+			if parent.{{ .GoPointsFromFieldName }} == nil {
+				parent.{{ .GoPointsFromFieldName }} = rec
+			}
+			{{- else }}
+			parent.{{ .GoPointsFromFieldName }} = append(parent.{{ .GoPointsFromFieldName }}, rec)
+			{{- end }}
+		},
+	}
+
+	return fill.Fill(recs, loadedRecordTabFor{{ .PointsFrom.Info.GoName }}(loadedRecordTab), BatchSize)
+}
+{{- end }}
+{{- range .Meta.AllOutgoingReferences }}
+
+// For a given set of {{ $.GoName }} records, fill in the {{ .GoPointsToFieldName }} that each of
+// them refers to using at most one query for each batch of records, returning the
+// {{ .PointsTo.Info.GoName }} records which were filled in.
+func (p *pgClientImpl) private{{ $.GoName }}FillInclude{{ .GoPointsToFieldName }}(
+	ctx context.Context,
+	recs []*{{ $.GoName }},
+	spec *include.Spec,
+	opt pggen.IncludeOptions,
+	loadedRecordTab map[string]interface{},
+) ([]*{{ .PointsTo.Info.GoName }}, error) {
+	// each record refers to at most one {{ .PointsTo.Info.PgName }} record, so there is nothing
+	// to order or limit
+	if len(spec.OrderBy) > 0 || spec.Limit > 0 {
+		return nil, fmt.Errorf(
+			` + "`" + `include of '{{ .PgPointsToFieldName }}' from '{{ $.PgName }}': order and limit are not supported for a single record` + "`" + `,
+		)
+	}
+
+	for _, rec := range recs {
+		rec.{{ .GoPointsToFieldName }} = nil
+	}
+
+	loaded := loadedRecordTabFor{{ .PointsTo.Info.GoName }}(loadedRecordTab)
+	edge := unstable.IncludeEdge{
+		Table:   ` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `,
+		PkeyCol: ` + "`" + `{{ .PointsTo.Info.PkeyCol.PgName }}` + "`" + `,
+		Cols:    fieldNames(fieldsFor{{ .PointsTo.Info.GoName }}),
+		KeyCol:  ` + "`" + `{{ .PointsToField.PgName }}` + "`" + `,
+		{{- if .PointsTo.HasDeletedAtField }}
+		DeletedAtCol: ` + "`" + `{{ .PointsTo.PgDeletedAtField }}` + "`" + `,
+		{{- end }}
+	}
+	query := edge.Query(spec, opt.IncludeDeleted)
+	fill := unstable.IncludeFill[{{ $.GoName }}, {{ .PointsTo.Info.GoName }}, {{ .PointsToField.TypeInfo.Name }}, {{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]{
+		Key: func(rec *{{ $.GoName }}) (id {{ .PointsToField.TypeInfo.Name }}, ok bool) {
+			{{- if .PointsFromField.Nullable }}
+			if rec.{{ .PointsFromField.GoName }} == nil {
+				return id, false
+			}
+			return {{ .PointsToField.TypeInfo.Name }}(*rec.{{ .PointsFromField.GoName }}), true
+			{{- else }}
+			return {{ .PointsToField.TypeInfo.Name }}(rec.{{ .PointsFromField.GoName }}), true
+			{{- end }}
+		},
+		{{- if eq .PointsToField.PgName .PointsTo.Info.PkeyCol.PgName }}
+		// records which have already been loaded don't need to be loaded again
+		// unless they have to be checked against the spec's where clause
+		Known: func(id {{ .PointsToField.TypeInfo.Name }}) (*{{ .PointsTo.Info.GoName }}, bool) {
+			if spec.Where != "" {
+				return nil, false
+			}
+			rec, inMap := loaded[id]
+			return rec, inMap
+		},
+		{{- end }}
+		Query: func(
+			ids []{{ .PointsToField.TypeInfo.Name }},
+			yield func({{ .PointsTo.Info.GoName }}, {{ .PointsToField.TypeInfo.Name }}),
+		) error {
+			rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var (
+					value        {{ .PointsTo.Info.GoName }}
+					nullableTgts nullableScanTgtsFor{{ .PointsTo.Info.GoName }}
+					parentID     {{ .PointsToField.TypeInfo.Name }}
+				)
+				scanTgts := make([]interface{}, 0, len(scannerTabFor{{ .PointsTo.Info.GoName }})+1)
+				for _, scanner := range scannerTabFor{{ .PointsTo.Info.GoName }} {
+					scanTgts = append(scanTgts, scanner(&value, &nullableTgts))
+				}
+				scanTgts = append(scanTgts, {{ call .PointsToField.TypeInfo.SqlReceiver "parentID" }})
+				err = rows.Scan(scanTgts...)
+				if err != nil {
+					return err
+				}
+				value.fillFromNullableTgts(&nullableTgts)
+				yield(value, parentID)
+			}
+			return rows.Err()
+		},
+		Pkey: func(rec *{{ .PointsTo.Info.GoName }}) {{ .PointsTo.Info.PkeyCol.TypeInfo.Name }} {
+			return rec.{{ .PointsTo.Info.PkeyCol.GoName }}
+		},
+		Attach: func(child *{{ $.GoName }}, rec *{{ .PointsTo.Info.GoName }}) {
+			child.{{ .GoPointsToFieldName }} = rec
+		},
+	}
+
+	return fill.Fill(recs, loaded, BatchSize)
+}
+{{- end }}
+{{- range .Meta.AllThroughReferences }}
+
+// For a given set of {{ $.GoName }} records, fill in the {{ .GoFieldName }} linked to them
+// through {{ .Through.Info.PgName }} using a single query for each batch of records,
+// returning the {{ .PointsTo.Info.GoName }} records which were loaded. Records linked to
+// more than one of the given records are shared between them.
+func (p *pgClientImpl) private{{ $.GoName }}FillInclude{{ .GoFieldName }}(
+	ctx context.Context,
+	recs []*{{ $.GoName }},
+	spec *include.Spec,
+	opt pggen.IncludeOptions,
+	loadedRecordTab map[string]interface{},
+) ([]*{{ .PointsTo.Info.GoName }}, error) {
+	for _, rec := range recs {
+		rec.{{ .GoFieldName }} = []*{{ .PointsTo.Info.GoName }}{}
+	}
+
+	edge := unstable.IncludeEdge{
+		Table:      ` + "`" + `{{ .PointsTo.Info.PgName }}` + "`" + `,
+		PkeyCol:    ` + "`" + `{{ .PointsTo.Info.PkeyCol.PgName }}` + "`" + `,
+		Cols:       fieldNames(fieldsFor{{ .PointsTo.Info.GoName }}),
+		KeyCol:     ` + "`" + `{{ .ThroughFromField.PgName }}` + "`" + `,
+		Through:    ` + "`" + `{{ .Through.Info.PgName }}` + "`" + `,
+		ThroughCol: ` + "`" + `{{ .ThroughToField.PgName }}` + "`" + `,
+		{{- if .PointsTo.HasDeletedAtField }}
+		DeletedAtCol: ` + "`" + `{{ .PointsTo.PgDeletedAtField }}` + "`" + `,
+		{{- end }}
+		{{- if .Through.HasDeletedAtField }}
+		ThroughDeletedAtCol: ` + "`" + `{{ .Through.PgDeletedAtField }}` + "`" + `,
+		{{- end }}
+	}
+	query := edge.Query(spec, opt.IncludeDeleted)
+	fill := unstable.IncludeFill[{{ $.GoName }}, {{ .PointsTo.Info.GoName }}, {{ $.PkeyCol.TypeInfo.Name }}, {{ .PointsTo.Info.PkeyCol.TypeInfo.Name }}]{
+		Key: func(rec *{{ $.GoName }}) ({{ $.PkeyCol.TypeInfo.Name }}, bool) {
+			return rec.{{ $.PkeyCol.GoName }}, true
+		},
+		Query: func(
+			ids []{{ $.PkeyCol.TypeInfo.Name }},
+			yield func({{ .PointsTo.Info.GoName }}, {{ $.PkeyCol.TypeInfo.Name }}),
+		) error {
+			rows, err := p.queryContext(ctx, query, pgtypes.Array(ids))
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			for rows.Next() {
+				var (
+					value        {{ .PointsTo.Info.GoName }}
+					nullableTgts nullableScanTgtsFor{{ .PointsTo.Info.GoName }}
+					parentID     {{ $.PkeyCol.TypeInfo.Name }}
+				)
+				scanTgts := make([]interface{}, 0, len(scannerTabFor{{ .PointsTo.Info.GoName }})+1)
+				for _, scanner := range scannerTabFor{{ .PointsTo.Info.GoName }} {
+					scanTgts = append(scanTgts, scanner(&value, &nullableTgts))
+				}
+				scanTgts = append(scanTgts, &parentID)
+				err = rows.Scan(scanTgts...)
+				if err != nil {
+					return err
+				}
+				value.fillFromNullableTgts(&nullableTgts)
+				yield(value, parentID)
+			}
+			return rows.Err()
+		},
+		Pkey: func(rec *{{ .PointsTo.Info.GoName }}) {{ .PointsTo.Info.PkeyCol.TypeInfo.Name }} {
+			return rec.{{ .PointsTo.Info.PkeyCol.GoName }}
+		},
+		Attach: func(parent *{{ $.GoName }}, rec *{{ .PointsTo.Info.GoName }}) {
+			parent.{{ .GoFieldName }} = append(parent.{{ .GoFieldName }}, rec)
+		},
+	}
+
+	return fill.Fill(recs, loadedRecordTabFor{{ .PointsTo.Info.GoName }}(loadedRecordTab), BatchSize)
+}
+{{- end }}
+
 `))
@@ -0,0 +1,454 @@
+package gen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/meta"
+	"github.com/ferumlabs/pggen/gen/internal/types"
+	"github.com/ferumlabs/pggen/include"
+)
+
+// testTypeInfo returns the type info that pggen uses for the given builtin
+// postgres type.
+func testTypeInfo(t *testing.T, pgType string) types.Info {
+	typeResolver := types.NewResolver(nil, func(string) {})
+	err := typeResolver.Resolve(&config.DbConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := typeResolver.TypeInfoOf(pgType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *info
+}
+
+// testTableMeta returns the metadata for a simple `orgs` table with an `id`
+// primary key and a `name` column.
+func testTableMeta(t *testing.T, conf config.TableConfig) *meta.TableMeta {
+	cols := []meta.ColMeta{
+		{
+			TableName: "orgs",
+			ColNum:    1,
+			GoName:    "Id",
+			PgName:    "id",
+			PgType:    "bigint",
+			TypeInfo:  testTypeInfo(t, "bigint"),
+			IsPrimary: true,
+		},
+		{
+			TableName: "orgs",
+			ColNum:    2,
+			GoName:    "Name",
+			PgName:    "name",
+			PgType:    "text",
+			TypeInfo:  testTypeInfo(t, "text"),
+		},
+	}
+
+	return &meta.TableMeta{
+		Config: &conf,
+		Info: meta.PgTableInfo{
+			PgName:       "orgs",
+			GoName:       "Org",
+			PluralGoName: "Orgs",
+			PkeyCol:      &cols[0],
+			PkeyColIdx:   0,
+			Cols:         cols,
+		},
+		AllIncludeSpec: &include.Spec{TableName: "orgs"},
+	}
+}
+
+// testRefTableMetas returns the metadata for the `orgs` table from testTableMeta
+// along with a `users` table that refers to it through a nullable `org_id` column.
+func testRefTableMetas(t *testing.T) (orgs *meta.TableMeta, users *meta.TableMeta) {
+	orgs = testTableMeta(t, config.TableConfig{Name: "orgs"})
+
+	cols := []meta.ColMeta{
+		{
+			TableName: "users",
+			ColNum:    1,
+			GoName:    "Id",
+			PgName:    "id",
+			PgType:    "bigint",
+			TypeInfo:  testTypeInfo(t, "bigint"),
+			IsPrimary: true,
+		},
+		{
+			TableName: "users",
+			ColNum:    2,
+			GoName:    "OrgId",
+			PgName:    "org_id",
+			PgType:    "bigint",
+			TypeInfo:  testTypeInfo(t, "bigint"),
+			Nullable:  true,
+		},
+	}
+	users = &meta.TableMeta{
+		Config: &config.TableConfig{Name: "users"},
+		Info: meta.PgTableInfo{
+			PgName:       "users",
+			GoName:       "User",
+			PluralGoName: "Users",
+			PkeyCol:      &cols[0],
+			PkeyColIdx:   0,
+			Cols:         cols,
+		},
+		AllIncludeSpec: &include.Spec{TableName: "users"},
+	}
+
+	ref := meta.RefMeta{
+		PointsTo:              orgs,
+		PointsToField:         orgs.Info.PkeyCol,
+		PointsFrom:            users,
+		PointsFromField:       &users.Info.Cols[1],
+		GoPointsFromFieldName: "Users",
+		PgPointsFromFieldName: "users",
+		GoPointsToFieldName:   "Org",
+		PgPointsToFieldName:   "org",
+		Nullable:              true,
+	}
+	orgs.AllIncomingReferences = []meta.RefMeta{ref}
+	users.AllOutgoingReferences = []meta.RefMeta{ref}
+
+	return orgs, users
+}
+
+// genTableShim renders the table shim for the given table and makes sure that
+// the result parses.
+func genTableShim(t *testing.T, info *meta.TableMeta) string {
+	var out strings.Builder
+	out.WriteString("package models\n")
+	err := tableShimTmpl.Execute(&out, tableGenCtxFromInfo(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := out.String()
+
+	_, err = parser.ParseFile(token.NewFileSet(), info.Info.PgName+".gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %s", err.Error())
+	}
+	return src
+}
+
+func TestGenTableIterators(t *testing.T) {
+	type testCase struct {
+		boxResults bool
+		zeroDecl   string
+	}
+
+	cases := []testCase{
+		{boxResults: false, zeroDecl: "var zero Org\n"},
+		{boxResults: true, zeroDecl: "var zero *Org\n"},
+	}
+
+	for i, c := range cases {
+		info := testTableMeta(t, config.TableConfig{
+			Name:       "orgs",
+			Iterators:  true,
+			BoxResults: c.boxResults,
+		})
+
+		var out strings.Builder
+		out.WriteString("package models\n")
+		err := tableShimTmpl.Execute(&out, tableGenCtxFromInfo(info))
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err.Error())
+		}
+		src := out.String()
+
+		_, err = parser.ParseFile(token.NewFileSet(), "orgs.gen.go", src, 0)
+		if err != nil {
+			t.Fatalf("case %d: generated code does not parse: %s", i, err.Error())
+		}
+		if !strings.Contains(src, "func (p *PGClient) AllOrg(") {
+			t.Fatalf("case %d: no iterator generated", i)
+		}
+		if !strings.Contains(src, c.zeroDecl) {
+			t.Fatalf("case %d: expected '%s' in the generated code", i, strings.TrimSpace(c.zeroDecl))
+		}
+	}
+}
+
+// fnDecl returns the declaration of the function or method called 'name' in
+// the generated code.
+func fnDecl(t *testing.T, src string, name string) *ast.FuncDecl {
+	file, err := parser.ParseFile(token.NewFileSet(), "gen.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == name {
+			return fn
+		}
+	}
+	t.Fatalf("no '%s' in the generated code", name)
+	return nil
+}
+
+// includeEdge returns the fields of the unstable.IncludeEdge that 'fn' builds
+// to load an include edge, each as it is written in the generated code.
+func includeEdge(t *testing.T, fn *ast.FuncDecl) map[string]string {
+	var fields map[string]string
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.CompositeLit)
+		if !ok || gotypes.ExprString(lit.Type) != "unstable.IncludeEdge" {
+			return true
+		}
+		fields = map[string]string{}
+		for _, elt := range lit.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			fields[kv.Key.(*ast.Ident).Name] = gotypes.ExprString(kv.Value)
+		}
+		return false
+	})
+	if fields == nil {
+		t.Fatalf("%s does not build an include edge", fn.Name.Name)
+	}
+	return fields
+}
+
+func TestGenTableFillIncludesOptions(t *testing.T) {
+	type testCase struct {
+		info   *meta.TableMeta
+		fn     string
+		edge   map[string]string
+		single bool
+	}
+
+	orgs, users := testRefTableMetas(t)
+	cases := []testCase{
+		{
+			// the children along a 1-* edge are matched by their reference
+			info: orgs,
+			fn:   "privateOrgFillIncludeUsers",
+			edge: map[string]string{
+				"Table":   "`users`",
+				"PkeyCol": "`id`",
+				"Cols":    "fieldNames(fieldsForUser)",
+				"KeyCol":  "`org_id`",
+			},
+		},
+		{
+			// the parent along a *-1 edge is matched by the key it is referred by
+			info: users,
+			fn:   "privateUserFillIncludeOrg",
+			edge: map[string]string{
+				"Table":   "`orgs`",
+				"PkeyCol": "`id`",
+				"Cols":    "fieldNames(fieldsForOrg)",
+				"KeyCol":  "`id`",
+			},
+			single: true,
+		},
+	}
+
+	for i, c := range cases {
+		fn := fnDecl(t, genTableShim(t, c.info), c.fn)
+		edge := includeEdge(t, fn)
+		if !reflect.DeepEqual(edge, c.edge) {
+			t.Fatalf("case %d: expected edge %v, got %v", i, c.edge, edge)
+		}
+
+		// the edge's query is built from the spec and options
+		var query string
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if ok && gotypes.ExprString(call.Fun) == "edge.Query" {
+				query = gotypes.ExprString(call)
+			}
+			return query == ""
+		})
+		if query != "edge.Query(spec, opt.IncludeDeleted)" {
+			t.Fatalf("case %d: expected the query to apply the spec, got '%s'", i, query)
+		}
+
+		// a single record can't be ordered or limited, so a spec which asks
+		// for that is rejected before anything is loaded
+		first, ok := fn.Body.List[0].(*ast.IfStmt)
+		rejected := ok && gotypes.ExprString(first.Cond) == "len(spec.OrderBy) > 0 || spec.Limit > 0"
+		if rejected != c.single {
+			t.Fatalf("case %d: order and limit rejected = %v, expected %v", i, rejected, c.single)
+		}
+	}
+}
+
+func TestGenTableFillIncludesSoftDeletes(t *testing.T) {
+	type testCase struct {
+		softDeletes  bool
+		deletedAtCol string
+	}
+
+	cases := []testCase{
+		{softDeletes: false, deletedAtCol: ""},
+		{softDeletes: true, deletedAtCol: "`deleted_at`"},
+	}
+
+	for i, c := range cases {
+		orgs, users := testRefTableMetas(t)
+		if c.softDeletes {
+			users.HasDeletedAtField = true
+			users.PgDeletedAtField = "deleted_at"
+		}
+
+		fn := fnDecl(t, genTableShim(t, orgs), "privateOrgFillIncludeUsers")
+		deletedAtCol := includeEdge(t, fn)["DeletedAtCol"]
+		if deletedAtCol != c.deletedAtCol {
+			t.Fatalf("case %d: expected DeletedAtCol '%s', got '%s'", i, c.deletedAtCol, deletedAtCol)
+		}
+	}
+}
+
+func TestGenTableConflictTargets(t *testing.T) {
+	info := testTableMeta(t, config.TableConfig{Name: "orgs"})
+	info.ConflictTargets = []meta.ConflictTargetMeta{
+		{
+			GoName: "OnId",
+			PgName: "orgs_pkey",
+			SQL:    `ON CONSTRAINT "orgs_pkey"`,
+			PgCols: []string{"id"},
+		},
+		{
+			GoName: "OnOrgsLowerNameIdx",
+			PgName: "orgs_lower_name_idx",
+			SQL:    `((lower(name)))`,
+		},
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "orgs.gen.go", genTableShim(t, info), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the columns of each conflict target, which are needed to find the
+	// existing records when an upsert skips conflicting records
+	cols := map[string]string{}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vspec := spec.(*ast.ValueSpec)
+			for i, name := range vspec.Names {
+				if len(vspec.Values) <= i {
+					continue
+				}
+				lit, ok := vspec.Values[i].(*ast.CompositeLit)
+				if !ok || gotypes.ExprString(lit.Type) != "OrgConflictTarget" {
+					continue
+				}
+				cols[name.Name] = ""
+				for _, elt := range lit.Elts {
+					kv := elt.(*ast.KeyValueExpr)
+					if kv.Key.(*ast.Ident).Name != "cols" {
+						continue
+					}
+					var names []string
+					for _, col := range kv.Value.(*ast.CompositeLit).Elts {
+						names = append(names, col.(*ast.BasicLit).Value)
+					}
+					cols[name.Name] = strings.Join(names, ", ")
+				}
+			}
+		}
+	}
+
+	expected := map[string]string{
+		"OrgConflictOnId":               `"id"`,
+		"OrgConflictOnOrgsLowerNameIdx": "",
+	}
+	if !reflect.DeepEqual(cols, expected) {
+		t.Fatalf("expected conflict target columns %v, got %v", expected, cols)
+	}
+}
+
+func TestGenTableBulkUpdateRepeatedKeys(t *testing.T) {
+	info := testTableMeta(t, config.TableConfig{Name: "orgs"})
+	fn := fnDecl(t, genTableShim(t, info), "bulkUpdateOrg")
+
+	// find the loop which rejects repeated primary keys and the first update
+	// of a batch among the top level statements
+	check, batch := -1, -1
+	for i, stmt := range fn.Body.List {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.RangeStmt:
+				for _, inner := range n.Body.List {
+					ifStmt, ok := inner.(*ast.IfStmt)
+					if ok && check < 0 && gotypes.ExprString(ifStmt.Cond) == "seen[v.Id]" {
+						check = i
+					}
+				}
+			case *ast.CallExpr:
+				if batch < 0 && gotypes.ExprString(n.Fun) == "p.bulkUpdateBatchOrg" {
+					batch = i
+				}
+			}
+			return true
+		})
+	}
+
+	if check < 0 || batch < 0 || batch < check {
+		t.Fatalf("expected repeated primary keys to be rejected before updating (check at %d, update at %d)", check, batch)
+	}
+}
+
+func TestGenTablePredicateHelpers(t *testing.T) {
+	_, users := testRefTableMetas(t)
+
+	file, err := parser.ParseFile(token.NewFileSet(), "users.gen.go", genTableShim(t, users), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedArgTypes := map[string]string{
+		"UserIdEquals":    "int64",
+		"UserOrgIdEquals": "*int64",
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		expected, ok := expectedArgTypes[fn.Name.Name]
+		if !ok {
+			continue
+		}
+		delete(expectedArgTypes, fn.Name.Name)
+
+		params := fn.Type.Params.List
+		if len(params) != 1 || gotypes.ExprString(params[0].Type) != expected {
+			t.Fatalf("%s: expected a single %s argument", fn.Name.Name, expected)
+		}
+
+		table := ""
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			kv, ok := n.(*ast.KeyValueExpr)
+			if !ok {
+				return true
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Table" {
+				if lit, ok := kv.Value.(*ast.BasicLit); ok {
+					table = lit.Value
+				}
+			}
+			return true
+		})
+		if table != "`users`" {
+			t.Fatalf("%s: expected the predicate to be for 'users', got %s", fn.Name.Name, table)
+		}
+	}
+	if len(expectedArgTypes) > 0 {
+		t.Fatalf("missing predicate helpers: %v", expectedArgTypes)
+	}
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
 
 	"github.com/ferumlabs/pggen/gen/internal/names"
 )
@@ -9,6 +12,10 @@ import (
 // The configuration file format used to specify the database objects
 // to generate code for.
 type DbConfig struct {
+	// A list of paths or globs, relative to the file that lists them, naming
+	// other config files to merge into this one. Files ending in `.sql` are
+	// parsed as annotated SQL files containing queries and statements.
+	Include []string `toml:"include"`
 	// The name of the field that should be updated by pggen's generated
 	// `Insert` methods. Overridden by the config option of the same name
 	// on TableConfig.
@@ -21,13 +28,33 @@ type DbConfig struct {
 	// implement soft deletes. Overridden by the config option of the
 	// same name on TableConfig.
 	DeletedAtField string `toml:"deleted_at_field"`
+	// The name of the integer field that should be used to implement
+	// optimistic concurrency control. Overridden by the config option of
+	// the same name on TableConfig.
+	VersionField string `toml:"version_field"`
+	// If true, the common initialisms that golint knows about (ID, URL, API,
+	// UUID and so on) will be spelled in all caps in generated go names, so
+	// `user_id` becomes `UserID` rather than `UserId`.
+	UseDefaultInitialisms bool `toml:"use_default_initialisms"`
+	// A list of extra initialisms to respect when converting postgres names
+	// to go names. Each entry is spelled exactly the way it should appear in
+	// go code (e.g. "SKU" or "OAuth").
+	Initialisms []string `toml:"initialisms"`
 	// If true, it is an error for any [[query]] config block to be missing
 	// the `comment` field. Useful if you want to be strict about documentation.
-	RequireQueryComments bool           `toml:"require_query_comments"`
-	TypeOverrides        []TypeOverride `toml:"type_override"`
-	Queries              []QueryConfig  `toml:"query"`
-	Stmts                []StmtConfig   `toml:"statement"`
-	Tables               []TableConfig  `toml:"table"`
+	RequireQueryComments bool `toml:"require_query_comments"`
+	// If true, every query and table gets methods which stream their results
+	// through a go 1.23 `iter.Seq2` in addition to the ones returning slices.
+	// Turns on the config option of the same name on QueryConfig and TableConfig.
+	Iterators     bool           `toml:"iterators"`
+	TypeOverrides []TypeOverride `toml:"type_override"`
+	Queries       []QueryConfig  `toml:"query"`
+	Stmts         []StmtConfig   `toml:"statement"`
+	Tables        []TableConfig  `toml:"table"`
+	// Patterns which select groups of tables to generate code for
+	// without having to list each of them in a [[table]] block.
+	// Expanded into `Tables` before code generation starts.
+	TablePatterns []TablePattern `toml:"table_pattern"`
 }
 
 // Queries registered in the config file represent arbitrary bits of
@@ -46,9 +73,11 @@ type QueryConfig struct {
 	// A string consisting of the runes '-' and 'n' to indicate the
 	// nullability of return columns. '-' indicates that the column is
 	// not nullable (NOT NULL), while 'n' indicates that it is nullable.
-	// These need to be specified manually because postgres does not expose
-	// a mechanism for infering the nullability of query results that I
-	// could discover. The flags string must be exactly as long as the
+	// pggen infers that result columns which are plain references to NOT NULL
+	// table columns (and not from the nullable side of an outer join) are not
+	// nullable, but everything else is assumed to be nullable unless these
+	// flags say otherwise. When provided, the flags override the inferred
+	// nullability entirely. The flags string must be exactly as long as the
 	// result set is wide.
 	NullFlags string `toml:"null_flags"`
 	// A long-form way of specifying the same thing as `NullFlags`. Only one
@@ -63,6 +92,17 @@ type QueryConfig struct {
 	// return different types are given the same name to use for their
 	// return type, it is an error.
 	ReturnType string `toml:"return_type"`
+	// If true, pggen will not automatically use the model struct for a table
+	// as the return type of this query when the query returns exactly the
+	// columns of that table.
+	NoInferReturnType bool `toml:"no_infer_return_type"`
+	// Model structs to nest inside of the result struct for this query. This
+	// is handy for join queries like `SELECT users.*, orgs.* FROM users ...`,
+	// which would otherwise flatten the columns of both tables into one struct.
+	// Even without any `nest` config, result columns named like `user__id`
+	// are grouped into a nested struct for the table with the matching model
+	// name.
+	Nest []NestConfig `toml:"nest"`
 	// A mapping of argument numbers to names to generate for them.
 	// This configuration option allows you to give useful names to the
 	// query arguments in the genrated code (normaly pggen will just make up
@@ -76,14 +116,53 @@ type QueryConfig struct {
 	// for this query, as there is no point to supporting streaming mode for
 	// a single-result query.
 	SingleResult bool `toml:"single_result"`
+	// Like `single_result`, but rather than returning a NotFoundError when
+	// there are no result rows, the generated method returns an additional
+	// boolean which is false when there was no row. It is an error for the
+	// query to return more than one row.
+	OptionalResult bool `toml:"optional_result"`
 	// If true, allow nullable types to be passed in as arguments to the query.
 	// Normally, query arguments are always non-null so making every argument
 	// a pointer type would just be annoying for client code, but sometimes you
 	// do actually want nullable arguments.
 	NullableArguments bool `toml:"nullable_arguments"`
+	// The names of the arguments which should be nullable, for when only some
+	// of them should be. Named placeholders can also be marked as nullable by
+	// writing them with a `?` suffix, as in `@email?`.
+	NullableArgs []string `toml:"nullable_args"`
 	// If true and the query returns a slice, the values will be boxed as a slice
 	// of pointers. Otherwise, it will be a slice of struct values.
 	BoxResults bool `toml:"box_results"`
+	// If true, also generate a `<Query>Iter` method which streams the results
+	// through a go 1.23 `iter.Seq2`.
+	Iterators bool `toml:"iterators"`
+	// If greater than zero, generate a `<Query>Cursor` method on TxPGClient which
+	// streams the results through a server-side cursor, fetching this many rows
+	// at a time.
+	CursorFetchSize int `toml:"cursor_fetch_size"`
+	// The file that this query was defined in, along with the line if it came
+	// from a `.sql` file. Used to point error messages at the right place.
+	Source string `toml:"-"`
+}
+
+// NestConfig describes a table model struct to nest inside of the result
+// struct for a query.
+type NestConfig struct {
+	// The name of the table whose model struct should be nested.
+	Table string `toml:"table"`
+	// The name of the field to hold the nested struct. Defaults to the
+	// name of the table's model struct.
+	Field string `toml:"field"`
+	// If provided, the nested struct is filled from the result columns named
+	// `<prefix>__<column>`. Otherwise, it is filled from the first run of result
+	// columns which exactly matches the columns of the table, as produced by
+	// `table.*`.
+	Prefix string `toml:"prefix"`
+	// If true, the field is always a pointer, which is nil when every column
+	// for the nested struct is NULL. pggen makes the field a pointer on its own
+	// when the table's NOT NULL columns can come back NULL in the query (for
+	// example because the table is on the nullable side of a LEFT JOIN).
+	Nullable bool `toml:"nullable"`
 }
 
 // Statements are like queries but they are executed for side effects
@@ -107,19 +186,101 @@ type StmtConfig struct {
 	// a pointer type would just be annoying for client code, but sometimes you
 	// do actually want nullable arguments.
 	NullableArguments bool `toml:"nullable_arguments"`
+	// The names of the arguments which should be nullable, for when only some
+	// of them should be. Named placeholders can also be marked as nullable by
+	// writing them with a `?` suffix, as in `@email?`.
+	NullableArgs []string `toml:"nullable_args"`
 	// A comment to place on the generated method so that IDEs can provide
 	// online documentation for the method.
 	Comment string `toml:"comment"`
+	// If true, the statement has a RETURNING clause and the generated method
+	// returns the rows that it produces rather than a `sql.Result`. The row
+	// type is generated in the same way as for a query.
+	Returning bool `toml:"returning"`
+	// The number of rows that the statement is expected to affect (or return,
+	// for a `returning` statement). Either a single number like `1` or an
+	// inclusive range like `"1-10"`, where the upper bound may be left off.
+	// If the count is out of range, the generated method returns a
+	// `*pggen.RowCountError`.
+	ExpectRows *RowCount `toml:"expect_rows"`
+	// The file that this statement was defined in, along with the line if it
+	// came from a `.sql` file. Used to point error messages at the right place.
+	Source string `toml:"-"`
+}
+
+// RowCount is an inclusive range of row counts
+type RowCount struct {
+	Min int64
+	// A negative Max means that there is no upper bound
+	Max int64
+}
+
+// UnmarshalTOML implements toml.Unmarshaler
+func (rc *RowCount) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case int64:
+		rc.Min, rc.Max = v, v
+	case string:
+		parsed, err := ParseRowCount(v)
+		if err != nil {
+			return err
+		}
+		*rc = parsed
+	default:
+		return fmt.Errorf("expected a number or a range like \"1-10\"")
+	}
+
+	if rc.Min < 0 {
+		return fmt.Errorf("row counts cannot be negative")
+	}
+	return nil
+}
+
+// ParseRowCount parses a row count like "1", "1-10" or "1-"
+func ParseRowCount(s string) (RowCount, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	minRows, err := strconv.ParseInt(strings.TrimSpace(lo), 10, 64)
+	if err != nil {
+		return RowCount{}, fmt.Errorf("bad row count '%s'", s)
+	}
+	if !isRange {
+		return RowCount{Min: minRows, Max: minRows}, nil
+	}
+
+	hi = strings.TrimSpace(hi)
+	if hi == "" {
+		if minRows == 0 {
+			return RowCount{}, fmt.Errorf("row count '%s' allows any number of rows", s)
+		}
+		return RowCount{Min: minRows, Max: -1}, nil
+	}
+	maxRows, err := strconv.ParseInt(hi, 10, 64)
+	if err != nil || maxRows < minRows {
+		return RowCount{}, fmt.Errorf("bad row count '%s'", s)
+	}
+	return RowCount{Min: minRows, Max: maxRows}, nil
 }
 
 type TableConfig struct {
 	// The name of the table in the database
 	Name string `toml:"name"`
+	// The name of the go struct generated for this table. All the other
+	// go names derived from the table name (method names, field index
+	// constants and so on) will be based on this name. If not provided,
+	// pggen will make up a name by converting the table name to a singular
+	// PascalCase name.
+	GoName string `toml:"go_name"`
+	// A mapping from column names to the names that should be used for the
+	// corresponding fields in the generated go struct.
+	ColumnGoNames map[string]string `toml:"column_go_names"`
 	// If true, pggen will not infer a relationship between this table
 	// and any owning tables based on any foreign keys in this table.
 	NoInferBelongsTo bool `toml:"no_infer_belongs_to"`
 	// A list of tables that this table belongs to
 	BelongsTo []BelongsTo `toml:"belongs_to"`
+	// A list of tables that this table has a many-to-many relationship
+	// with through a join table
+	HasManyThrough []HasManyThrough `toml:"has_many_through"`
 	// The timestamp to update in `Insert`. Overriddes global version.
 	CreatedAtField string `toml:"created_at_field"`
 	// The timestamp to update in `Update` and `Insert`.
@@ -128,8 +289,15 @@ type TableConfig struct {
 	// The nullable timestamp for implementing soft deletes.
 	// Overriddes global version.
 	DeletedAtField string `toml:"deleted_at_field"`
+	// The integer field to check and bump in `Update` and `Upsert`.
+	// Overriddes global version.
+	VersionField string `toml:"version_field"`
 	// A list of extra annotations to add to the generated fields.
 	FieldTags []FieldTag `toml:"field_tags"`
+	// The field tags supplied by the table_pattern that matched this table.
+	// Unlike FieldTags, they are skipped for columns that the table doesn't
+	// have, and FieldTags for the same column take precedence.
+	PatternFieldTags []FieldTag `toml:"-"`
 	// A list of fields that are to be included in the mutable set.
 	MutableFields []string `toml:"mutable_fields"`
 	// A list of annotations indicating types that specific json columns should
@@ -139,8 +307,54 @@ type TableConfig struct {
 	// If true, queries that return sliced results will return a slice of pointers.
 	// Otherwise, it will be a slice of struct values.
 	BoxResults bool `toml:"box_results"`
+	// If true, generate an `All<Entity>` method which streams every row of
+	// the table through a go 1.23 `iter.Seq2`.
+	Iterators bool `toml:"iterators"`
 	// The specified fields will be generated with the specified type in go code only.
 	GoColTypeOverrides map[string]ColTypeOverride `toml:"go_col_type_overrides"`
+	// The config file that this table was defined in. Empty for tables that
+	// were picked up by a table_pattern. Used to point error messages at the
+	// right place.
+	Source string `toml:"-"`
+}
+
+// A table pattern selects all of the tables in a schema whose names match
+// a glob or regular expression. Each matching table is treated as if it had
+// been listed in a [[table]] block with the shared settings below. A [[table]]
+// block for a matching table overrides the settings that it sets itself, and
+// the pattern supplies the rest.
+type TablePattern struct {
+	// The schema to look for tables in. Defaults to "public".
+	Schema string `toml:"schema"`
+	// The pattern that table names must match in order to be selected.
+	// By default this is a glob (as understood by `path.Match`), but a
+	// pattern wrapped in slashes like `/^billing_.*$/` is treated as a
+	// regular expression. Defaults to "*".
+	Include string `toml:"include"`
+	// A list of patterns, in the same format as `include`, for tables
+	// which should not be selected even though they match `include`.
+	Exclude []string `toml:"exclude"`
+	// The timestamp to update in `Insert` for the matched tables.
+	// Overriddes global version.
+	CreatedAtField string `toml:"created_at_field"`
+	// The timestamp to update in `Update` and `Insert` for the matched
+	// tables. Overriddes global version.
+	UpdatedAtField string `toml:"updated_at_field"`
+	// The nullable timestamp for implementing soft deletes for the matched
+	// tables. Overriddes global version.
+	DeletedAtField string `toml:"deleted_at_field"`
+	// The integer field to check and bump in `Update` and `Upsert` for
+	// the matched tables. Overriddes global version.
+	VersionField string `toml:"version_field"`
+	// If true, queries on the matched tables that return sliced results will
+	// return a slice of pointers.
+	BoxResults bool `toml:"box_results"`
+	// If true, pggen will not infer relationships between the matched tables
+	// and their owning tables based on foreign keys.
+	NoInferBelongsTo bool `toml:"no_infer_belongs_to"`
+	// Extra annotations to add to the generated fields of the matched tables.
+	// Tags for columns that a table doesn't have are skipped.
+	FieldTags []FieldTag `toml:"field_tags"`
 }
 
 // An explicitly configured foreign key relationship which can be attached
@@ -161,6 +375,28 @@ type BelongsTo struct {
 	ChildFieldName string `toml:"child_field_name"`
 }
 
+// An explicitly configured many-to-many relationship which can be attached
+// to a table's config. Pure join tables (tables with nothing but two foreign keys
+// plus maybe a primary key and some timestamps) are detected automatically, so
+// this is only needed for join tables which carry extra data or which pggen
+// can't otherwise make sense of.
+type HasManyThrough struct {
+	// The table at the other end of the relationship
+	Table string `toml:"table"`
+	// The join table
+	Through string `toml:"through"`
+	// Optional. The name of the foreign key in the join table which points
+	// to this table. Only needed if there is more than one.
+	KeyField string `toml:"key_field"`
+	// Optional. The name of the foreign key in the join table which points
+	// to the table at the other end. Only needed if there is more than one.
+	OtherKeyField string `toml:"other_key_field"`
+	// Optional. The name to give the slice field in the generated struct.
+	// If not provided, this will just be the plural name of the struct at
+	// the other end.
+	FieldName string `toml:"field_name"`
+}
+
 // Custom annotations to attach to the field generated for a given
 // database column.
 type FieldTag struct {
@@ -256,45 +492,117 @@ func (c *DbConfig) Validate() error {
 		}
 	}
 
+	for _, query := range c.Queries {
+		err := query.validate()
+		if err != nil {
+			return inSource(query.Source, err)
+		}
+	}
+
 	for _, table := range c.Tables {
-		for _, jsonType := range table.JsonTypes {
-			if len(jsonType.Pkg) > 0 {
-				err := names.ValidateImportPath(jsonType.Pkg)
-				if err != nil {
-					return fmt.Errorf(
-						"table '%s': column '%s': %s",
-						table.Name,
-						jsonType.ColumnName,
-						err.Error(),
-					)
-				}
+		err := table.validate()
+		if err != nil {
+			return inSource(table.Source, err)
+		}
+	}
+
+	return nil
+}
+
+func (query *QueryConfig) validate() error {
+	for _, nest := range query.Nest {
+		if len(nest.Table) == 0 {
+			return fmt.Errorf("query '%s': nest: table must be provided", query.Name)
+		}
+		if len(nest.Field) > 0 && !token.IsIdentifier(nest.Field) {
+			return fmt.Errorf(
+				"query '%s': nest: field '%s' is not a valid go identifier",
+				query.Name,
+				nest.Field,
+			)
+		}
+	}
+	if len(query.Nest) > 0 && len(query.ReturnType) > 0 {
+		return fmt.Errorf("query '%s': return_type cannot be combined with nest", query.Name)
+	}
+	if query.CursorFetchSize < 0 {
+		return fmt.Errorf("query '%s': cursor_fetch_size must be positive", query.Name)
+	}
+	if query.CursorFetchSize > 0 && (query.SingleResult || query.OptionalResult) {
+		return fmt.Errorf(
+			"query '%s': cursor_fetch_size cannot be combined with single_result or optional_result",
+			query.Name,
+		)
+	}
+	return nil
+}
+
+func (table *TableConfig) validate() error {
+	if len(table.GoName) > 0 && !token.IsIdentifier(table.GoName) {
+		return fmt.Errorf("table '%s': go_name '%s' is not a valid go identifier", table.Name, table.GoName)
+	}
+	for colName, goName := range table.ColumnGoNames {
+		if !token.IsIdentifier(goName) {
+			return fmt.Errorf(
+				"table '%s': column '%s': '%s' is not a valid go identifier",
+				table.Name,
+				colName,
+				goName,
+			)
+		}
+	}
+
+	for _, jsonType := range table.JsonTypes {
+		if len(jsonType.Pkg) > 0 {
+			err := names.ValidateImportPath(jsonType.Pkg)
+			if err != nil {
+				return fmt.Errorf(
+					"table '%s': column '%s': %s",
+					table.Name,
+					jsonType.ColumnName,
+					err.Error(),
+				)
 			}
 		}
-		for colName, override := range table.GoColTypeOverrides {
-			if len(override.Pkg) > 0 {
-				err := names.ValidateImportPath(override.Pkg)
-				if err != nil {
-					return fmt.Errorf("col override for '%s': %s", colName, err.Error())
-				}
+	}
+	for colName, override := range table.GoColTypeOverrides {
+		if len(override.Pkg) > 0 {
+			err := names.ValidateImportPath(override.Pkg)
+			if err != nil {
+				return fmt.Errorf("col override for '%s': %s", colName, err.Error())
 			}
-			if len(override.NullPkg) > 0 {
-				err := names.ValidateImportPath(override.NullPkg)
-				if err != nil {
-					return fmt.Errorf("col override for '%s': %s", colName, err.Error())
-				}
+		}
+		if len(override.NullPkg) > 0 {
+			err := names.ValidateImportPath(override.NullPkg)
+			if err != nil {
+				return fmt.Errorf("col override for '%s': %s", colName, err.Error())
 			}
 		}
 	}
-
 	return nil
 }
 
+// inSource points a validation error at the config file that the offending
+// entry was defined in, if we know it.
+func inSource(source string, err error) error {
+	if len(source) == 0 {
+		return err
+	}
+	return fmt.Errorf("config file '%s': %s", source, err.Error())
+}
+
 // Given a user provided configuration, convert it into a normalized form that
 // is suitable for use by pggen.
 //
 // In particular we:
-//   - resolve timestamp overrides and inheritance
+//   - resolve timestamp and version field overrides and inheritance
+//   - fold the default initialisms into the initialism list
 func (c *DbConfig) Normalize() error {
+	if c.UseDefaultInitialisms {
+		c.Initialisms = append(append([]string{}, names.DefaultInitialisms...), c.Initialisms...)
+		c.UseDefaultInitialisms = false
+	}
+
 	for i, tc := range c.Tables {
 		if len(tc.CreatedAtField) == 0 && len(c.CreatedAtField) > 0 {
 			c.Tables[i].CreatedAtField = c.CreatedAtField
@@ -307,6 +615,20 @@ func (c *DbConfig) Normalize() error {
 		if len(tc.DeletedAtField) == 0 && len(c.DeletedAtField) > 0 {
 			c.Tables[i].DeletedAtField = c.DeletedAtField
 		}
+
+		if len(tc.VersionField) == 0 && len(c.VersionField) > 0 {
+			c.Tables[i].VersionField = c.VersionField
+		}
+
+		if c.Iterators {
+			c.Tables[i].Iterators = true
+		}
+	}
+
+	if c.Iterators {
+		for i := range c.Queries {
+			c.Queries[i].Iterators = true
+		}
 	}
 
 	return nil
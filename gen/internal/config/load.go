@@ -0,0 +1,327 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// Load reads the config file at the given path along with all of the files
+// that it includes (transitively) and merges them into a single config.
+//
+// Included files are merged in a deterministic order: the including file comes
+// first, followed by each of its `include` entries in the order they are listed,
+// with the files matched by a single glob being visited in lexical order. All
+// of the lists of queries, statements, tables and so on are concatenated in
+// that order.
+//
+// Included files ending in `.sql` are parsed as annotated SQL files (see
+// sql_file.go) rather than as TOML.
+//
+// Before merging, `${ENV_VAR}` references in TOML string values are replaced with
+// the value of the named environment variable. The merged config is not validated,
+// callers should normalize and then validate it once all of it is in place. Each
+// query, statement and table records the file it came from in its `Source` field,
+// which validation errors are prefixed with.
+func Load(path string) (*DbConfig, error) {
+	l := loader{
+		loaded:         map[string]string{},
+		querySources:   map[string]string{},
+		stmtSources:    map[string]string{},
+		tableSources:   map[string]string{},
+		typeSources:    map[string]string{},
+		settingSources: map[string]string{},
+	}
+
+	var conf DbConfig
+	err := l.load(path, "", &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conf, nil
+}
+
+type loader struct {
+	// A mapping from the absolute path of every file we have loaded so far to the
+	// file that included it (blank for the root config file).
+	loaded map[string]string
+	// Mappings from the names of the various things that can be defined in a
+	// config file to the file in which they were defined. Used to report
+	// duplicates.
+	querySources map[string]string
+	stmtSources  map[string]string
+	tableSources map[string]string
+	typeSources  map[string]string
+	// A mapping from the names of the top-level settings to the file that
+	// set them.
+	settingSources map[string]string
+}
+
+func (l *loader) load(path string, includedFrom string, into *DbConfig) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if prevIncluder, seen := l.loaded[absPath]; seen {
+		if prevIncluder == "" {
+			return fmt.Errorf("config file '%s': includes the root config file '%s'", includedFrom, path)
+		}
+		return fmt.Errorf(
+			"config file '%s': included from '%s' but already included from '%s'",
+			path,
+			includedFrom,
+			prevIncluder,
+		)
+	}
+	l.loaded[absPath] = includedFrom
+
+	confData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var conf DbConfig
+	if filepath.Ext(path) == ".sql" {
+		conf, err = parseSqlFile(path, string(confData))
+		if err != nil {
+			return err
+		}
+	} else {
+		tomlMd, err := toml.Decode(string(confData), &conf)
+		if err != nil {
+			return fmt.Errorf("while parsing config file '%s': %s", path, err.Error())
+		}
+		for _, unknownKey := range tomlMd.Undecoded() {
+			fmt.Fprintf(
+				os.Stderr,
+				"WARN: unknown config file key: '%s' in '%s'\n",
+				unknownKey.String(),
+				path,
+			)
+		}
+
+		err = interpolateEnv(reflect.ValueOf(&conf).Elem())
+		if err != nil {
+			return fmt.Errorf("config file '%s': %s", path, err.Error())
+		}
+	}
+
+	err = l.merge(path, into, &conf)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	for _, include := range conf.Include {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("config file '%s': include '%s': %s", path, include, err.Error())
+		}
+		if len(matches) == 0 && !hasGlobMeta(include) {
+			return fmt.Errorf("config file '%s': include '%s': no such file", path, include)
+		}
+
+		for _, match := range matches {
+			err = l.load(match, path, into)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// merge adds the config `from`, which was loaded from the file at `path`,
+// to the config `into`. Queries, statements and tables remember the file
+// they came from so that later errors can point back to it.
+func (l *loader) merge(path string, into *DbConfig, from *DbConfig) error {
+	err := l.mergeSetting(path, "created_at_field", &into.CreatedAtField, from.CreatedAtField)
+	if err != nil {
+		return err
+	}
+	err = l.mergeSetting(path, "updated_at_field", &into.UpdatedAtField, from.UpdatedAtField)
+	if err != nil {
+		return err
+	}
+	err = l.mergeSetting(path, "deleted_at_field", &into.DeletedAtField, from.DeletedAtField)
+	if err != nil {
+		return err
+	}
+	err = l.mergeSetting(path, "version_field", &into.VersionField, from.VersionField)
+	if err != nil {
+		return err
+	}
+	into.UseDefaultInitialisms = into.UseDefaultInitialisms || from.UseDefaultInitialisms
+	into.RequireQueryComments = into.RequireQueryComments || from.RequireQueryComments
+	into.Iterators = into.Iterators || from.Iterators
+	into.Initialisms = append(into.Initialisms, from.Initialisms...)
+
+	for i, q := range from.Queries {
+		from.Queries[i].Source = sourceOr(q.Source, path)
+		err = checkDup(l.querySources, "query", q.Name, q.Name, from.Queries[i].Source)
+		if err != nil {
+			return err
+		}
+	}
+	for i, s := range from.Stmts {
+		from.Stmts[i].Source = sourceOr(s.Source, path)
+		err = checkDup(l.stmtSources, "statement", s.Name, s.Name, from.Stmts[i].Source)
+		if err != nil {
+			return err
+		}
+	}
+	for i, t := range from.Tables {
+		from.Tables[i].Source = path
+		key := t.Name
+		parsed, err := names.ParsePgName(t.Name)
+		if err == nil {
+			key = parsed.String()
+		}
+		err = checkDup(l.tableSources, "table", t.Name, key, path)
+		if err != nil {
+			return err
+		}
+	}
+	for _, o := range from.TypeOverrides {
+		err = checkDup(l.typeSources, "type override", o.PgTypeName, o.PgTypeName, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	into.Queries = append(into.Queries, from.Queries...)
+	into.Stmts = append(into.Stmts, from.Stmts...)
+	into.Tables = append(into.Tables, from.Tables...)
+	into.TypeOverrides = append(into.TypeOverrides, from.TypeOverrides...)
+	into.TablePatterns = append(into.TablePatterns, from.TablePatterns...)
+
+	return nil
+}
+
+// mergeSetting merges a top-level string setting, complaining if two files
+// disagree about its value.
+func (l *loader) mergeSetting(path string, name string, into *string, from string) error {
+	if from == "" {
+		return nil
+	}
+
+	if *into != "" && *into != from {
+		return fmt.Errorf(
+			"%s is set to '%s' in '%s' but '%s' in '%s'",
+			name,
+			*into,
+			l.settingSources[name],
+			from,
+			path,
+		)
+	}
+
+	*into = from
+	l.settingSources[name] = path
+	return nil
+}
+
+func checkDup(sources map[string]string, kind string, name string, key string, path string) error {
+	if prevPath, dup := sources[key]; dup {
+		return fmt.Errorf("%s '%s' is defined in both '%s' and '%s'", kind, name, prevPath, path)
+	}
+	sources[key] = path
+	return nil
+}
+
+func sourceOr(source string, path string) string {
+	if source != "" {
+		return source
+	}
+	return path
+}
+
+func hasGlobMeta(path string) bool {
+	for _, r := range path {
+		switch r {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+// Matches `${ENV_VAR}` references along with `$${` escapes, which become a
+// literal `${`.
+var envRefRE = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateEnv walks the given value, which must be settable, replacing
+// environment variable references in all the strings it finds.
+func interpolateEnv(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expandEnvRefs(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				// unexported
+				continue
+			}
+			err := interpolateEnv(v.Field(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			err := interpolateEnv(v.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map elements are not addressable, so we have to work on a copy
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			err := interpolateEnv(elem)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+
+	return nil
+}
+
+func expandEnvRefs(s string) (string, error) {
+	var err error
+	res := envRefRE.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		name := ref[2 : len(ref)-1]
+		val, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable '%s' is not set", name)
+		}
+		return val
+	})
+	return res, err
+}
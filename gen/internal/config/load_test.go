@@ -0,0 +1,342 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(body), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadIncludes(t *testing.T) {
+	t.Setenv("PGGEN_TEST_SCHEMA", "billing")
+
+	dir := writeConfigFiles(t, map[string]string{
+		"pggen.toml": `
+include = ["queries/*.toml", "tables.toml"]
+created_at_field = "created_at"
+
+[[query]]
+	name = "Root"
+	body = "SELECT 1"
+`,
+		"queries/b.toml": `
+[[query]]
+	name = "B"
+	body = "SELECT '$${NOT_AN_ENV_VAR}'"
+`,
+		"queries/a.toml": `
+created_at_field = "created_at"
+
+[[query]]
+	name = "A"
+	body = "SELECT 2"
+`,
+		"tables.toml": `
+[[table]]
+	name = "${PGGEN_TEST_SCHEMA}.invoices"
+`,
+	})
+
+	conf, err := Load(filepath.Join(dir, "pggen.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queryNames []string
+	for _, q := range conf.Queries {
+		queryNames = append(queryNames, q.Name)
+	}
+	if strings.Join(queryNames, ",") != "Root,A,B" {
+		t.Fatalf("unexpected query order: %v", queryNames)
+	}
+	if conf.Queries[2].Body != "SELECT '${NOT_AN_ENV_VAR}'" {
+		t.Fatalf("unexpected body: %s", conf.Queries[2].Body)
+	}
+	if len(conf.Tables) != 1 || conf.Tables[0].Name != "billing.invoices" {
+		t.Fatalf("unexpected tables: %v", conf.Tables)
+	}
+	if conf.CreatedAtField != "created_at" {
+		t.Fatalf("unexpected created_at_field: %s", conf.CreatedAtField)
+	}
+}
+
+func TestLoadExpectRows(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"pggen.toml": `
+[[statement]]
+	name = "One"
+	body = "DELETE FROM foo WHERE id = $1"
+	expect_rows = 1
+
+[[statement]]
+	name = "AtLeastOne"
+	body = "DELETE FROM foo WHERE bar = $1"
+	expect_rows = "1-"
+
+[[statement]]
+	name = "Any"
+	body = "DELETE FROM foo"
+`,
+	})
+
+	conf, err := Load(filepath.Join(dir, "pggen.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *conf.Stmts[0].ExpectRows != (RowCount{Min: 1, Max: 1}) {
+		t.Fatalf("unexpected row count: %v", *conf.Stmts[0].ExpectRows)
+	}
+	if *conf.Stmts[1].ExpectRows != (RowCount{Min: 1, Max: -1}) {
+		t.Fatalf("unexpected row count: %v", *conf.Stmts[1].ExpectRows)
+	}
+	if conf.Stmts[2].ExpectRows != nil {
+		t.Fatalf("unexpected row count: %v", *conf.Stmts[2].ExpectRows)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	type testCase struct {
+		files map[string]string
+		err   string
+	}
+
+	cases := []testCase{
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]
+[[query]]
+	name = "Dup"
+	body = "SELECT 1"
+`,
+				"a.toml": `
+[[query]]
+	name = "Dup"
+	body = "SELECT 2"
+`,
+			},
+			err: "query 'Dup' is defined in both '{dir}/pggen.toml' and '{dir}/a.toml'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.sql"]
+[[query]]
+	name = "Dup"
+	body = "SELECT 1"
+`,
+				"a.sql": `
+-- name: Dup
+SELECT 2;
+`,
+			},
+			err: "query 'Dup' is defined in both '{dir}/pggen.toml' and '{dir}/a.sql:2'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]
+[[table]]
+	name = "public.users"
+`,
+				"a.toml": `
+[[table]]
+	name = "users"
+`,
+			},
+			err: "table 'users' is defined in both '{dir}/pggen.toml' and '{dir}/a.toml'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]
+deleted_at_field = "deleted_at"
+`,
+				"a.toml": `deleted_at_field = "removed_at"`,
+			},
+			err: "deleted_at_field is set to 'deleted_at' in '{dir}/pggen.toml' but 'removed_at' in '{dir}/a.toml'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]
+version_field = "version"
+`,
+				"a.toml": `version_field = "lock_version"`,
+			},
+			err: "version_field is set to 'version' in '{dir}/pggen.toml' but 'lock_version' in '{dir}/a.toml'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["missing.toml"]`,
+			},
+			err: "config file '{dir}/pggen.toml': include 'missing.toml': no such file",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]`,
+				"a.toml":     `include = ["pggen.toml"]`,
+			},
+			err: "config file '{dir}/a.toml': includes the root config file '{dir}/pggen.toml'",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]`,
+				"a.toml": `
+[[table]]
+	name = "${PGGEN_TEST_UNSET_VAR}"
+`,
+			},
+			err: "config file '{dir}/a.toml': environment variable 'PGGEN_TEST_UNSET_VAR' is not set",
+		},
+	}
+
+	for i, c := range cases {
+		dir := writeConfigFiles(t, c.files)
+		_, err := Load(filepath.Join(dir, "pggen.toml"))
+		if err == nil {
+			t.Fatalf("case %d: expected an error", i)
+		}
+		expected := strings.ReplaceAll(c.err, "{dir}", dir)
+		if err.Error() != expected {
+			t.Fatalf("case %d: expected error '%s', got '%s'", i, expected, err.Error())
+		}
+	}
+}
+
+func TestValidateMerged(t *testing.T) {
+	type testCase struct {
+		files map[string]string
+		err   string
+	}
+
+	cases := []testCase{
+		{
+			files: map[string]string{
+				"pggen.toml": `include = ["a.toml"]`,
+				"a.toml": `
+[[table]]
+	name = "users"
+	go_name = "not an ident"
+`,
+			},
+			err: "config file '{dir}/a.toml': table 'users': go_name 'not an ident' is not a valid go identifier",
+		},
+		{
+			files: map[string]string{
+				"pggen.toml": `
+[[query]]
+	name = "Export"
+	body = "SELECT 1"
+	single_result = true
+	cursor_fetch_size = 1000
+`,
+			},
+			err: "config file '{dir}/pggen.toml': query 'Export': cursor_fetch_size cannot be combined with single_result or optional_result",
+		},
+	}
+
+	for i, c := range cases {
+		dir := writeConfigFiles(t, c.files)
+		conf, err := Load(filepath.Join(dir, "pggen.toml"))
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err.Error())
+		}
+		err = conf.Normalize()
+		if err != nil {
+			t.Fatalf("case %d: %s", i, err.Error())
+		}
+		err = conf.Validate()
+		if err == nil {
+			t.Fatalf("case %d: expected an error", i)
+		}
+		expected := strings.ReplaceAll(c.err, "{dir}", dir)
+		if err.Error() != expected {
+			t.Fatalf("case %d: expected error '%s', got '%s'", i, expected, err.Error())
+		}
+	}
+}
+
+func TestLoadIterators(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"pggen.toml": `include = ["a.toml"]
+iterators = true
+
+[[query]]
+	name = "Foo"
+	body = "SELECT 1"
+`,
+		"a.toml": `
+[[table]]
+	name = "users"
+`,
+	})
+
+	conf, err := Load(filepath.Join(dir, "pggen.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.Iterators {
+		t.Fatal("iterators setting was dropped while loading")
+	}
+
+	err = conf.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.Queries[0].Iterators || !conf.Tables[0].Iterators {
+		t.Fatal("iterators setting was not applied to the included config")
+	}
+}
+
+func TestNormalizeIterators(t *testing.T) {
+	conf := DbConfig{
+		Iterators: true,
+		Queries:   []QueryConfig{{Name: "A"}, {Name: "B"}},
+		Tables:    []TableConfig{{Name: "foo"}},
+	}
+	err := conf.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !conf.Queries[0].Iterators || !conf.Queries[1].Iterators {
+		t.Fatalf("expected iterators on every query: %v", conf.Queries)
+	}
+	if !conf.Tables[0].Iterators {
+		t.Fatalf("expected iterators on every table: %v", conf.Tables)
+	}
+}
+
+func TestNormalizeVersionField(t *testing.T) {
+	conf := DbConfig{
+		VersionField: "version",
+		Tables: []TableConfig{
+			{Name: "foo"},
+			{Name: "bar", VersionField: "lock_version"},
+		},
+	}
+	err := conf.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Tables[0].VersionField != "version" {
+		t.Fatalf("expected the global version field, got '%s'", conf.Tables[0].VersionField)
+	}
+	if conf.Tables[1].VersionField != "lock_version" {
+		t.Fatalf("expected the table version field, got '%s'", conf.Tables[1].VersionField)
+	}
+}
@@ -0,0 +1,254 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// file: sql_file.go
+// This file implements a parser for `.sql` files containing query and statement
+// definitions. Each definition starts with a `-- name:` line, which may be
+// followed by more annotation comments, and then the SQL itself:
+//
+//	-- name: GetUser :one
+//	-- comment: Look up a user by id
+//	-- arg_names: 1:id
+//	SELECT * FROM users WHERE id = $1;
+//
+// The kind after the name is one of `:many` (the default), which makes a query,
+// `:one`, which makes a query with `single_result` set, `:optional`, which makes
+// a query with `optional_result` set, or `:exec`, which makes a statement.
+//
+// Only comments with a key that we know about are annotations. Any other comment
+// lines before the SQL (`-- TODO: add an index`) are just comments and are skipped.
+
+var (
+	sqlNameRE       = regexp.MustCompile(`^--\s*name:\s*(\S+)\s*(:\w+)?\s*$`)
+	sqlAnnotationRE = regexp.MustCompile(`^--\s*(\w+):\s?(.*)$`)
+)
+
+// a single definition from a sql file in the middle of being parsed
+type sqlDef struct {
+	name   string
+	kind   string
+	line   int
+	inBody bool
+	body   strings.Builder
+
+	comment           []string
+	nullFlags         string
+	notNullFields     []string
+	argNames          string
+	returnType        string
+	nullableArguments bool
+	nullableArgs      []string
+	boxResults        bool
+	iterators         bool
+	cursorFetchSize   int
+	noInferReturnType bool
+	returning         bool
+	expectRows        *RowCount
+	// the annotations that only make sense for queries which were set
+	queryOnly []string
+	// the annotations that only make sense for statements which were set
+	stmtOnly []string
+}
+
+// parseSqlFile converts the contents of the `.sql` file at `path` into a config
+// containing the queries and statements it defines.
+func parseSqlFile(path string, data string) (DbConfig, error) {
+	var (
+		conf DbConfig
+		def  *sqlDef
+	)
+
+	for i, line := range strings.Split(data, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+
+		if m := sqlNameRE.FindStringSubmatch(trimmed); m != nil {
+			if def != nil {
+				err := def.addTo(path, &conf)
+				if err != nil {
+					return DbConfig{}, err
+				}
+			}
+
+			def = &sqlDef{name: m[1], kind: m[2], line: lineNo}
+			if def.kind == "" {
+				def.kind = ":many"
+			}
+			switch def.kind {
+			case ":one", ":optional", ":many", ":exec":
+			default:
+				return DbConfig{}, fmt.Errorf(
+					"%s:%d: unknown kind '%s' (expected :one, :optional, :many or :exec)",
+					path,
+					lineNo,
+					def.kind,
+				)
+			}
+			continue
+		}
+
+		if def == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return DbConfig{}, fmt.Errorf(
+					"%s:%d: SQL must be preceded by a '-- name:' annotation",
+					path,
+					lineNo,
+				)
+			}
+			continue
+		}
+
+		if !def.inBody {
+			if m := sqlAnnotationRE.FindStringSubmatch(trimmed); m != nil {
+				known, err := def.annotate(m[1], strings.TrimSpace(m[2]))
+				if err != nil {
+					return DbConfig{}, fmt.Errorf("%s:%d: %s", path, lineNo, err.Error())
+				}
+				if known {
+					continue
+				}
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+			def.inBody = true
+		}
+
+		def.body.WriteString(line)
+		def.body.WriteByte('\n')
+	}
+
+	if def != nil {
+		err := def.addTo(path, &conf)
+		if err != nil {
+			return DbConfig{}, err
+		}
+	}
+
+	return conf, nil
+}
+
+// annotate applies the annotation `key` to the definition, returning false if
+// `key` is not an annotation that we know about.
+func (d *sqlDef) annotate(key string, value string) (bool, error) {
+	var err error
+	switch key {
+	case "comment":
+		d.comment = append(d.comment, value)
+	case "arg_names":
+		d.argNames = value
+	case "nullable_arguments":
+		d.nullableArguments, err = strconv.ParseBool(value)
+	case "nullable_args":
+		for _, arg := range strings.Split(value, ",") {
+			d.nullableArgs = append(d.nullableArgs, strings.TrimSpace(arg))
+		}
+	case "null_flags":
+		d.nullFlags = value
+		d.queryOnly = append(d.queryOnly, key)
+	case "not_null_fields":
+		for _, field := range strings.Split(value, ",") {
+			d.notNullFields = append(d.notNullFields, strings.TrimSpace(field))
+		}
+		d.queryOnly = append(d.queryOnly, key)
+	case "return_type":
+		d.returnType = value
+		d.queryOnly = append(d.queryOnly, key)
+	case "box_results":
+		d.boxResults, err = strconv.ParseBool(value)
+		d.queryOnly = append(d.queryOnly, key)
+	case "iterators":
+		d.iterators, err = strconv.ParseBool(value)
+		d.queryOnly = append(d.queryOnly, key)
+	case "cursor_fetch_size":
+		d.cursorFetchSize, err = strconv.Atoi(value)
+		d.queryOnly = append(d.queryOnly, key)
+	case "no_infer_return_type":
+		d.noInferReturnType, err = strconv.ParseBool(value)
+		d.queryOnly = append(d.queryOnly, key)
+	case "returning":
+		d.returning, err = strconv.ParseBool(value)
+		d.stmtOnly = append(d.stmtOnly, key)
+	case "expect_rows":
+		var rc RowCount
+		rc, err = ParseRowCount(value)
+		d.expectRows = &rc
+		d.stmtOnly = append(d.stmtOnly, key)
+	default:
+		return false, nil
+	}
+
+	if err != nil {
+		return true, fmt.Errorf("%s: %s", key, err.Error())
+	}
+	return true, nil
+}
+
+func (d *sqlDef) addTo(path string, conf *DbConfig) error {
+	source := fmt.Sprintf("%s:%d", path, d.line)
+
+	body := strings.TrimSpace(d.body.String())
+	body = strings.TrimSpace(strings.TrimSuffix(body, ";"))
+	if body == "" {
+		return fmt.Errorf("%s: '%s' has no SQL", source, d.name)
+	}
+
+	if d.kind == ":exec" {
+		if len(d.queryOnly) > 0 {
+			return fmt.Errorf(
+				"%s: '%s' is a statement, so it cannot have a '%s' annotation",
+				source,
+				d.name,
+				d.queryOnly[0],
+			)
+		}
+
+		conf.Stmts = append(conf.Stmts, StmtConfig{
+			Name:              d.name,
+			Body:              body,
+			ArgNames:          d.argNames,
+			NullableArguments: d.nullableArguments,
+			NullableArgs:      d.nullableArgs,
+			Comment:           strings.Join(d.comment, "\n"),
+			Returning:         d.returning,
+			ExpectRows:        d.expectRows,
+			Source:            source,
+		})
+		return nil
+	}
+
+	if len(d.stmtOnly) > 0 {
+		return fmt.Errorf(
+			"%s: '%s' is a query, so it cannot have a '%s' annotation",
+			source,
+			d.name,
+			d.stmtOnly[0],
+		)
+	}
+
+	conf.Queries = append(conf.Queries, QueryConfig{
+		Name:              d.name,
+		Comment:           strings.Join(d.comment, "\n"),
+		Body:              body,
+		NullFlags:         d.nullFlags,
+		NotNullFields:     d.notNullFields,
+		ReturnType:        d.returnType,
+		NoInferReturnType: d.noInferReturnType,
+		ArgNames:          d.argNames,
+		SingleResult:      d.kind == ":one",
+		OptionalResult:    d.kind == ":optional",
+		NullableArguments: d.nullableArguments,
+		NullableArgs:      d.nullableArgs,
+		BoxResults:        d.boxResults,
+		Iterators:         d.iterators,
+		CursorFetchSize:   d.cursorFetchSize,
+		Source:            source,
+	})
+	return nil
+}
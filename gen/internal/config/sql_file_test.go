@@ -0,0 +1,169 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSqlFile(t *testing.T) {
+	src := `-- queries for the users table
+
+-- name: GetUser :one
+-- comment: Look up a user.
+-- comment: Returns NotFoundError if there is no such user.
+-- arg_names: 1:id
+SELECT * FROM users WHERE id = $1;
+
+-- name: ListUserEmails
+-- TODO: paginate this
+-- null_flags: -n
+-- note that the ids are never null
+-- box_results: true
+-- iterators: true
+-- cursor_fetch_size: 500
+SELECT id,
+	-- emails are optional
+	email
+FROM users;
+
+-- name: DeleteUser :exec
+-- expect_rows: 1
+-- nullable_args: id
+DELETE FROM users WHERE id = $1
+
+-- name: FindUserByEmail :optional
+-- nullable_args: email, org
+SELECT * FROM users WHERE email = $1
+`
+
+	conf, err := parseSqlFile("users.sql", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedQueries := []QueryConfig{
+		{
+			Name:         "GetUser",
+			Comment:      "Look up a user.\nReturns NotFoundError if there is no such user.",
+			Body:         "SELECT * FROM users WHERE id = $1",
+			ArgNames:     "1:id",
+			SingleResult: true,
+			Source:       "users.sql:3",
+		},
+		{
+			Name:            "ListUserEmails",
+			Body:            "SELECT id,\n\t-- emails are optional\n\temail\nFROM users",
+			NullFlags:       "-n",
+			BoxResults:      true,
+			Iterators:       true,
+			CursorFetchSize: 500,
+			Source:          "users.sql:9",
+		},
+		{
+			Name:           "FindUserByEmail",
+			Body:           "SELECT * FROM users WHERE email = $1",
+			OptionalResult: true,
+			NullableArgs:   []string{"email", "org"},
+			Source:         "users.sql:26",
+		},
+	}
+	if !reflect.DeepEqual(conf.Queries, expectedQueries) {
+		t.Fatalf("expected queries %#v, got %#v", expectedQueries, conf.Queries)
+	}
+
+	expectedStmts := []StmtConfig{
+		{
+			Name:         "DeleteUser",
+			Body:         "DELETE FROM users WHERE id = $1",
+			ExpectRows:   &RowCount{Min: 1, Max: 1},
+			NullableArgs: []string{"id"},
+			Source:       "users.sql:21",
+		},
+	}
+	if !reflect.DeepEqual(conf.Stmts, expectedStmts) {
+		t.Fatalf("expected stmts %#v, got %#v", expectedStmts, conf.Stmts)
+	}
+}
+
+func TestParseSqlFileErrors(t *testing.T) {
+	type testCase struct {
+		src string
+		err string
+	}
+
+	cases := []testCase{
+		{
+			src: "SELECT 1",
+			err: "a.sql:1: SQL must be preceded by a '-- name:' annotation",
+		},
+		{
+			src: "-- name: Foo :some\nSELECT 1",
+			err: "a.sql:1: unknown kind ':some' (expected :one, :optional, :many or :exec)",
+		},
+		{
+			src: "-- name: Foo :exec\n-- null_flags: -\nDELETE FROM foo",
+			err: "a.sql:1: 'Foo' is a statement, so it cannot have a 'null_flags' annotation",
+		},
+		{
+			src: "-- name: Foo\n-- returning: true\nSELECT 1",
+			err: "a.sql:1: 'Foo' is a query, so it cannot have a 'returning' annotation",
+		},
+		{
+			src: "-- name: Foo :exec\n-- expect_rows: 3-1\nDELETE FROM foo",
+			err: "a.sql:2: expect_rows: bad row count '3-1'",
+		},
+		{
+			src: "-- name: Foo\n\n-- name: Bar\nSELECT 1",
+			err: "a.sql:1: 'Foo' has no SQL",
+		},
+		{
+			src: "-- name: Foo\n-- box_results: yes\nSELECT 1",
+			err: "a.sql:2: box_results: strconv.ParseBool: parsing \"yes\": invalid syntax",
+		},
+	}
+
+	for i, c := range cases {
+		_, err := parseSqlFile("a.sql", c.src)
+		if err == nil {
+			t.Fatalf("case %d: expected an error", i)
+		}
+		if err.Error() != c.err {
+			t.Fatalf("case %d: expected error '%s', got '%s'", i, c.err, err.Error())
+		}
+	}
+}
+
+func TestParseRowCount(t *testing.T) {
+	type testCase struct {
+		src      string
+		expected RowCount
+		err      bool
+	}
+
+	cases := []testCase{
+		{src: "1", expected: RowCount{Min: 1, Max: 1}},
+		{src: "0-10", expected: RowCount{Min: 0, Max: 10}},
+		{src: " 2 - ", expected: RowCount{Min: 2, Max: -1}},
+		{src: "", err: true},
+		{src: "-1", err: true},
+		{src: "5-2", err: true},
+		{src: "0-", err: true},
+		{src: "one", err: true},
+	}
+
+	for i, c := range cases {
+		actual, err := ParseRowCount(c.src)
+		if c.err {
+			if err == nil {
+				t.Fatalf("case %d: expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+		}
+		if actual != c.expected {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+	}
+}
@@ -82,3 +82,52 @@ func TestArgNamesToSlice(t *testing.T) {
 
 	}
 }
+
+func TestMarkNullableArgs(t *testing.T) {
+	type testCase struct {
+		all      bool
+		names    []string
+		nullable []bool
+		err      string
+	}
+
+	cases := []testCase{
+		{
+			nullable: []bool{false, false, false},
+		},
+		{
+			all:      true,
+			nullable: []bool{true, true, true},
+		},
+		{
+			names:    []string{"email", "org"},
+			nullable: []bool{false, true, true},
+		},
+		{
+			names: []string{"nope"},
+			err:   "nullable argument 'nope' is not the name of an argument",
+		},
+	}
+
+	for i, c := range cases {
+		args := []Arg{{PgName: "id"}, {PgName: "email"}, {PgName: "org"}}
+		err := markNullableArgs(args, c.all, c.names)
+		if len(c.err) > 0 {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("case %d: expected error '%s', got %v", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+		}
+
+		nullable := make([]bool, len(args))
+		for j, arg := range args {
+			nullable[j] = arg.Nullable
+		}
+		if !reflect.DeepEqual(nullable, c.nullable) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.nullable, nullable)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethanpailes/pgtypes"
+
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// file: conflict_targets.go
+// This file figures out the typed `<Entity>ConflictOn<Target>` values to generate
+// for a table, one for each unique index or constraint that an upsert can name
+// in its `ON CONFLICT` clause.
+
+// ConflictIndex describes a unique index on a table, which might back a primary
+// key or unique constraint and might be partial or cover expressions.
+type ConflictIndex struct {
+	// The name of the index in postgres
+	PgName string
+	// The name of the primary key or unique constraint backed by the index,
+	// or the empty string if the index was created directly
+	ConstraintName string
+	// The key of the index, one entry per column or expression, already
+	// rendered as it should appear in a conflict target
+	Keys []string
+	// The indices of the indexed columns in the table's columns, or -1 for
+	// expressions
+	ColIdxs []int
+	// The WHERE clause of a partial index, or the empty string
+	Predicate string
+}
+
+// ConflictTargetMeta describes one of the generated conflict target values.
+type ConflictTargetMeta struct {
+	// The suffix for the name of the generated value (e.g. `OnOrgIDAndEmail`)
+	GoName string
+	// The name of the index or constraint in postgres
+	PgName string
+	// What goes after `ON CONFLICT` to target the index
+	SQL string
+	// The names of the indexed columns in postgres, or nil if the index is
+	// partial or covers expressions
+	PgCols []string
+}
+
+// conflictIndexes returns all the unique indexes on the given table, including
+// the primary key and any partial or expression indexes.
+func (tr *tableResolver) conflictIndexes(table names.PgName, cols []ColMeta) ([]ConflictIndex, error) {
+	rows, err := tr.db.Query(`
+		SELECT
+			i.relname AS index_name,
+			COALESCE(con.conname, '') AS constraint_name,
+			ARRAY(
+				SELECT k.colnum
+				FROM unnest(ix.indkey) WITH ORDINALITY AS k(colnum, n)
+				WHERE k.n <= ix.indnkeyatts
+				ORDER BY k.n
+			) AS col_nums,
+			ARRAY(
+				SELECT pg_get_indexdef(ix.indexrelid, k.n::int, true)
+				FROM generate_series(1, ix.indnkeyatts) AS k(n)
+				ORDER BY k.n
+			) AS key_defs,
+			COALESCE(pg_get_expr(ix.indpred, ix.indrelid, true), '') AS predicate
+		FROM pg_index ix
+		JOIN pg_class c
+			ON (c.oid = ix.indrelid)
+		JOIN pg_class i
+			ON (i.oid = ix.indexrelid)
+		JOIN pg_namespace ns
+			ON (c.relnamespace = ns.oid)
+		LEFT JOIN pg_constraint con
+			ON (con.conindid = ix.indexrelid AND con.contype IN ('p', 'u'))
+		WHERE ix.indisunique
+		  AND ns.nspname = $1
+		  AND c.relname = $2
+		ORDER BY NOT ix.indisprimary, i.relname
+		`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colNumToIdx := columnResolverTable(cols)
+
+	var indexes []ConflictIndex
+	for rows.Next() {
+		var (
+			index   ConflictIndex
+			colNums = []int64{}
+			keyDefs = []string{}
+		)
+		err = rows.Scan(
+			&index.PgName,
+			&index.ConstraintName,
+			pgtypes.Array(&colNums),
+			pgtypes.Array(&keyDefs),
+			&index.Predicate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(colNums) != len(keyDefs) {
+			return nil, fmt.Errorf("mismatched key definitions for index '%s'", index.PgName)
+		}
+
+		for i, colNum := range colNums {
+			if colNum == 0 {
+				// an expression, which must be parenthesized in a conflict target
+				index.Keys = append(index.Keys, "("+keyDefs[i]+")")
+				index.ColIdxs = append(index.ColIdxs, -1)
+				continue
+			}
+			if colNum < 0 || int64(len(colNumToIdx)) <= colNum {
+				return nil, fmt.Errorf(
+					"out of bounds column %d in index '%s'",
+					colNum,
+					index.PgName,
+				)
+			}
+			idx := colNumToIdx[colNum]
+			index.Keys = append(index.Keys, `"`+cols[idx].PgName+`"`)
+			index.ColIdxs = append(index.ColIdxs, idx)
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, rows.Err()
+}
+
+// populateConflictTargets fills in the conflict targets for the given table.
+// Targets over plain columns are named after the columns, and everything else
+// (partial indexes, expression indexes and name clashes) after the index.
+func populateConflictTargets(meta *TableMeta, goNames *names.Converter) {
+	seen := map[string]bool{}
+	for _, index := range meta.Info.ConflictIndexes {
+		target := ConflictTargetMeta{PgName: index.PgName}
+		if index.ConstraintName != "" {
+			target.PgName = index.ConstraintName
+			target.SQL = fmt.Sprintf(`ON CONSTRAINT "%s"`, index.ConstraintName)
+		} else {
+			target.SQL = "(" + strings.Join(index.Keys, ", ") + ")"
+			if index.Predicate != "" {
+				target.SQL += " WHERE " + index.Predicate
+			}
+		}
+
+		colNames := make([]string, 0, len(index.ColIdxs))
+		pgColNames := make([]string, 0, len(index.ColIdxs))
+		for _, idx := range index.ColIdxs {
+			if idx < 0 {
+				colNames = nil
+				pgColNames = nil
+				break
+			}
+			colNames = append(colNames, meta.Info.Cols[idx].GoName)
+			pgColNames = append(pgColNames, meta.Info.Cols[idx].PgName)
+		}
+		if len(colNames) > 0 && index.Predicate == "" {
+			target.GoName = "On" + strings.Join(colNames, "And")
+			target.PgCols = pgColNames
+		}
+		if target.GoName == "" || seen[target.GoName] {
+			target.GoName = "On" + goNames.PgToGoName(target.PgName)
+		}
+		if seen[target.GoName] {
+			continue
+		}
+		seen[target.GoName] = true
+
+		meta.ConflictTargets = append(meta.ConflictTargets, target)
+	}
+}
@@ -0,0 +1,88 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+func TestPopulateConflictTargets(t *testing.T) {
+	users := &TableMeta{
+		Info: PgTableInfo{
+			PgName: "users",
+			GoName: "User",
+			Cols: []ColMeta{
+				{PgName: "id", GoName: "ID"},
+				{PgName: "org_id", GoName: "OrgID"},
+				{PgName: "email", GoName: "Email"},
+			},
+			ConflictIndexes: []ConflictIndex{
+				{
+					PgName:         "users_pkey",
+					ConstraintName: "users_pkey",
+					Keys:           []string{`"id"`},
+					ColIdxs:        []int{0},
+				},
+				{
+					PgName:  "users_org_id_email_idx",
+					Keys:    []string{`"org_id"`, `"email"`},
+					ColIdxs: []int{1, 2},
+				},
+				{
+					PgName:         "users_org_id_email_key",
+					ConstraintName: "users_org_id_email_key",
+					Keys:           []string{`"org_id"`, `"email"`},
+					ColIdxs:        []int{1, 2},
+				},
+				{
+					PgName:    "users_live_email_idx",
+					Keys:      []string{`"email"`},
+					ColIdxs:   []int{2},
+					Predicate: "deleted_at IS NULL",
+				},
+				{
+					PgName:  "users_lower_email_idx",
+					Keys:    []string{`(lower(email))`},
+					ColIdxs: []int{-1},
+				},
+			},
+		},
+	}
+
+	populateConflictTargets(users, names.NewConverter([]string{"ID"}))
+
+	expected := []ConflictTargetMeta{
+		{
+			GoName: "OnID",
+			PgName: "users_pkey",
+			SQL:    `ON CONSTRAINT "users_pkey"`,
+			PgCols: []string{"id"},
+		},
+		{
+			GoName: "OnOrgIDAndEmail",
+			PgName: "users_org_id_email_idx",
+			SQL:    `("org_id", "email")`,
+			PgCols: []string{"org_id", "email"},
+		},
+		{
+			GoName: "OnUsersOrgIDEmailKey",
+			PgName: "users_org_id_email_key",
+			SQL:    `ON CONSTRAINT "users_org_id_email_key"`,
+			PgCols: []string{"org_id", "email"},
+		},
+		{
+			GoName: "OnUsersLiveEmailIdx",
+			PgName: "users_live_email_idx",
+			SQL:    `("email") WHERE deleted_at IS NULL`,
+		},
+		{
+			GoName: "OnUsersLowerEmailIdx",
+			PgName: "users_lower_email_idx",
+			SQL:    `((lower(email)))`,
+		},
+	}
+	if !reflect.DeepEqual(users.ConflictTargets, expected) {
+		t.Fatalf("expected conflict targets %v, got %v", expected, users.ConflictTargets)
+	}
+}
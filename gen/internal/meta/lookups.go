@@ -0,0 +1,207 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ethanpailes/pgtypes"
+	"github.com/jinzhu/inflection"
+
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// file: lookups.go
+// This file figures out the `Get<Entity>By<Cols>` and `List<Entity>By<Col>` methods
+// to generate for a table, which look entities up by the columns of a unique index
+// or by a foreign key column rather than by primary key.
+
+// UniqueIndex describes a unique index over some of the columns of a table.
+type UniqueIndex struct {
+	// The name of the index in postgres
+	PgName string
+	// The indices of the indexed columns in the table's columns, in index order
+	ColIdxs []int
+}
+
+// LookupMeta describes a generated method which looks entities up by
+// the values of some of their columns.
+type LookupMeta struct {
+	// The suffix for the names of the generated methods (e.g. `ByOrgIdAndEmail`)
+	GoName string
+	// The columns to look entities up by
+	Keys []LookupKey
+}
+
+// LookupKey is one of the columns that a lookup method filters on.
+type LookupKey struct {
+	// The 1-based index of the placeholder for this key
+	Idx int
+	Col *ColMeta
+	// The name of the argument holding the value to look up
+	ArgName string
+	// The name of the argument holding a list of values to look up
+	PluralArgName string
+}
+
+// uniqueIndexes returns the unique indexes on the given table, leaving out the
+// primary key along with any partial or expression indexes.
+func (tr *tableResolver) uniqueIndexes(table names.PgName, cols []ColMeta) ([]UniqueIndex, error) {
+	rows, err := tr.db.Query(`
+		SELECT
+			i.relname AS index_name,
+			ARRAY(
+				SELECT k.colnum
+				FROM unnest(ix.indkey) WITH ORDINALITY AS k(colnum, n)
+				WHERE k.n <= ix.indnkeyatts
+				ORDER BY k.n
+			) AS col_nums
+		FROM pg_index ix
+		JOIN pg_class c
+			ON (c.oid = ix.indrelid)
+		JOIN pg_class i
+			ON (i.oid = ix.indexrelid)
+		JOIN pg_namespace ns
+			ON (c.relnamespace = ns.oid)
+		WHERE ix.indisunique
+		  AND NOT ix.indisprimary
+		  AND ix.indpred IS NULL
+		  AND NOT (0 = ANY(ix.indkey))
+		  AND ns.nspname = $1
+		  AND c.relname = $2
+		ORDER BY i.relname
+		`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colNumToIdx := columnResolverTable(cols)
+
+	var indexes []UniqueIndex
+	for rows.Next() {
+		var (
+			index   UniqueIndex
+			colNums = []int64{}
+		)
+		err = rows.Scan(&index.PgName, pgtypes.Array(&colNums))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, colNum := range colNums {
+			if colNum < 0 || int64(len(colNumToIdx)) <= colNum {
+				return nil, fmt.Errorf(
+					"out of bounds column %d in index '%s'",
+					colNum,
+					index.PgName,
+				)
+			}
+			index.ColIdxs = append(index.ColIdxs, colNumToIdx[colNum])
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, rows.Err()
+}
+
+// populateLookups fills in the lookup methods for the given table, one for
+// each distinct set of unique index columns and one for each foreign key column.
+func populateLookups(meta *TableMeta) {
+	seen := map[string]bool{}
+	for _, index := range meta.Info.UniqueIndexes {
+		if len(index.ColIdxs) == 1 && index.ColIdxs[0] == meta.Info.PkeyColIdx {
+			// Get<Entity> already covers this
+			continue
+		}
+
+		lookup := newLookup(meta, index.ColIdxs)
+		if seen[lookup.GoName] {
+			continue
+		}
+		seen[lookup.GoName] = true
+		meta.UniqueLookups = append(meta.UniqueLookups, lookup)
+	}
+
+	seen = map[string]bool{}
+	for _, ref := range meta.AllOutgoingReferences {
+		for i := range meta.Info.Cols {
+			if meta.Info.Cols[i].PgName != ref.PointsFromField.PgName {
+				continue
+			}
+
+			lookup := newLookup(meta, []int{i})
+			if !seen[lookup.GoName] {
+				seen[lookup.GoName] = true
+				meta.FkLookups = append(meta.FkLookups, lookup)
+			}
+			break
+		}
+	}
+}
+
+func newLookup(meta *TableMeta, colIdxs []int) LookupMeta {
+	var (
+		lookup  LookupMeta
+		goNames = make([]string, len(colIdxs))
+	)
+	for i, idx := range colIdxs {
+		col := &meta.Info.Cols[idx]
+		goNames[i] = col.GoName
+
+		// pluralize before converting to an argument name so that `Type`
+		// becomes `types` rather than `type_s`
+		pluralGoName := inflection.Plural(col.GoName)
+		if r := []rune(col.GoName); unicode.IsUpper(r[len(r)-1]) {
+			// an initialism like `OrgID`
+			pluralGoName = col.GoName + "s"
+		}
+
+		lookup.Keys = append(lookup.Keys, LookupKey{
+			Idx:           i + 1,
+			Col:           col,
+			ArgName:       lookupArgName(col.GoName),
+			PluralArgName: lookupArgName(pluralGoName),
+		})
+	}
+	lookup.GoName = "By" + strings.Join(goNames, "And")
+
+	return lookup
+}
+
+// reservedLookupNames are the names that the generated lookup methods already
+// use, either for their other arguments, receivers and locals, for the locals of
+// the code that converts arguments for the database, or for the packages that
+// they refer to. Argument names that would clash with them get a trailing
+// underscore.
+var reservedLookupNames = map[string]bool{
+	"ctx":      true,
+	"opts":     true,
+	"opt":      true,
+	"o":        true,
+	"p":        true,
+	"tx":       true,
+	"conn":     true,
+	"query":    true,
+	"rows":     true,
+	"err":      true,
+	"value":    true,
+	"ret":      true,
+	"batch":    true,
+	"batches":  true,
+	"batchRet": true,
+	"e":        true,
+	"s":        true,
+	"pggen":    true,
+	"pgtypes":  true,
+	"unstable": true,
+	"batcher":  true,
+}
+
+func lookupArgName(goName string) string {
+	argName := names.GoArgName(goName)
+	if reservedLookupNames[argName] {
+		argName += "_"
+	}
+	return argName
+}
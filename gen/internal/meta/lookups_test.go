@@ -0,0 +1,73 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+)
+
+func TestPopulateLookups(t *testing.T) {
+	orgs := &TableMeta{Info: PgTableInfo{PgName: "orgs", GoName: "Org"}}
+	users := &TableMeta{
+		Config: &config.TableConfig{Name: "users"},
+		Info: PgTableInfo{
+			PgName: "users",
+			GoName: "User",
+			Cols: []ColMeta{
+				{PgName: "id", GoName: "ID"},
+				{PgName: "org_id", GoName: "OrgID"},
+				{PgName: "email", GoName: "Email"},
+				{PgName: "type", GoName: "Type"},
+				{PgName: "value", GoName: "Value"},
+				{PgName: "batch", GoName: "Batch"},
+			},
+			PkeyColIdx: 0,
+			UniqueIndexes: []UniqueIndex{
+				{PgName: "users_id_idx", ColIdxs: []int{0}},
+				{PgName: "users_org_id_email_idx", ColIdxs: []int{1, 2}},
+				{PgName: "users_type_idx", ColIdxs: []int{3}},
+				{PgName: "users_type_idx2", ColIdxs: []int{3}},
+				{PgName: "users_value_batch_idx", ColIdxs: []int{4, 5}},
+			},
+		},
+	}
+	users.AllOutgoingReferences = []RefMeta{
+		{PointsTo: orgs, PointsFrom: users, PointsFromField: &users.Info.Cols[1]},
+		{PointsTo: orgs, PointsFrom: users, PointsFromField: &users.Info.Cols[1]},
+	}
+
+	populateLookups(users)
+
+	type lookupSummary struct {
+		GoName string
+		Args   []string
+	}
+	summarize := func(lookups []LookupMeta) []lookupSummary {
+		var res []lookupSummary
+		for _, l := range lookups {
+			s := lookupSummary{GoName: l.GoName}
+			for _, k := range l.Keys {
+				s.Args = append(s.Args, k.ArgName+"/"+k.PluralArgName)
+			}
+			res = append(res, s)
+		}
+		return res
+	}
+
+	expectedUnique := []lookupSummary{
+		{GoName: "ByOrgIDAndEmail", Args: []string{"orgID/orgIDs", "email/emails"}},
+		{GoName: "ByType", Args: []string{"type_/types"}},
+		{GoName: "ByValueAndBatch", Args: []string{"value_/values", "batch_/batches_"}},
+	}
+	if actual := summarize(users.UniqueLookups); !reflect.DeepEqual(actual, expectedUnique) {
+		t.Fatalf("expected unique lookups %v, got %v", expectedUnique, actual)
+	}
+
+	expectedFk := []lookupSummary{
+		{GoName: "ByOrgID", Args: []string{"orgID/orgIDs"}},
+	}
+	if actual := summarize(users.FkLookups); !reflect.DeepEqual(actual, expectedFk) {
+		t.Fatalf("expected foreign key lookups %v, got %v", expectedFk, actual)
+	}
+}
@@ -3,7 +3,12 @@ package meta
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/stdlib"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
 	"github.com/ferumlabs/pggen/gen/internal/log"
@@ -42,6 +47,7 @@ func NewResolver(
 //
 // This method _must_ be called before any of the query methods can be called.
 func (r *Resolver) Resolve(conf *config.DbConfig) error {
+	r.tableResolver.goNames = names.NewConverter(conf.Initialisms)
 	return r.tableResolver.populateTableInfo(conf.Tables)
 }
 
@@ -76,6 +82,8 @@ type Arg struct {
 	PgName string
 	// Information about the go version of this type
 	TypeInfo types.Info
+	// If true, the argument is passed as the nullable version of the type
+	Nullable bool
 }
 
 type QueryMeta struct {
@@ -90,6 +98,11 @@ type QueryMeta struct {
 	MultiReturn bool
 	// The name of the return type for a row returned by this query
 	ReturnTypeName string
+	// The table model structs nested inside of the return type, if any
+	Nests []NestMeta
+	// When there are nested structs, the result columns which are not part
+	// of any of them and become plain fields of the return type
+	LooseCols []NestedCol
 	// A golang comment derived from the Comment field from the query
 	// config.
 	Comment string
@@ -109,13 +122,26 @@ func (mc *Resolver) QueryMeta(
 
 	ret.Comment = configCommentToGoComment(config.Comment)
 
+	argNames, nullableArgs, err := rewriteNamedArgs(&ret.ConfigData.Body, config.ArgNames)
+	if err != nil {
+		return
+	}
+
 	if inferArgTypes {
 		var args []Arg
-		args, err = mc.argsOfStmt(config.Body, config.ArgNames)
+		args, err = mc.argsOfStmt(ret.ConfigData.Body, config.ArgNames, argNames)
 		if err != nil {
 			err = fmt.Errorf("getting query argument types: %s", err.Error())
 			return
 		}
+		err = markNullableArgs(
+			args,
+			config.NullableArguments,
+			append(append([]string{}, config.NullableArgs...), nullableArgs...),
+		)
+		if err != nil {
+			return
+		}
 		ret.Args = args
 	}
 
@@ -131,7 +157,7 @@ func (mc *Resolver) QueryMeta(
 
 		nullFlags = mc.tableResolver.meta.tableInfo[pgTableName].nullFlags()
 	}
-	returnCols, err := mc.queryReturns(config.Body)
+	returnCols, err := mc.queryReturns(ret.ConfigData.Body)
 	if err != nil {
 		return
 	}
@@ -141,6 +167,45 @@ func (mc *Resolver) QueryMeta(
 	}
 	ret.ReturnCols = returnCols
 
+	if !isTable && len(config.ReturnType) == 0 {
+		ret.Nests, ret.LooseCols, err = mc.tableResolver.nestReturns(config.Nest, returnCols)
+		if err != nil {
+			err = fmt.Errorf("nesting result structs: %s", err.Error())
+			return
+		}
+		if len(ret.Nests) > 0 {
+			ret.ReturnTypeName = ret.ConfigData.Name + "Row"
+			ret.MultiReturn = true
+			return
+		}
+	}
+
+	// If the query returns exactly the columns of one of the tables we know about,
+	// just use the table's model struct rather than making up a new type. We don't
+	// do this when the user has fiddled with the nullability since the table struct
+	// would not respect that.
+	if !isTable && len(returnCols) > 1 && len(config.ReturnType) == 0 &&
+		!config.NoInferReturnType && len(nullFlags) == 0 && len(config.NotNullFields) == 0 {
+		if table := mc.tableResolver.tableWithCols(returnCols); table != nil {
+			ret.ReturnCols = append([]ColMeta{}, table.Info.Cols...)
+			ret.ReturnTypeName = table.Info.GoName
+			ret.MultiReturn = true
+			return
+		}
+	}
+
+	seenGoNames := map[string]bool{}
+	for _, col := range ret.ReturnCols {
+		if seenGoNames[col.GoName] {
+			err = fmt.Errorf(
+				"more than one result column maps to the field '%s' (alias the columns or nest them)",
+				col.GoName,
+			)
+			return
+		}
+		seenGoNames[col.GoName] = true
+	}
+
 	if len(ret.ReturnCols) == 1 {
 		ret.MultiReturn = false
 		if ret.ReturnCols[0].Nullable {
@@ -173,6 +238,13 @@ type StmtMeta struct {
 	Comment string
 	// The metadata for the arguments to this query
 	Args []Arg
+	// For `returning` statements, the metadata for the columns returned
+	ReturnCols []ColMeta
+	// Flag indicating if there are multiple returned columns.
+	// Included for the convenience of templates.
+	MultiReturn bool
+	// For `returning` statements, the name of the type for a returned row
+	ReturnTypeName string
 }
 
 func (mc *Resolver) StmtMeta(
@@ -182,19 +254,195 @@ func (mc *Resolver) StmtMeta(
 
 	ret.Comment = configCommentToGoComment(config.Comment)
 
-	args, err := mc.argsOfStmt(config.Body, config.ArgNames)
+	argNames, nullableArgs, err := rewriteNamedArgs(&ret.ConfigData.Body, config.ArgNames)
+	if err != nil {
+		return
+	}
+
+	args, err := mc.argsOfStmt(ret.ConfigData.Body, config.ArgNames, argNames)
 	if err != nil {
 		err = fmt.Errorf("getting statement argument types: %s", err.Error())
 		return
 	}
+	err = markNullableArgs(
+		args,
+		config.NullableArguments,
+		append(append([]string{}, config.NullableArgs...), nullableArgs...),
+	)
+	if err != nil {
+		return
+	}
 	ret.Args = args
 
+	if config.Returning {
+		ret.ReturnCols, err = mc.stmtReturns(ret.ConfigData.Body)
+		if err != nil {
+			err = fmt.Errorf("getting statement return types: %s", err.Error())
+			return
+		}
+
+		switch {
+		case len(ret.ReturnCols) == 0:
+			err = fmt.Errorf("statement is marked as returning, but it does not return any columns")
+			return
+		case len(ret.ReturnCols) == 1:
+			ret.ReturnTypeName = ret.ReturnCols[0].TypeInfo.Name
+			if ret.ReturnCols[0].Nullable {
+				ret.ReturnTypeName = ret.ReturnCols[0].TypeInfo.NullName
+			}
+		default:
+			ret.MultiReturn = true
+			ret.ReturnTypeName = ret.ConfigData.Name + "Row"
+			if table := mc.tableResolver.tableWithCols(ret.ReturnCols); table != nil {
+				ret.ReturnCols = append([]ColMeta{}, table.Info.Cols...)
+				ret.ReturnTypeName = table.Info.GoName
+			}
+		}
+	}
+
 	return
 }
 
+// stmtReturns returns the columns produced by the RETURNING clause of the given
+// statement. Unlike a query, a statement can't be turned into a view, so we ask
+// postgres to describe the prepared statement instead. A returned column is only
+// considered not nullable if it comes straight from a NOT NULL table column.
+func (mc *Resolver) stmtReturns(body string) ([]ColMeta, error) {
+	ctx := context.Background()
+	conn, err := mc.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	type field struct {
+		name    string
+		typeOid uint32
+		typmod  int32
+		tableID uint32
+		attnum  uint16
+	}
+	var fields []field
+	err = conn.Raw(func(driverConn interface{}) error {
+		pgxConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("describing statements requires the pgx driver")
+		}
+		desc, err := pgxConn.Conn().Prepare(ctx, "", body)
+		if err != nil {
+			return err
+		}
+		for _, f := range desc.Fields {
+			fields = append(fields, field{
+				name:    string(f.Name),
+				typeOid: f.DataTypeOID,
+				typmod:  f.TypeModifier,
+				tableID: f.TableOID,
+				attnum:  f.TableAttributeNumber,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]ColMeta, 0, len(fields))
+	for i, f := range fields {
+		col := ColMeta{
+			ColNum:   int32(i + 1),
+			PgName:   f.name,
+			GoName:   mc.tableResolver.goNames.PgToGoName(f.name),
+			Nullable: true,
+		}
+
+		err = mc.db.QueryRow(
+			`SELECT format_type($1, NULLIF($2, -1))`, f.typeOid, f.typmod,
+		).Scan(&col.PgType)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': looking up type: %s", f.name, err.Error())
+		}
+		typeInfo, err := mc.typeResolver.TypeInfoOf(col.PgType)
+		if err != nil {
+			return nil, fmt.Errorf("column '%s': %s", f.name, err.Error())
+		}
+		col.TypeInfo = *typeInfo
+
+		if f.tableID != 0 && f.attnum > 0 {
+			var notNull bool
+			err = mc.db.QueryRow(`
+				SELECT a.attnotnull
+				FROM pg_attribute a
+				WHERE a.attrelid = $1
+				  AND a.attnum = $2
+				`, f.tableID, f.attnum).Scan(&notNull)
+			if err != nil {
+				return nil, fmt.Errorf("column '%s': checking source column: %s", f.name, err.Error())
+			}
+			col.Nullable = !notNull
+		}
+
+		cols = append(cols, col)
+	}
+
+	return cols, nil
+}
+
+// rewriteNamedArgs replaces any named placeholders in `body` with positional ones
+// and returns the names of the arguments, or nil if there were no named placeholders.
+func rewriteNamedArgs(body *string, argNamesSpec string) ([]string, []string, error) {
+	newBody, namedArgs, err := utils.RewriteNamedArgs(*body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if namedArgs == nil {
+		return nil, nil, nil
+	}
+
+	if len(argNamesSpec) > 0 {
+		return nil, nil, fmt.Errorf("arg_names cannot be used along with named placeholders")
+	}
+
+	argNames := make([]string, len(namedArgs))
+	var nullableArgs []string
+	for i, arg := range namedArgs {
+		argNames[i] = arg.Name
+		if arg.Nullable {
+			nullableArgs = append(nullableArgs, arg.Name)
+		}
+	}
+
+	*body = newBody
+	return argNames, nullableArgs, nil
+}
+
+// markNullableArgs flags the arguments that callers pass as pointers. That is all
+// of them if `all` is set, and otherwise just the ones listed in `names`.
+func markNullableArgs(args []Arg, all bool, names []string) error {
+	for i := range args {
+		args[i].Nullable = all
+	}
+
+	for _, name := range names {
+		found := false
+		for i := range args {
+			if args[i].PgName == name {
+				args[i].Nullable = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("nullable argument '%s' is not the name of an argument", name)
+		}
+	}
+
+	return nil
+}
+
 // argsOfStmt infers the types of all the placeholders in the `body` statement
-// and uses that to generate a list of argument metadata
-func (mc *Resolver) argsOfStmt(body string, argNamesSpec string) ([]Arg, error) {
+// and uses that to generate a list of argument metadata. The names of the arguments
+// are taken from `argNames` if it is not nil, and from the `argNamesSpec` otherwise.
+func (mc *Resolver) argsOfStmt(body string, argNamesSpec string, argNames []string) ([]Arg, error) {
 	// Connections require a context, so we'll use a dummy
 	ctx := context.Background()
 
@@ -237,9 +485,17 @@ func (mc *Resolver) argsOfStmt(body string, argNamesSpec string) ([]Arg, error)
 		return nil, fmt.Errorf("getting parameter types: %s", err.Error())
 	}
 
-	argNames, err := argNamesToSlice(argNamesSpec, len(types.pgTypes))
-	if err != nil {
-		return nil, err
+	if argNames == nil {
+		argNames, err = argNamesToSlice(argNamesSpec, len(types.pgTypes))
+		if err != nil {
+			return nil, err
+		}
+	} else if len(argNames) != len(types.pgTypes) {
+		return nil, fmt.Errorf(
+			"internal error: %d named arguments but %d placeholders",
+			len(argNames),
+			len(types.pgTypes),
+		)
 	}
 	args := make([]Arg, 0, len(types.pgTypes))
 	for i, t := range types.pgTypes {
@@ -445,7 +701,7 @@ func (mc *Resolver) FuncArgs(funcName names.PgName) ([]Arg, error) {
 		}
 
 		a.Idx = i
-		a.GoName = names.PgToGoName(a.PgName)
+		a.GoName = mc.tableResolver.goNames.PgToGoName(a.PgName)
 		typeInfo, err := mc.typeResolver.TypeInfoOf(pgTypeName)
 		if err != nil {
 			return nil, err
@@ -467,15 +723,55 @@ func (mc *Resolver) queryReturns(query string) ([]ColMeta, error) {
 		viewName, utils.NullOutArgs(query),
 	)
 
+	var colNames []string
 	_, err := mc.db.Exec(view)
 	if err != nil {
-		return nil, err
+		// Queries which return several columns with the same name (most often
+		// by selecting `a.*, b.*` from a join) can't be turned into a view
+		// directly, so we give the view columns made up names and put the real
+		// ones back afterwards.
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "42701" { // duplicate_column
+			return nil, err
+		}
+
+		colNames, err = mc.resultColNames(query)
+		if err != nil {
+			return nil, err
+		}
+		aliases := make([]string, len(colNames))
+		for i := range colNames {
+			aliases[i] = fmt.Sprintf("col%d", i+1)
+		}
+		view = fmt.Sprintf(
+			`CREATE OR REPLACE TEMP VIEW %s (%s) AS %s`,
+			viewName, strings.Join(aliases, ", "), utils.NullOutArgs(query),
+		)
+		_, err = mc.db.Exec(view)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	viewMeta, err := mc.tableResolver.tableInfo(&config.TableConfig{Name: viewName})
 	if err != nil {
 		return nil, err
 	}
+	if colNames != nil {
+		if len(colNames) != len(viewMeta.Cols) {
+			return nil, fmt.Errorf("internal error: query has %d columns, but view has %d",
+				len(colNames), len(viewMeta.Cols))
+		}
+		for i := range viewMeta.Cols {
+			viewMeta.Cols[i].PgName = colNames[i]
+			viewMeta.Cols[i].GoName = mc.tableResolver.goNames.PgToGoName(colNames[i])
+		}
+	}
+
+	err = mc.inferNullability(viewName, viewMeta.Cols)
+	if err != nil {
+		return nil, err
+	}
 
 	// This should be totally unneeded, but I have observed the tmp
 	// views popping up in psql sessions that were already active
@@ -490,6 +786,20 @@ func (mc *Resolver) queryReturns(query string) ([]ColMeta, error) {
 	return viewMeta.Cols, nil
 }
 
+// resultColNames returns the names of the columns returned by the given query,
+// which may contain duplicates.
+func (mc *Resolver) resultColNames(query string) ([]string, error) {
+	rows, err := mc.db.Query(
+		fmt.Sprintf(`SELECT * FROM (%s) pggen_result LIMIT 0`, utils.NullOutArgs(query)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
 // RefMeta contains metadata for a reference between two tables
 // (a foreign key relationship)
 type RefMeta struct {
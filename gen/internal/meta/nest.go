@@ -0,0 +1,269 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// file: nest.go
+// This file implements grouping the result columns of a query into table model
+// structs which get nested inside of the query's result struct. The groups either
+// come from `nest` config blocks or from result columns named like `user__id`,
+// where the part before the double underscore names a table's model struct.
+
+// NestMeta describes a table model struct which is nested inside of the result
+// struct for a query.
+type NestMeta struct {
+	// The name of the field which holds the nested struct
+	GoName string
+	// The table whose model struct gets nested
+	Table *TableMeta
+	// If true, the field is a pointer which is left nil when every column
+	// for the nested struct comes back NULL
+	Nullable bool
+	// The result columns which fill the nested struct
+	Cols []NestedCol
+}
+
+// NestedCol maps a result column of a query onto the struct field it fills.
+type NestedCol struct {
+	// The index of the column in the query's result columns
+	Idx int
+	// The column that the field is generated from. For columns which fill a
+	// nested struct, this is the table column rather than the result column.
+	Field ColMeta
+}
+
+// nestReturns groups the given result columns into nested table structs, returning
+// the nested structs along with the columns which are left over. If there is nothing
+// to nest it returns nil slices.
+func (tr *tableResolver) nestReturns(
+	nestConf []config.NestConfig,
+	cols []ColMeta,
+) ([]NestMeta, []NestedCol, error) {
+	nestConf, fieldNames := tr.nestSpecs(nestConf, cols)
+	if len(nestConf) == 0 {
+		return nil, nil, nil
+	}
+
+	claimed := make([]bool, len(cols))
+	fieldNameTaken := map[string]bool{}
+	nests := make([]NestMeta, 0, len(nestConf))
+	for i, conf := range nestConf {
+		table, ok := tr.nestTable(conf.Table)
+		if !ok {
+			return nil, nil, fmt.Errorf(
+				"unknown table '%s' (nested tables must have a [[table]] block)",
+				conf.Table,
+			)
+		}
+
+		var (
+			idxs []int
+			err  error
+		)
+		if len(conf.Prefix) > 0 {
+			idxs, err = prefixedColIdxs(conf.Prefix, table, cols, claimed)
+		} else {
+			idxs, err = colRunIdxs(table, cols, claimed)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		nest := NestMeta{
+			GoName:   fieldNames[i],
+			Table:    table,
+			Nullable: conf.Nullable,
+			Cols:     make([]NestedCol, len(idxs)),
+		}
+		for j, idx := range idxs {
+			tableCol := table.Info.Cols[j]
+			if cols[idx].TypeInfo.Name != tableCol.TypeInfo.Name {
+				return nil, nil, fmt.Errorf(
+					"column '%s' has type %s, but '%s.%s' has type %s",
+					cols[idx].PgName,
+					cols[idx].TypeInfo.Name,
+					table.Info.PgName,
+					tableCol.PgName,
+					tableCol.TypeInfo.Name,
+				)
+			}
+
+			// If a column that can't be null in the table can come back null,
+			// the whole row might be missing (because it is on the nullable side
+			// of an outer join).
+			if cols[idx].Nullable && !tableCol.Nullable {
+				nest.Nullable = true
+			}
+
+			claimed[idx] = true
+			nest.Cols[j] = NestedCol{Idx: idx, Field: tableCol}
+		}
+
+		if fieldNameTaken[nest.GoName] {
+			return nil, nil, fmt.Errorf("more than one field named '%s'", nest.GoName)
+		}
+		fieldNameTaken[nest.GoName] = true
+		nests = append(nests, nest)
+	}
+
+	var loose []NestedCol
+	for i, col := range cols {
+		if claimed[i] {
+			continue
+		}
+		if fieldNameTaken[col.GoName] {
+			return nil, nil, fmt.Errorf("more than one field named '%s'", col.GoName)
+		}
+		fieldNameTaken[col.GoName] = true
+		loose = append(loose, NestedCol{Idx: i, Field: col})
+	}
+
+	return nests, loose, nil
+}
+
+// nestSpecs returns the nest configs to use for a query with the given result columns,
+// along with the name of the field for each one. If the user did not configure any,
+// they are inferred from result columns named like `user__id`.
+func (tr *tableResolver) nestSpecs(
+	nestConf []config.NestConfig,
+	cols []ColMeta,
+) ([]config.NestConfig, []string) {
+	if len(nestConf) == 0 {
+		seenPrefix := map[string]bool{}
+		for _, col := range cols {
+			prefix, _, ok := strings.Cut(col.PgName, "__")
+			if !ok || prefix == "" || seenPrefix[prefix] {
+				continue
+			}
+			seenPrefix[prefix] = true
+
+			goName := tr.goNames.PgToGoName(prefix)
+			if table, ok := tr.meta.tableTyNameToTableName[goName]; ok {
+				nestConf = append(nestConf, config.NestConfig{Table: table, Prefix: prefix})
+			} else if _, ok := tr.nestTable(prefix); ok {
+				nestConf = append(nestConf, config.NestConfig{Table: prefix, Prefix: prefix})
+			}
+		}
+	}
+
+	fieldNames := make([]string, len(nestConf))
+	for i, conf := range nestConf {
+		switch {
+		case len(conf.Field) > 0:
+			fieldNames[i] = conf.Field
+		case len(conf.Prefix) > 0:
+			fieldNames[i] = tr.goNames.PgToGoName(conf.Prefix)
+		default:
+			if table, ok := tr.nestTable(conf.Table); ok {
+				fieldNames[i] = table.Info.GoName
+			}
+		}
+	}
+
+	return nestConf, fieldNames
+}
+
+// nestTable looks up the table with the given name, which may be schema qualified
+// or quoted, the same way that Resolver.TableMeta does.
+func (tr *tableResolver) nestTable(name string) (*TableMeta, bool) {
+	n, err := names.ParsePgName(name)
+	if err != nil {
+		return nil, false
+	}
+
+	table, ok := tr.meta.tableInfo[n.String()]
+	return table, ok
+}
+
+// prefixedColIdxs returns the indices of the result columns named `<prefix>__<col>`
+// for each column of the given table, in the order of the table's columns.
+func prefixedColIdxs(
+	prefix string,
+	table *TableMeta,
+	cols []ColMeta,
+	claimed []bool,
+) ([]int, error) {
+	byName := map[string]int{}
+	for i, col := range cols {
+		name, ok := strings.CutPrefix(col.PgName, prefix+"__")
+		if !ok || claimed[i] {
+			continue
+		}
+		if _, dup := byName[name]; dup {
+			return nil, fmt.Errorf("column '%s' appears more than once", col.PgName)
+		}
+		byName[name] = i
+	}
+
+	idxs := make([]int, len(table.Info.Cols))
+	for i, tableCol := range table.Info.Cols {
+		idx, ok := byName[tableCol.PgName]
+		if !ok {
+			return nil, fmt.Errorf(
+				"missing column '%s__%s' needed to fill '%s'",
+				prefix,
+				tableCol.PgName,
+				table.Info.GoName,
+			)
+		}
+		idxs[i] = idx
+	}
+	if len(byName) > len(idxs) {
+		for _, col := range cols {
+			name, ok := strings.CutPrefix(col.PgName, prefix+"__")
+			if ok && !table.hasCol(name) {
+				return nil, fmt.Errorf(
+					"column '%s' is not a column of table '%s'",
+					col.PgName,
+					table.Info.PgName,
+				)
+			}
+		}
+	}
+
+	return idxs, nil
+}
+
+// colRunIdxs returns the indices of the first run of unclaimed result columns
+// which have exactly the names of the columns of the given table, in order.
+func colRunIdxs(table *TableMeta, cols []ColMeta, claimed []bool) ([]int, error) {
+	tableCols := table.Info.Cols
+	for start := 0; start+len(tableCols) <= len(cols); start++ {
+		match := true
+		for j, tableCol := range tableCols {
+			if claimed[start+j] || cols[start+j].PgName != tableCol.PgName {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+
+		idxs := make([]int, len(tableCols))
+		for j := range idxs {
+			idxs[j] = start + j
+		}
+		return idxs, nil
+	}
+
+	return nil, fmt.Errorf(
+		"could not find the columns of table '%s' in the query results (select them with `%s.*`)",
+		table.Info.PgName,
+		table.Info.PgName,
+	)
+}
+
+func (tm *TableMeta) hasCol(pgName string) bool {
+	for _, col := range tm.Info.Cols {
+		if col.PgName == pgName {
+			return true
+		}
+	}
+	return false
+}
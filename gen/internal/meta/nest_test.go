@@ -0,0 +1,181 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/types"
+)
+
+func TestNestReturns(t *testing.T) {
+	// specs are name, type, nullability triples
+	cols := func(specs ...string) []ColMeta {
+		res := make([]ColMeta, 0, len(specs)/3)
+		for i := 0; i < len(specs); i += 3 {
+			res = append(res, ColMeta{
+				PgName:   specs[i],
+				GoName:   specs[i],
+				TypeInfo: types.Info{Name: specs[i+1]},
+				Nullable: specs[i+2] == "n",
+			})
+		}
+		return res
+	}
+
+	tr := newTableResolver(nil, nil, nil, nil)
+	tr.meta.tableInfo = map[string]*TableMeta{
+		"users": {Info: PgTableInfo{
+			PgName: "users",
+			GoName: "User",
+			Cols:   cols("id", "int64", "-", "email", "string", "n"),
+		}},
+		"orgs": {Info: PgTableInfo{
+			PgName: "orgs",
+			GoName: "Org",
+			Cols:   cols("id", "int64", "-", "name", "string", "-"),
+		}},
+		"billing.invoices": {Info: PgTableInfo{
+			PgName: "billing.invoices",
+			GoName: "BillingInvoice",
+			Cols:   cols("id", "int64", "-", "total", "int64", "-"),
+		}},
+	}
+	tr.meta.tableTyNameToTableName = map[string]string{
+		"User":           "users",
+		"Org":            "orgs",
+		"BillingInvoice": "billing.invoices",
+	}
+
+	type nestSummary struct {
+		GoName   string
+		Table    string
+		Nullable bool
+		Idxs     []int
+	}
+	type testCase struct {
+		nest     []config.NestConfig
+		cols     []ColMeta
+		expected []nestSummary
+		loose    []int
+		err      string
+	}
+
+	cases := []testCase{
+		{
+			// users.*, orgs.* with orgs LEFT JOINed
+			nest: []config.NestConfig{{Table: "users"}, {Table: "orgs"}},
+			cols: cols(
+				"id", "int64", "-", "email", "string", "n",
+				"id", "int64", "n", "name", "string", "n",
+			),
+			expected: []nestSummary{
+				{GoName: "User", Table: "users", Idxs: []int{0, 1}},
+				{GoName: "Org", Table: "orgs", Nullable: true, Idxs: []int{2, 3}},
+			},
+		},
+		{
+			// inferred from column prefixes, in any order, with a loose column
+			cols: cols(
+				"n_orgs", "int64", "-",
+				"user__email", "string", "n", "user__id", "int64", "-",
+			),
+			expected: []nestSummary{
+				{GoName: "User", Table: "users", Idxs: []int{2, 1}},
+			},
+			loose: []int{0},
+		},
+		{
+			// a prefix which doesn't name a table is just part of a column name
+			cols: cols("foo__bar", "int64", "-", "baz", "int64", "-"),
+		},
+		{
+			nest: []config.NestConfig{{Table: "orgs", Field: "Owner", Prefix: "owner", Nullable: true}},
+			cols: cols("owner__id", "int64", "-", "owner__name", "string", "-"),
+			expected: []nestSummary{
+				{GoName: "Owner", Table: "orgs", Nullable: true, Idxs: []int{0, 1}},
+			},
+		},
+		{
+			cols: cols("user__id", "int64", "-"),
+			err:  "missing column 'user__email' needed to fill 'User'",
+		},
+		{
+			cols: cols("user__id", "int64", "-", "user__email", "string", "n", "user__age", "int64", "n"),
+			err:  "column 'user__age' is not a column of table 'users'",
+		},
+		{
+			cols: cols("user__id", "string", "-", "user__email", "string", "n"),
+			err:  "column 'user__id' has type string, but 'users.id' has type int64",
+		},
+		{
+			nest: []config.NestConfig{{Table: "orgs"}},
+			cols: cols("id", "int64", "-"),
+			err:  "could not find the columns of table 'orgs' in the query results (select them with `orgs.*`)",
+		},
+		{
+			// schema qualified and quoted names are normalized
+			nest: []config.NestConfig{{Table: "billing.invoices"}, {Table: `public."orgs"`, Prefix: "org"}},
+			cols: cols(
+				"id", "int64", "-", "total", "int64", "-",
+				"org__id", "int64", "-", "org__name", "string", "-",
+			),
+			expected: []nestSummary{
+				{GoName: "BillingInvoice", Table: "billing.invoices", Idxs: []int{0, 1}},
+				{GoName: "Org", Table: "orgs", Idxs: []int{2, 3}},
+			},
+		},
+		{
+			nest: []config.NestConfig{{Table: `"billing"."invoices"`, Field: "Invoice"}},
+			cols: cols("id", "int64", "-", "total", "int64", "-"),
+			expected: []nestSummary{
+				{GoName: "Invoice", Table: "billing.invoices", Idxs: []int{0, 1}},
+			},
+		},
+		{
+			nest: []config.NestConfig{{Table: "nope"}},
+			cols: cols("id", "int64", "-"),
+			err:  "unknown table 'nope' (nested tables must have a [[table]] block)",
+		},
+		{
+			nest: []config.NestConfig{{Table: "orgs"}},
+			cols: cols("id", "int64", "-", "name", "string", "-", "Org", "int64", "-"),
+			err:  "more than one field named 'Org'",
+		},
+	}
+
+	for i, c := range cases {
+		nests, loose, err := tr.nestReturns(c.nest, c.cols)
+		if len(c.err) > 0 {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("case %d: expected error '%s', got %v", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+		}
+
+		var actual []nestSummary
+		for _, n := range nests {
+			s := nestSummary{GoName: n.GoName, Table: n.Table.Info.PgName, Nullable: n.Nullable}
+			for _, col := range n.Cols {
+				s.Idxs = append(s.Idxs, col.Idx)
+			}
+			actual = append(actual, s)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+
+		var actualLoose []int
+		if len(nests) > 0 {
+			for _, col := range loose {
+				actualLoose = append(actualLoose, col.Idx)
+			}
+		}
+		if !reflect.DeepEqual(actualLoose, c.loose) {
+			t.Fatalf("case %d: expected loose columns %v, got %v", i, c.loose, actualLoose)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// file: nullability.go
+// This file implements inference of the nullability of query result columns.
+// Postgres reports every column of a view as nullable, so in order to do better
+// we dig into the query tree that postgres stores for the temporary view we make
+// for each query (the `_RETURN` rule in `pg_rewrite`). Any result column which
+// is a plain reference to a NOT NULL table column, where the table is not on the
+// nullable side of an outer join, cannot be null.
+//
+// The inference is deliberately conservative. Anything we don't understand
+// (expressions, subqueries, CTEs, set operations and so on) leaves the column
+// nullable, and users can always override the result with `null_flags`.
+
+// inferNullability marks the columns of the given view which provably cannot be null
+// as not nullable.
+func (mc *Resolver) inferNullability(viewName string, cols []ColMeta) error {
+	var tree string
+	err := mc.db.QueryRow(`
+		SELECT r.ev_action::text
+		FROM pg_rewrite r
+		WHERE r.ev_class = $1::regclass
+		  AND r.rulename = '_RETURN'
+		`, viewName).Scan(&tree)
+	if err != nil {
+		return fmt.Errorf("loading query tree: %s", err.Error())
+	}
+
+	sources, err := nonNullableSources(tree)
+	if err != nil {
+		// Not being able to make sense of the query tree just means that we
+		// can't infer anything.
+		mc.tableResolver.log.Infof("could not infer result nullability: %s\n", err.Error())
+		return nil
+	}
+
+	for i := range cols {
+		src, ok := sources[cols[i].ColNum]
+		if !ok {
+			continue
+		}
+
+		var notNull bool
+		err = mc.db.QueryRow(`
+			SELECT a.attnotnull
+			FROM pg_attribute a
+			WHERE a.attrelid = $1
+			  AND a.attnum = $2
+			`, src.relid, src.attnum).Scan(&notNull)
+		if err != nil {
+			return fmt.Errorf("column '%s': checking source column: %s", cols[i].PgName, err.Error())
+		}
+		if notNull {
+			cols[i].Nullable = false
+		}
+	}
+
+	return nil
+}
+
+// A reference to a column of a table by oid and column number
+type colSource struct {
+	relid  int64
+	attnum int64
+}
+
+// nonNullableSources examines the `ev_action` query tree of a view and returns a mapping
+// from the numbers of the view columns which are plain column references to the table
+// columns that they reference. Columns from the nullable side of an outer join are left
+// out of the mapping.
+func nonNullableSources(tree string) (map[int32]colSource, error) {
+	root, err := parseNodeTree(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	rootList, ok := root.([]interface{})
+	if !ok || len(rootList) != 1 {
+		return nil, fmt.Errorf("expected a list containing a single query")
+	}
+	query, ok := rootList[0].(*pgNode)
+	if !ok || query.Type != "QUERY" {
+		return nil, fmt.Errorf("expected a QUERY node")
+	}
+
+	// Set operations and grouping sets can introduce nulls for any column, so
+	// we don't try to be clever about them.
+	if query.Fields["setOperations"] != nil || query.Fields["groupingSets"] != nil {
+		return map[int32]colSource{}, nil
+	}
+
+	rtable, _ := query.Fields["rtable"].([]interface{})
+
+	nullableRels := map[int64]bool{}
+	if jointree, ok := query.Fields["jointree"].(*pgNode); ok {
+		fromlist, _ := jointree.Fields["fromlist"].([]interface{})
+		for _, item := range fromlist {
+			markNullableRels(item, false, nullableRels)
+		}
+	}
+
+	sources := map[int32]colSource{}
+	targetList, _ := query.Fields["targetList"].([]interface{})
+	for _, t := range targetList {
+		te, ok := t.(*pgNode)
+		if !ok || te.Type != "TARGETENTRY" || te.str("resjunk") == "true" {
+			continue
+		}
+		resno, err := te.int("resno")
+		if err != nil {
+			return nil, err
+		}
+
+		v, ok := te.Fields["expr"].(*pgNode)
+		if !ok || v.Type != "VAR" {
+			continue
+		}
+		if levelsUp, err := v.int("varlevelsup"); err != nil || levelsUp != 0 {
+			continue
+		}
+		// postgres 16 and later track the outer joins which can null out a var
+		if nullingRels, ok := v.Fields["varnullingrels"].([]interface{}); ok && len(nullingRels) > 1 {
+			continue
+		}
+
+		varno, err := v.int("varno")
+		if err != nil {
+			return nil, err
+		}
+		attnum, err := v.int("varattno")
+		if err != nil {
+			return nil, err
+		}
+		if nullableRels[varno] || attnum <= 0 || varno <= 0 || int(varno) > len(rtable) {
+			continue
+		}
+
+		rte, ok := rtable[varno-1].(*pgNode)
+		// rtekind 0 is RTE_RELATION
+		if !ok || rte.str("rtekind") != "0" {
+			continue
+		}
+		relid, err := rte.int("relid")
+		if err != nil {
+			return nil, err
+		}
+
+		sources[int32(resno)] = colSource{relid: relid, attnum: attnum}
+	}
+
+	return sources, nil
+}
+
+// markNullableRels walks a join tree recording the range table indices of all the
+// relations which appear on the nullable side of an outer join.
+func markNullableRels(node interface{}, nullable bool, into map[int64]bool) {
+	n, ok := node.(*pgNode)
+	if !ok {
+		return
+	}
+
+	switch n.Type {
+	case "RANGETBLREF":
+		if idx, err := n.int("rtindex"); err == nil && nullable {
+			into[idx] = true
+		}
+	case "JOINEXPR":
+		leftNullable, rightNullable := nullable, nullable
+		switch n.str("jointype") {
+		case "0": // JOIN_INNER
+		case "1": // JOIN_LEFT
+			rightNullable = true
+		case "3": // JOIN_RIGHT
+			leftNullable = true
+		default: // JOIN_FULL and anything we don't know about
+			leftNullable, rightNullable = true, true
+		}
+		markNullableRels(n.Fields["larg"], leftNullable, into)
+		markNullableRels(n.Fields["rarg"], rightNullable, into)
+	case "FROMEXPR":
+		fromlist, _ := n.Fields["fromlist"].([]interface{})
+		for _, item := range fromlist {
+			markNullableRels(item, nullable, into)
+		}
+	}
+}
+
+//
+// A parser for the textual representation of postgres node trees, as produced
+// by `nodeToString` and stored in columns of type `pg_node_tree`.
+//
+
+// pgNode is a node in a postgres node tree, like `{VAR :varno 1 :varattno 2}`.
+// Field values are either another *pgNode, a []interface{} for lists and for
+// fields made up of several values (like datums), a string for scalar tokens,
+// or nil for `<>`.
+type pgNode struct {
+	Type   string
+	Fields map[string]interface{}
+}
+
+func (n *pgNode) str(field string) string {
+	s, _ := n.Fields[field].(string)
+	return s
+}
+
+func (n *pgNode) int(field string) (int64, error) {
+	s, ok := n.Fields[field].(string)
+	if !ok {
+		return 0, fmt.Errorf("%s node: missing '%s'", n.Type, field)
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s node: '%s': %s", n.Type, field, err.Error())
+	}
+	return i, nil
+}
+
+func parseNodeTree(tree string) (interface{}, error) {
+	p := nodeTreeParser{toks: tokenizeNodeTree(tree)}
+	val, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("trailing tokens in node tree")
+	}
+	return val, nil
+}
+
+// tokenizeNodeTree splits a node tree into tokens the same way that postgres'
+// `pg_strtok` does. Backslash escapes are resolved.
+func tokenizeNodeTree(tree string) []string {
+	var (
+		toks []string
+		tok  strings.Builder
+		in   bool
+	)
+	flush := func() {
+		if in {
+			toks = append(toks, tok.String())
+			tok.Reset()
+			in = false
+		}
+	}
+
+	for i := 0; i < len(tree); i++ {
+		c := tree[i]
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			flush()
+		case '(', ')', '{', '}':
+			flush()
+			toks = append(toks, string(c))
+		case '\\':
+			in = true
+			if i+1 < len(tree) {
+				i++
+				tok.WriteByte(tree[i])
+			}
+		default:
+			in = true
+			tok.WriteByte(c)
+		}
+	}
+	flush()
+
+	return toks
+}
+
+type nodeTreeParser struct {
+	toks []string
+	pos  int
+}
+
+func (p *nodeTreeParser) next() (string, error) {
+	if p.pos >= len(p.toks) {
+		return "", fmt.Errorf("unexpected end of node tree")
+	}
+	tok := p.toks[p.pos]
+	p.pos++
+	return tok, nil
+}
+
+func (p *nodeTreeParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *nodeTreeParser) value() (interface{}, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case "{":
+		return p.node()
+	case "(":
+		return p.list()
+	case "<>":
+		return nil, nil
+	default:
+		return tok, nil
+	}
+}
+
+// node parses the rest of a node after the opening brace
+func (p *nodeTreeParser) node() (*pgNode, error) {
+	ty, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	n := &pgNode{Type: ty, Fields: map[string]interface{}{}}
+
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok == "}" {
+			return n, nil
+		}
+		if !strings.HasPrefix(tok, ":") {
+			return nil, fmt.Errorf("%s node: expected a field name, got '%s'", ty, tok)
+		}
+
+		// most fields have exactly one value, but some (like datums) are made
+		// up of several tokens
+		var vals []interface{}
+		for next := p.peek(); next != "}" && !strings.HasPrefix(next, ":"); next = p.peek() {
+			val, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+		}
+		switch len(vals) {
+		case 0:
+			n.Fields[tok[1:]] = nil
+		case 1:
+			n.Fields[tok[1:]] = vals[0]
+		default:
+			n.Fields[tok[1:]] = vals
+		}
+	}
+}
+
+// list parses the rest of a list after the opening paren
+func (p *nodeTreeParser) list() ([]interface{}, error) {
+	res := []interface{}{}
+	for {
+		if p.peek() == ")" {
+			p.pos++
+			return res, nil
+		}
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+}
@@ -0,0 +1,134 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNonNullableSources(t *testing.T) {
+	type testCase struct {
+		tree     string
+		expected map[int32]colSource
+	}
+
+	// trimmed down versions of the query trees that postgres stores
+	// for views
+	cases := []testCase{
+		{
+			// SELECT u.id, u.email, o.name, u.id + 1
+			// FROM users u LEFT JOIN orgs o ON u.org_id = o.id
+			tree: `({QUERY :commandType 1 :querySource 0 :canSetTag true :utilityStmt <>
+				:rtable ({RANGETBLENTRY :alias <> :eref {ALIAS :aliasname u :colnames ("id" "email" "org_id")}
+				  :rtekind 0 :relid 16384 :relkind r :rellockmode 1 :tablesample <> :lateral false}
+				  {RANGETBLENTRY :alias <> :eref {ALIAS :aliasname o :colnames ("id" "name")}
+				  :rtekind 0 :relid 16390 :relkind r :rellockmode 1 :tablesample <> :lateral false}
+				  {RANGETBLENTRY :alias <> :eref {ALIAS :aliasname unnamed_join :colnames ("id" "email" "org_id" "id" "name")}
+				  :rtekind 2 :jointype 1})
+				:jointree {FROMEXPR :fromlist ({JOINEXPR :jointype 1 :isNatural false
+				  :larg {RANGETBLREF :rtindex 1} :rarg {RANGETBLREF :rtindex 2} :usingClause <>
+				  :quals {OPEXPR :opno 96 :opfuncid 65 :opresulttype 16 :opretset false
+				    :args ({VAR :varno 1 :varattno 3 :vartype 23} {VAR :varno 2 :varattno 1 :vartype 23})
+				    :location 52} :alias <> :rtindex 3}) :quals <>}
+				:targetList (
+				  {TARGETENTRY :expr {VAR :varno 1 :varattno 1 :vartype 23 :vartypmod -1 :varcollid 0
+				    :varlevelsup 0 :varnosyn 1 :varattnosyn 1 :location 7}
+				    :resno 1 :resname id :ressortgroupref 0 :resorigtbl 16384 :resorigcol 1 :resjunk false}
+				  {TARGETENTRY :expr {VAR :varno 1 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100
+				    :varlevelsup 0 :varnosyn 1 :varattnosyn 2 :location 13}
+				    :resno 2 :resname email :ressortgroupref 0 :resorigtbl 16384 :resorigcol 2 :resjunk false}
+				  {TARGETENTRY :expr {VAR :varno 2 :varattno 2 :vartype 25 :vartypmod -1 :varcollid 100
+				    :varlevelsup 0 :varnosyn 2 :varattnosyn 2 :location 22}
+				    :resno 3 :resname name :ressortgroupref 0 :resorigtbl 16390 :resorigcol 2 :resjunk false}
+				  {TARGETENTRY :expr {OPEXPR :opno 551 :opfuncid 177 :opresulttype 23 :opretset false
+				    :args ({VAR :varno 1 :varattno 1 :vartype 23 :varlevelsup 0}
+				    {CONST :consttype 23 :consttypmod -1 :constcollid 0 :constlen 4 :constbyval true
+				      :constisnull false :location 39 :constvalue 4 [ 1 0 0 0 0 0 0 0 ]})
+				    :location 37}
+				    :resno 4 :resname ?column? :ressortgroupref 0 :resorigtbl 0 :resorigcol 0 :resjunk false})
+				:override 0 :onConflict <> :returningList <> :groupClause <> :groupDistinct false
+				:groupingSets <> :havingQual <> :windowClause <> :distinctClause <> :sortClause <>
+				:limitOffset <> :limitCount <> :limitOption 0 :rowMarks <> :setOperations <>
+				:constraintDeps <> :withCheckOptions <> :stmt_location 0 :stmt_len 0})`,
+			expected: map[int32]colSource{
+				1: {relid: 16384, attnum: 1},
+				2: {relid: 16384, attnum: 2},
+			},
+		},
+		{
+			// postgres 16 style, where vars from the nullable side of a join are
+			// marked with the join that nulls them
+			tree: `({QUERY :commandType 1
+				:rtable ({RANGETBLENTRY :alias <> :rtekind 0 :relid 16384 :relkind r}
+				  {RANGETBLENTRY :alias <> :rtekind 0 :relid 16390 :relkind r})
+				:jointree {FROMEXPR :fromlist ({RANGETBLREF :rtindex 1} {RANGETBLREF :rtindex 2}) :quals <>}
+				:targetList (
+				  {TARGETENTRY :expr {VAR :varno 1 :varattno 1 :varnullingrels (b) :varlevelsup 0}
+				    :resno 1 :resname id :resjunk false}
+				  {TARGETENTRY :expr {VAR :varno 2 :varattno 1 :varnullingrels (b 3) :varlevelsup 0}
+				    :resno 2 :resname other_id :resjunk false}
+				  {TARGETENTRY :expr {VAR :varno 2 :varattno 2 :varnullingrels (b) :varlevelsup 0}
+				    :resno 3 :resname sortkey :resjunk true})
+				:groupingSets <> :setOperations <>})`,
+			expected: map[int32]colSource{
+				1: {relid: 16384, attnum: 1},
+			},
+		},
+		{
+			// a set operation
+			tree: `({QUERY :commandType 1
+				:rtable ({RANGETBLENTRY :alias <> :rtekind 1})
+				:jointree {FROMEXPR :fromlist <> :quals <>}
+				:targetList ({TARGETENTRY :expr {VAR :varno 1 :varattno 1 :varlevelsup 0}
+				    :resno 1 :resname id :resjunk false})
+				:setOperations {SETOPERATIONSTMT :op 1 :all true}})`,
+			expected: map[int32]colSource{},
+		},
+		{
+			// a subquery in the FROM clause
+			tree: `({QUERY :commandType 1
+				:rtable ({RANGETBLENTRY :alias {ALIAS :aliasname sub :colnames <>} :rtekind 1 :subquery {QUERY}})
+				:jointree {FROMEXPR :fromlist ({RANGETBLREF :rtindex 1}) :quals <>}
+				:targetList ({TARGETENTRY :expr {VAR :varno 1 :varattno 1 :varlevelsup 0}
+				    :resno 1 :resname id :resjunk false})
+				:setOperations <>})`,
+			expected: map[int32]colSource{},
+		},
+	}
+
+	for i, c := range cases {
+		actual, err := nonNullableSources(c.tree)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, actual)
+		}
+	}
+}
+
+func TestParseNodeTree(t *testing.T) {
+	tree, err := parseNodeTree(`({ALIAS :aliasname my\ table :colnames ("a" "b\)")} <> (i 1 2))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{
+		&pgNode{
+			Type: "ALIAS",
+			Fields: map[string]interface{}{
+				"aliasname": "my table",
+				"colnames":  []interface{}{`"a"`, `"b)"`},
+			},
+		},
+		nil,
+		[]interface{}{"i", "1", "2"},
+	}
+	if !reflect.DeepEqual(tree, expected) {
+		t.Fatalf("unexpected tree: %#v", tree)
+	}
+
+	_, err = parseNodeTree(`({QUERY :rtable (`)
+	if err == nil {
+		t.Fatal("expected an error for a truncated tree")
+	}
+}
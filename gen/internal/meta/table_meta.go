@@ -34,6 +34,8 @@ type tableResolver struct {
 	log            *log.Logger
 	typeResolver   *types.Resolver
 	registerImport func(string)
+	// Used to convert postgres names into go names
+	goNames *names.Converter
 }
 
 func newTableResolver(
@@ -68,6 +70,9 @@ type TableMeta struct {
 	AllIncomingReferences []RefMeta
 	// All references from this table to other tables (both infered and configured).
 	AllOutgoingReferences []RefMeta
+	// All many-to-many relationships from this table to other tables through
+	// join tables (both infered and configured).
+	AllThroughReferences []ThroughRefMeta
 	// The include spec which represents the transitive closure of
 	// this tables family
 	AllIncludeSpec *include.Spec
@@ -97,6 +102,21 @@ type TableMeta struct {
 	// The name of the deleted at field
 	PgDeletedAtField string
 
+	// If true, this table has an integer version field for optimistic
+	// concurrency control
+	HasVersionField bool
+	// The name of the version field in postgres
+	PgVersionField string
+	// The name of the version field in go
+	GoVersionField string
+
+	// Lookups by the columns of each unique index, for the `Get<Entity>By<Cols>` methods
+	UniqueLookups []LookupMeta
+	// Lookups by each foreign key column, for the `List<Entity>By<Col>` methods
+	FkLookups []LookupMeta
+	// The unique indexes and constraints that upserts can conflict on
+	ConflictTargets []ConflictTargetMeta
+
 	// The table metadata as postgres reports it
 	Info PgTableInfo
 }
@@ -144,6 +164,15 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 		}
 		info.Info = meta
 
+		if otherTable, taken := tr.meta.tableTyNameToTableName[meta.GoName]; taken {
+			return fmt.Errorf(
+				"tables '%s' and '%s' both have the go name '%s'",
+				otherTable,
+				meta.PgName,
+				meta.GoName,
+			)
+		}
+
 		tr.meta.tableInfo[meta.PgName] = info
 		tr.meta.tableTyNameToTableName[meta.GoName] = meta.PgName
 	}
@@ -163,7 +192,16 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 	if err != nil {
 		return err
 	}
-	populateOutgoingReferencesMapping(tr.meta.tableInfo)
+	populateOutgoingReferencesMapping(tr.meta.tableInfo, tr.goNames)
+	err = populateThroughReferences(tables, tr.meta.tableInfo, tr.goNames)
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range tr.meta.tableInfo {
+		populateLookups(meta)
+		populateConflictTargets(meta, tr.goNames)
+	}
 
 	// fill in all the allIncludeSpecs
 	for _, meta := range tr.meta.tableInfo {
@@ -175,6 +213,7 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 
 	for _, meta := range tr.meta.tableInfo {
 		tr.setTimestampFlags(meta)
+		tr.setVersionFlags(meta)
 	}
 
 	for _, meta := range tr.meta.tableInfo {
@@ -187,6 +226,36 @@ func (tr *tableResolver) populateTableInfo(tables []config.TableConfig) error {
 	return nil
 }
 
+// tableWithCols returns the table whose columns exactly match the given columns
+// in name, type and order, or nil if there is not exactly one such table.
+func (tr *tableResolver) tableWithCols(cols []ColMeta) *TableMeta {
+	var match *TableMeta
+	for _, table := range tr.meta.tableInfo {
+		if len(table.Info.Cols) != len(cols) {
+			continue
+		}
+
+		same := true
+		for i, c := range table.Info.Cols {
+			if c.PgName != cols[i].PgName || c.PgType != cols[i].PgType {
+				same = false
+				break
+			}
+		}
+		if !same {
+			continue
+		}
+
+		if match != nil {
+			// ambiguous
+			return nil
+		}
+		match = table
+	}
+
+	return match
+}
+
 func populateFieldTags(meta *TableMeta) error {
 	knownCols := make(map[string]bool, len(meta.Info.Cols))
 	for _, col := range meta.Info.Cols {
@@ -194,6 +263,11 @@ func populateFieldTags(meta *TableMeta) error {
 	}
 
 	colToAnn := make(map[string]string, len(meta.Config.FieldTags))
+	for _, ann := range meta.Config.PatternFieldTags {
+		if knownCols[ann.ColumnName] {
+			colToAnn[ann.ColumnName] = ann.Tags
+		}
+	}
 	for _, ann := range meta.Config.FieldTags {
 		if !knownCols[ann.ColumnName] {
 			return fmt.Errorf("column '%s' is not part of table '%s'", ann.ColumnName, meta.Config.Name)
@@ -228,7 +302,7 @@ func (tr *tableResolver) setTimestampFlags(meta *TableMeta) {
 				meta.HasCreatedAtField = true
 				meta.CreatedAtFieldIsNullable = cm.Nullable
 				meta.CreatedAtHasTimezone = cm.TypeInfo.IsTimestampWithZone
-				meta.GoCreatedAtField = names.PgToGoName(meta.Config.CreatedAtField)
+				meta.GoCreatedAtField = cm.GoName
 				break
 			}
 		}
@@ -248,7 +322,7 @@ func (tr *tableResolver) setTimestampFlags(meta *TableMeta) {
 				meta.HasUpdatedAtField = true
 				meta.UpdatedAtFieldIsNullable = cm.Nullable
 				meta.UpdatedAtHasTimezone = cm.TypeInfo.IsTimestampWithZone
-				meta.GoUpdatedAtField = names.PgToGoName(meta.Config.UpdatedAtField)
+				meta.GoUpdatedAtField = cm.GoName
 				break
 			}
 		}
@@ -282,6 +356,51 @@ func (tr *tableResolver) setTimestampFlags(meta *TableMeta) {
 	}
 }
 
+// setVersionFlags resolves the version field used for optimistic
+// concurrency control, which must be a non-null integer column.
+func (tr *tableResolver) setVersionFlags(meta *TableMeta) {
+	if len(meta.Config.VersionField) == 0 {
+		return
+	}
+
+	for _, cm := range meta.Info.Cols {
+		if cm.PgName != meta.Config.VersionField {
+			continue
+		}
+
+		switch cm.PgType {
+		case "smallint", "integer", "bigint":
+		default:
+			tr.log.Warnf(
+				"table '%s': version field '%s' must be an integer, not '%s'\n",
+				meta.Config.Name,
+				meta.Config.VersionField,
+				cm.PgType,
+			)
+			return
+		}
+		if cm.Nullable {
+			tr.log.Warnf(
+				"table '%s': version field '%s' must be NOT NULL\n",
+				meta.Config.Name,
+				meta.Config.VersionField,
+			)
+			return
+		}
+
+		meta.HasVersionField = true
+		meta.PgVersionField = cm.PgName
+		meta.GoVersionField = cm.GoName
+		return
+	}
+
+	tr.log.Warnf(
+		"table '%s' has no '%s' version field\n",
+		meta.Config.Name,
+		meta.Config.VersionField,
+	)
+}
+
 func ensureSpec(tables map[string]*TableMeta, meta *TableMeta) error {
 	if meta.AllIncludeSpec != nil {
 		// Some other `ensureSpec` already filled this in for us. Great!
@@ -343,6 +462,14 @@ func ensureSpec(tables map[string]*TableMeta, meta *TableMeta) error {
 		}
 	}
 
+	for _, ref := range meta.AllThroughReferences {
+		err := ensureSpec(tables, ref.PointsTo)
+		if err != nil {
+			return err
+		}
+		meta.AllIncludeSpec.Includes[ref.PgFieldName] = ref.PointsTo.AllIncludeSpec
+	}
+
 	if len(meta.AllIncludeSpec.Includes) == 0 {
 		meta.AllIncludeSpec.Includes = nil
 	}
@@ -406,7 +533,7 @@ func (tr *tableResolver) buildAllIncomingReferencesMapping(
 			}
 
 			pgPointsFromFieldName := belongsTo.ParentFieldName
-			goPointsFromFieldName := names.PgToGoName(belongsTo.ParentFieldName)
+			goPointsFromFieldName := tr.goNames.PgToGoName(belongsTo.ParentFieldName)
 			if pgPointsFromFieldName == "" {
 				info := &tr.meta.tableInfo[quotedName].Info
 				if belongsTo.OneToOne {
@@ -420,7 +547,7 @@ func (tr *tableResolver) buildAllIncomingReferencesMapping(
 			belongsToQuotedName := mustConfigPgNameToQuoted(belongsTo.Table)
 
 			pgPointsToFieldName := belongsTo.ChildFieldName
-			goPointsToFieldName := names.PgToGoName(pgPointsToFieldName)
+			goPointsToFieldName := tr.goNames.PgToGoName(pgPointsToFieldName)
 			if pgPointsToFieldName == "" {
 				info := &tr.meta.tableInfo[belongsToQuotedName].Info
 				goPointsToFieldName = info.GoName
@@ -502,7 +629,7 @@ func disambiguateIncomingReflist(incomingRefs []RefMeta) {
 // incoming references to all tables have been filled in.
 //
 // Mutates its argument
-func populateOutgoingReferencesMapping(infoTab map[string]*TableMeta) {
+func populateOutgoingReferencesMapping(infoTab map[string]*TableMeta, goNames *names.Converter) {
 	// build a mapping from target tables to lists of references to those target tables
 	outgoingRefMap := make(map[string][]RefMeta, len(infoTab))
 	for _, meta := range infoTab {
@@ -539,7 +666,7 @@ func populateOutgoingReferencesMapping(infoTab map[string]*TableMeta) {
 						meta.AllOutgoingReferences[i].PgPointsToFieldName + strconv.FormatInt(int64(counter), 10)
 				}
 				meta.AllOutgoingReferences[i].GoPointsToFieldName =
-					names.PgToGoName(meta.AllOutgoingReferences[i].PgPointsToFieldName)
+					goNames.PgToGoName(meta.AllOutgoingReferences[i].PgPointsToFieldName)
 
 				counter++
 			}
@@ -570,6 +697,10 @@ type PgTableInfo struct {
 	IncomingReferences []RefMeta
 	// The 0-based index of the primary key column
 	PkeyColIdx int
+	// The unique indexes on the table other than the primary key
+	UniqueIndexes []UniqueIndex
+	// All the unique indexes on the table, for upsert conflict targets
+	ConflictIndexes []ConflictIndex
 }
 
 // ColMeta contains metadata about postgres table columns such column
@@ -673,7 +804,10 @@ func (tr *tableResolver) tableInfo(table *config.TableConfig) (PgTableInfo, erro
 		}
 		col.TypeInfo = *typeInfo
 		col.TableName = table.Name
-		col.GoName = names.PgToGoName(col.PgName)
+		col.GoName = table.ColumnGoNames[col.PgName]
+		if col.GoName == "" {
+			col.GoName = tr.goNames.PgToGoName(col.PgName)
+		}
 		col.IsMutable = slices.Contains(table.MutableFields, col.PgName)
 		cols = append(cols, col)
 	}
@@ -699,17 +833,49 @@ func (tr *tableResolver) tableInfo(table *config.TableConfig) (PgTableInfo, erro
 		}
 	}
 
-	goName := names.PgTableToGoModel(table.Name)
+	for colName := range table.ColumnGoNames {
+		found := false
+		for _, col := range cols {
+			if col.PgName == colName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return PgTableInfo{}, fmt.Errorf(
+				"column_go_names: column '%s' is not part of table '%s'",
+				colName,
+				table.Name,
+			)
+		}
+	}
+
+	uniqueIndexes, err := tr.uniqueIndexes(tableName, cols)
+	if err != nil {
+		return PgTableInfo{}, fmt.Errorf("reading unique indexes: %s", err.Error())
+	}
+
+	conflictIndexes, err := tr.conflictIndexes(tableName, cols)
+	if err != nil {
+		return PgTableInfo{}, fmt.Errorf("reading conflict targets: %s", err.Error())
+	}
+
+	goName := table.GoName
+	if goName == "" {
+		goName = tr.goNames.PgTableToGoModel(table.Name)
+	}
 	return PgTableInfo{
 		PgName: tableName.String(),
 		GoName: goName,
 		// we pluralize `goName` rather than just converting `table` to PascalCase
 		// to better handle tables from non-public schemas (the schema/table boundary
 		// would not end up captalized if we just use `names.PgToGoName`)
-		PluralGoName: inflection.Plural(goName),
-		PkeyCol:      pkeyCol,
-		PkeyColIdx:   pkeyColIdx,
-		Cols:         cols,
+		PluralGoName:    inflection.Plural(goName),
+		PkeyCol:         pkeyCol,
+		PkeyColIdx:      pkeyColIdx,
+		Cols:            cols,
+		UniqueIndexes:   uniqueIndexes,
+		ConflictIndexes: conflictIndexes,
 	}, nil
 }
 
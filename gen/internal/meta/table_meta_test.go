@@ -0,0 +1,178 @@
+package meta
+
+import (
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/log"
+)
+
+func TestTableWithCols(t *testing.T) {
+	cols := func(specs ...string) []ColMeta {
+		res := make([]ColMeta, 0, len(specs)/2)
+		for i := 0; i < len(specs); i += 2 {
+			res = append(res, ColMeta{PgName: specs[i], PgType: specs[i+1]})
+		}
+		return res
+	}
+
+	tr := newTableResolver(nil, nil, nil, nil)
+	tr.meta.tableInfo = map[string]*TableMeta{
+		"users": {Info: PgTableInfo{
+			PgName: "users",
+			Cols:   cols("id", "bigint", "email", "text"),
+		}},
+		"orgs": {Info: PgTableInfo{
+			PgName: "orgs",
+			Cols:   cols("id", "bigint", "name", "text"),
+		}},
+		"orgs_archive": {Info: PgTableInfo{
+			PgName: "orgs_archive",
+			Cols:   cols("id", "bigint", "name", "text"),
+		}},
+	}
+
+	type testCase struct {
+		cols     []ColMeta
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			cols:     cols("id", "bigint", "email", "text"),
+			expected: "users",
+		},
+		{
+			// order matters
+			cols:     cols("email", "text", "id", "bigint"),
+			expected: "",
+		},
+		{
+			// types matter
+			cols:     cols("id", "integer", "email", "text"),
+			expected: "",
+		},
+		{
+			cols:     cols("id", "bigint"),
+			expected: "",
+		},
+		{
+			// ambiguous
+			cols:     cols("id", "bigint", "name", "text"),
+			expected: "",
+		},
+	}
+
+	for i, c := range cases {
+		actual := ""
+		if table := tr.tableWithCols(c.cols); table != nil {
+			actual = table.Info.PgName
+		}
+		if actual != c.expected {
+			t.Fatalf("case %d: expected '%s', got '%s'", i, c.expected, actual)
+		}
+	}
+}
+
+func TestSetVersionFlags(t *testing.T) {
+	type testCase struct {
+		versionField string
+		cols         []ColMeta
+		has          bool
+	}
+	cases := []testCase{
+		{
+			versionField: "version",
+			cols:         []ColMeta{{PgName: "version", GoName: "Version", PgType: "bigint"}},
+			has:          true,
+		},
+		{
+			versionField: "version",
+			cols:         []ColMeta{{PgName: "version", GoName: "Version", PgType: "integer", Nullable: true}},
+			has:          false,
+		},
+		{
+			versionField: "version",
+			cols:         []ColMeta{{PgName: "version", GoName: "Version", PgType: "text"}},
+			has:          false,
+		},
+		{
+			versionField: "version",
+			cols:         []ColMeta{{PgName: "lock_version", GoName: "LockVersion", PgType: "integer"}},
+			has:          false,
+		},
+		{
+			versionField: "",
+			cols:         []ColMeta{{PgName: "version", GoName: "Version", PgType: "integer"}},
+			has:          false,
+		},
+	}
+
+	tr := &tableResolver{log: log.NewLogger(-1)}
+	for i, c := range cases {
+		meta := &TableMeta{
+			Config: &config.TableConfig{Name: "foo", VersionField: c.versionField},
+			Info:   PgTableInfo{Cols: c.cols},
+		}
+		tr.setVersionFlags(meta)
+		if meta.HasVersionField != c.has {
+			t.Fatalf("case %d: expected HasVersionField = %t", i, c.has)
+		}
+		if c.has && (meta.PgVersionField != c.versionField || meta.GoVersionField != c.cols[0].GoName) {
+			t.Fatalf("case %d: bad version field names: %s, %s", i, meta.PgVersionField, meta.GoVersionField)
+		}
+	}
+}
+
+func TestPopulateFieldTags(t *testing.T) {
+	type testCase struct {
+		fieldTags        []config.FieldTag
+		patternFieldTags []config.FieldTag
+		emailTags        string
+		err              string
+	}
+	cases := []testCase{
+		{
+			// pattern tags for columns the table doesn't have are skipped
+			patternFieldTags: []config.FieldTag{
+				{ColumnName: "email", Tags: `pii:"true"`},
+				{ColumnName: "ssn", Tags: `pii:"true"`},
+			},
+			emailTags: `gorm:"column:email" json:"email" pii:"true"`,
+		},
+		{
+			// table tags take precedence over pattern tags
+			fieldTags:        []config.FieldTag{{ColumnName: "email", Tags: `pii:"false"`}},
+			patternFieldTags: []config.FieldTag{{ColumnName: "email", Tags: `pii:"true"`}},
+			emailTags:        `gorm:"column:email" json:"email" pii:"false"`,
+		},
+		{
+			fieldTags: []config.FieldTag{{ColumnName: "ssn", Tags: `pii:"true"`}},
+			err:       "column 'ssn' is not part of table 'users'",
+		},
+	}
+
+	for i, c := range cases {
+		meta := &TableMeta{
+			Config: &config.TableConfig{
+				Name:             "users",
+				FieldTags:        c.fieldTags,
+				PatternFieldTags: c.patternFieldTags,
+			},
+			Info: PgTableInfo{Cols: []ColMeta{{PgName: "email", GoName: "Email"}}},
+		}
+		err := populateFieldTags(meta)
+		if err != nil {
+			if err.Error() != c.err {
+				t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if c.err != "" {
+			t.Fatalf("case %d: expected error '%s'", i, c.err)
+		}
+		if meta.Info.Cols[0].Tags != c.emailTags {
+			t.Fatalf("case %d: expected tags '%s', got '%s'", i, c.emailTags, meta.Info.Cols[0].Tags)
+		}
+	}
+}
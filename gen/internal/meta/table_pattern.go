@@ -0,0 +1,194 @@
+package meta
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/log"
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// ExpandTablePatterns appends a table config to `conf.Tables` for every table
+// in the database that is matched by one of the `[[table_pattern]]` blocks
+// in the config and is not already listed explicitly. It must be called before
+// the config is normalized so that the global timestamp settings still apply to
+// the new tables.
+func (r *Resolver) ExpandTablePatterns(conf *config.DbConfig) error {
+	if len(conf.TablePatterns) == 0 {
+		return nil
+	}
+
+	schemaTables := map[string][]string{}
+	for _, pat := range conf.TablePatterns {
+		schema := patternSchema(&pat)
+		if _, ok := schemaTables[schema]; ok {
+			continue
+		}
+
+		tables, err := r.tablesInSchema(schema)
+		if err != nil {
+			return fmt.Errorf("listing tables in schema '%s': %s", schema, err.Error())
+		}
+		schemaTables[schema] = tables
+	}
+
+	return expandTablePatterns(r.tableResolver.log, conf, schemaTables)
+}
+
+// tablesInSchema lists the names of all the tables in the given schema in
+// alphabetical order.
+func (r *Resolver) tablesInSchema(schema string) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace ns
+			ON (c.relnamespace = ns.oid)
+		WHERE ns.nspname = $1
+		  AND c.relkind IN ('r', 'p')
+		ORDER BY c.relname
+		`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+// expandTablePatterns does the work of `ExpandTablePatterns` given a mapping from
+// schema names to the tables in each schema.
+func expandTablePatterns(
+	l *log.Logger,
+	conf *config.DbConfig,
+	schemaTables map[string][]string,
+) error {
+	// maps the tables with their own [[table]] block to their index in conf.Tables
+	explicit := map[string]int{}
+	for i, table := range conf.Tables {
+		name, err := names.ParsePgName(table.Name)
+		if err != nil {
+			return err
+		}
+		explicit[name.String()] = i
+	}
+	seen := map[string]bool{}
+
+	for i, pat := range conf.TablePatterns {
+		schema := patternSchema(&pat)
+
+		include := pat.Include
+		if include == "" {
+			include = "*"
+		}
+		includeMatcher, err := compileTablePattern(include)
+		if err != nil {
+			return fmt.Errorf("table_pattern %d: include: %s", i, err.Error())
+		}
+		excludeMatchers := make([]func(string) bool, 0, len(pat.Exclude))
+		for _, exclude := range pat.Exclude {
+			m, err := compileTablePattern(exclude)
+			if err != nil {
+				return fmt.Errorf("table_pattern %d: exclude: %s", i, err.Error())
+			}
+			excludeMatchers = append(excludeMatchers, m)
+		}
+
+		matched := 0
+	tableLoop:
+		for _, table := range schemaTables[schema] {
+			if !includeMatcher(table) {
+				continue
+			}
+			for _, excluded := range excludeMatchers {
+				if excluded(table) {
+					continue tableLoop
+				}
+			}
+			matched++
+
+			name := names.PgName{Schema: schema, Name: table}
+			if seen[name.String()] {
+				// picked up by an earlier pattern
+				continue
+			}
+			seen[name.String()] = true
+
+			if idx, ok := explicit[name.String()]; ok {
+				applyTablePattern(&conf.Tables[idx], &pat)
+				continue
+			}
+			tableConf := config.TableConfig{Name: name.String()}
+			applyTablePattern(&tableConf, &pat)
+			conf.Tables = append(conf.Tables, tableConf)
+		}
+
+		if matched == 0 {
+			l.Warnf("table_pattern %d: no tables in schema '%s' matched '%s'\n", i, schema, include)
+		}
+	}
+
+	return nil
+}
+
+// applyTablePattern fills in the settings that the given pattern supplies for a
+// table it matched. Settings which the table config already has are left alone,
+// so an explicit [[table]] block overrides the pattern one field at a time.
+func applyTablePattern(table *config.TableConfig, pat *config.TablePattern) {
+	if table.CreatedAtField == "" {
+		table.CreatedAtField = pat.CreatedAtField
+	}
+	if table.UpdatedAtField == "" {
+		table.UpdatedAtField = pat.UpdatedAtField
+	}
+	if table.DeletedAtField == "" {
+		table.DeletedAtField = pat.DeletedAtField
+	}
+	if table.VersionField == "" {
+		table.VersionField = pat.VersionField
+	}
+	table.BoxResults = table.BoxResults || pat.BoxResults
+	table.NoInferBelongsTo = table.NoInferBelongsTo || pat.NoInferBelongsTo
+	table.PatternFieldTags = pat.FieldTags
+}
+
+func patternSchema(pat *config.TablePattern) string {
+	if pat.Schema == "" {
+		return "public"
+	}
+	return pat.Schema
+}
+
+// compileTablePattern converts a glob or a regular expression wrapped in slashes
+// into a function which tests table names against it. Regular expressions must
+// match the whole table name.
+func compileTablePattern(pat string) (func(string) bool, error) {
+	if len(pat) >= 2 && strings.HasPrefix(pat, "/") && strings.HasSuffix(pat, "/") {
+		re, err := regexp.Compile("^(?:" + pat[1:len(pat)-1] + ")$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	_, err := path.Match(pat, "")
+	if err != nil {
+		return nil, fmt.Errorf("bad glob '%s': %s", pat, err.Error())
+	}
+	return func(table string) bool {
+		matched, _ := path.Match(pat, table)
+		return matched
+	}, nil
+}
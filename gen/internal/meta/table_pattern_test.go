@@ -0,0 +1,147 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/log"
+)
+
+func TestExpandTablePatterns(t *testing.T) {
+	type testCase struct {
+		tables   []config.TableConfig
+		patterns []config.TablePattern
+		expected []config.TableConfig
+		err      string
+	}
+
+	schemaTables := map[string][]string{
+		"public":  {"schema_migrations", "users", "users_tmp"},
+		"billing": {"charges", "invoices", "invoices_tmp"},
+	}
+
+	cases := []testCase{
+		{
+			patterns: []config.TablePattern{
+				{Exclude: []string{"*_tmp", "schema_migrations"}},
+			},
+			expected: []config.TableConfig{
+				{Name: "users"},
+			},
+		},
+		{
+			patterns: []config.TablePattern{
+				{Schema: "billing", Include: "*", BoxResults: true},
+			},
+			expected: []config.TableConfig{
+				{Name: "billing.charges", BoxResults: true},
+				{Name: "billing.invoices", BoxResults: true},
+				{Name: "billing.invoices_tmp", BoxResults: true},
+			},
+		},
+		{
+			patterns: []config.TablePattern{
+				{Schema: "billing", Include: "/inv.*/", Exclude: []string{"/.*_tmp/"}},
+			},
+			expected: []config.TableConfig{
+				{Name: "billing.invoices"},
+			},
+		},
+		{
+			// explicit table blocks override the pattern field by field
+			tables: []config.TableConfig{
+				{Name: "billing.charges", CreatedAtField: "made_at"},
+			},
+			patterns: []config.TablePattern{
+				{
+					Schema:         "billing",
+					Include:        "c*",
+					CreatedAtField: "created_at",
+					UpdatedAtField: "updated_at",
+					VersionField:   "version",
+					BoxResults:     true,
+				},
+			},
+			expected: []config.TableConfig{
+				{
+					Name:           "billing.charges",
+					CreatedAtField: "made_at",
+					UpdatedAtField: "updated_at",
+					VersionField:   "version",
+					BoxResults:     true,
+				},
+			},
+		},
+		{
+			// explicit table blocks are matched by their normalized names
+			tables: []config.TableConfig{
+				{Name: `"users"`, DeletedAtField: "removed_at"},
+			},
+			patterns: []config.TablePattern{
+				{Include: "users", DeletedAtField: "deleted_at"},
+			},
+			expected: []config.TableConfig{
+				{Name: `"users"`, DeletedAtField: "removed_at"},
+			},
+		},
+		{
+			patterns: []config.TablePattern{
+				{
+					Include:   "users",
+					FieldTags: []config.FieldTag{{ColumnName: "email", Tags: `pii:"true"`}},
+				},
+			},
+			expected: []config.TableConfig{
+				{
+					Name:             "users",
+					PatternFieldTags: []config.FieldTag{{ColumnName: "email", Tags: `pii:"true"`}},
+				},
+			},
+		},
+		{
+			// the first pattern to match a table wins
+			patterns: []config.TablePattern{
+				{Include: "users", DeletedAtField: "deleted_at"},
+				{Include: "user*"},
+			},
+			expected: []config.TableConfig{
+				{Name: "users", DeletedAtField: "deleted_at"},
+				{Name: "users_tmp"},
+			},
+		},
+		{
+			patterns: []config.TablePattern{
+				{Include: "[users"},
+			},
+			err: "table_pattern 0: include: bad glob '[users': syntax error in pattern",
+		},
+		{
+			patterns: []config.TablePattern{
+				{Exclude: []string{"/(/"}},
+			},
+			err: "table_pattern 0: exclude: error parsing regexp: missing closing ): `^(?:()$`",
+		},
+	}
+
+	for i, c := range cases {
+		conf := config.DbConfig{
+			Tables:        c.tables,
+			TablePatterns: c.patterns,
+		}
+		err := expandTablePatterns(log.NewLogger(-1), &conf, schemaTables)
+		if err != nil {
+			if err.Error() != c.err {
+				t.Fatalf("case %d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if c.err != "" {
+			t.Fatalf("case %d: expected error '%s'", i, c.err)
+		}
+
+		if !reflect.DeepEqual(conf.Tables, c.expected) {
+			t.Fatalf("case %d: expected %v, got %v", i, c.expected, conf.Tables)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package meta
+
+import (
+	"fmt"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+// file: through.go
+// This file figures out the many-to-many relationships between tables which go
+// through a join table, both the explicitly configured `has_many_through` ones
+// and the ones inferred from pure join tables.
+
+// ThroughRefMeta describes a many-to-many relationship from one table to another
+// through a join table which has foreign keys pointing to both of them.
+type ThroughRefMeta struct {
+	// The table at the other end of the relationship
+	PointsTo *TableMeta
+	// The join table
+	Through *TableMeta
+	// The column in the join table which points to the table that has this reference
+	ThroughFromField *ColMeta
+	// The column in the join table which points to `PointsTo`
+	ThroughToField *ColMeta
+	// The name of the slice field in the generated struct
+	GoFieldName string
+	// The name of the relationship in include specs
+	PgFieldName string
+}
+
+// populateThroughReferences fills in the many-to-many relationships for all the
+// given tables. MUST be called after both the incoming and outgoing references
+// have been filled in.
+//
+// Mutates its argument
+func populateThroughReferences(
+	tables []config.TableConfig,
+	infoTab map[string]*TableMeta,
+	goNames *names.Converter,
+) error {
+	// a set of "<table> <join table>" pairs that have been configured explicitly
+	configured := map[string]bool{}
+
+	for _, table := range tables {
+		meta := infoTab[mustConfigPgNameToQuoted(table.Name)]
+
+		for _, hmt := range table.HasManyThrough {
+			if len(hmt.Table) == 0 {
+				return fmt.Errorf("%s: has_many_through requires 'table' key", table.Name)
+			}
+			if len(hmt.Through) == 0 {
+				return fmt.Errorf("%s: has_many_through requires 'through' key", table.Name)
+			}
+
+			other := infoTab[mustConfigPgNameToQuoted(hmt.Table)]
+			if other == nil {
+				return fmt.Errorf(
+					"%s: has_many_through: table '%s' is not registered",
+					table.Name,
+					hmt.Table,
+				)
+			}
+			through := infoTab[mustConfigPgNameToQuoted(hmt.Through)]
+			if through == nil {
+				return fmt.Errorf(
+					"%s: has_many_through: join table '%s' is not registered",
+					table.Name,
+					hmt.Through,
+				)
+			}
+
+			if meta.Info.PkeyCol == nil || other.Info.PkeyCol == nil {
+				return fmt.Errorf(
+					"%s: has_many_through: both ends of the relationship must have a primary key",
+					table.Name,
+				)
+			}
+
+			fromField, err := throughKeyField(through, meta, hmt.KeyField, nil)
+			if err != nil {
+				return fmt.Errorf("%s: has_many_through: key_field: %s", table.Name, err.Error())
+			}
+			toField, err := throughKeyField(through, other, hmt.OtherKeyField, fromField)
+			if err != nil {
+				return fmt.Errorf("%s: has_many_through: other_key_field: %s", table.Name, err.Error())
+			}
+
+			ref := ThroughRefMeta{
+				PointsTo:         other,
+				Through:          through,
+				ThroughFromField: fromField,
+				ThroughToField:   toField,
+				GoFieldName:      other.Info.PluralGoName,
+				PgFieldName:      other.Info.PgName,
+			}
+			if hmt.FieldName != "" {
+				ref.GoFieldName = goNames.PgToGoName(hmt.FieldName)
+				ref.PgFieldName = hmt.FieldName
+			}
+			meta.AllThroughReferences = append(meta.AllThroughReferences, ref)
+			configured[meta.Info.PgName+" "+through.Info.PgName] = true
+		}
+	}
+
+	// fill in the relationships through pure join tables that have not been
+	// configured explicitly
+	for _, table := range tables {
+		through := infoTab[mustConfigPgNameToQuoted(table.Name)]
+		refs, ok := joinTableReferences(through)
+		if !ok {
+			continue
+		}
+
+		for i, ref := range refs {
+			otherRef := refs[1-i]
+			meta := ref.PointsTo
+			if configured[meta.Info.PgName+" "+through.Info.PgName] {
+				continue
+			}
+
+			meta.AllThroughReferences = append(meta.AllThroughReferences, ThroughRefMeta{
+				PointsTo:         otherRef.PointsTo,
+				Through:          through,
+				ThroughFromField: ref.PointsFromField,
+				ThroughToField:   otherRef.PointsFromField,
+				GoFieldName:      otherRef.PointsTo.Info.PluralGoName,
+				PgFieldName:      otherRef.PointsTo.Info.PgName,
+			})
+		}
+	}
+
+	for _, meta := range infoTab {
+		disambiguateThroughReflist(meta)
+	}
+
+	return nil
+}
+
+// throughKeyField finds the column in a join table which points to the given
+// table, either by name or, if no name is given, by looking for the one
+// reference from the join table to the given table (other than `exclude`).
+func throughKeyField(through *TableMeta, to *TableMeta, name string, exclude *ColMeta) (*ColMeta, error) {
+	if name != "" {
+		for i := range through.Info.Cols {
+			if through.Info.Cols[i].PgName == name {
+				return &through.Info.Cols[i], nil
+			}
+		}
+		return nil, fmt.Errorf("table '%s' has no field '%s'", through.Info.PgName, name)
+	}
+
+	var found *ColMeta
+	for _, ref := range through.AllOutgoingReferences {
+		if ref.PointsTo != to || ref.PointsFromField == exclude {
+			continue
+		}
+		if found != nil && found != ref.PointsFromField {
+			return nil, fmt.Errorf(
+				"table '%s' has more than one reference to '%s', please name the one to use",
+				through.Info.PgName,
+				to.Info.PgName,
+			)
+		}
+		found = ref.PointsFromField
+	}
+	if found == nil {
+		return nil, fmt.Errorf(
+			"table '%s' has no reference to '%s'",
+			through.Info.PgName,
+			to.Info.PgName,
+		)
+	}
+	return found, nil
+}
+
+// joinTableReferences returns the two references out of the given table if it is
+// a pure join table. A pure join table has non-null foreign keys to two different
+// tables, and nothing else other than a primary key and the configured timestamp
+// and version fields.
+func joinTableReferences(meta *TableMeta) ([2]RefMeta, bool) {
+	var refs [2]RefMeta
+	if len(meta.AllOutgoingReferences) != 2 {
+		return refs, false
+	}
+	copy(refs[:], meta.AllOutgoingReferences)
+	if refs[0].PointsTo == refs[1].PointsTo ||
+		refs[0].PointsFromField == refs[1].PointsFromField ||
+		refs[0].OneToOne || refs[1].OneToOne {
+		return refs, false
+	}
+	for _, ref := range refs {
+		// the join table must point at the primary keys at both ends
+		pkey := ref.PointsTo.Info.PkeyCol
+		if pkey == nil || ref.PointsToField == nil || ref.PointsToField.PgName != pkey.PgName {
+			return refs, false
+		}
+	}
+
+	bookkeeping := map[string]bool{
+		meta.Config.CreatedAtField: true,
+		meta.Config.UpdatedAtField: true,
+		meta.Config.DeletedAtField: true,
+		meta.Config.VersionField:   true,
+	}
+	for i := range meta.Info.Cols {
+		col := &meta.Info.Cols[i]
+		switch {
+		case col == refs[0].PointsFromField || col == refs[1].PointsFromField:
+			if col.Nullable {
+				return refs, false
+			}
+		case i == meta.Info.PkeyColIdx && meta.Info.PkeyCol != nil:
+		case bookkeeping[col.PgName]:
+		default:
+			return refs, false
+		}
+	}
+
+	return refs, true
+}
+
+// disambiguateThroughReflist makes sure that the fields for the many-to-many
+// relationships of the given table don't collide with any of its other fields
+// by appending "Via<Join Table>" to any colliding names.
+func disambiguateThroughReflist(meta *TableMeta) {
+	goNames := map[string]bool{}
+	pgNames := map[string]bool{}
+	for _, col := range meta.Info.Cols {
+		goNames[col.GoName] = true
+	}
+	for _, ref := range meta.AllIncomingReferences {
+		goNames[ref.GoPointsFromFieldName] = true
+		pgNames[ref.PgPointsFromFieldName] = true
+	}
+	for _, ref := range meta.AllOutgoingReferences {
+		goNames[ref.GoPointsToFieldName] = true
+		pgNames[ref.PgPointsToFieldName] = true
+	}
+
+	for i := range meta.AllThroughReferences {
+		ref := &meta.AllThroughReferences[i]
+		if goNames[ref.GoFieldName] || pgNames[ref.PgFieldName] {
+			ref.GoFieldName += "Via" + ref.Through.Info.PluralGoName
+			ref.PgFieldName += "_via_" + ref.Through.Info.PgName
+		}
+		goNames[ref.GoFieldName] = true
+		pgNames[ref.PgFieldName] = true
+	}
+}
@@ -0,0 +1,200 @@
+package meta
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/names"
+)
+
+func TestPopulateThroughReferences(t *testing.T) {
+	newTable := func(pgName string, goName string, cols ...ColMeta) *TableMeta {
+		meta := &TableMeta{
+			Config: &config.TableConfig{Name: pgName, CreatedAtField: "created_at"},
+			Info: PgTableInfo{
+				PgName:       pgName,
+				GoName:       goName,
+				PluralGoName: goName + "s",
+				Cols:         append([]ColMeta{{PgName: "id", GoName: "ID"}}, cols...),
+			},
+		}
+		meta.Info.PkeyCol = &meta.Info.Cols[0]
+		return meta
+	}
+	reference := func(from *TableMeta, colIdx int, to *TableMeta) {
+		from.AllOutgoingReferences = append(from.AllOutgoingReferences, RefMeta{
+			PointsTo:        to,
+			PointsToField:   to.Info.PkeyCol,
+			PointsFrom:      from,
+			PointsFromField: &from.Info.Cols[colIdx],
+		})
+	}
+
+	users := newTable("users", "User", ColMeta{PgName: "tags", GoName: "Tags"})
+	groups := newTable("groups", "Group")
+	tags := newTable("tags", "Tag")
+	// a pure join table
+	userGroups := newTable(
+		"user_groups", "UserGroup",
+		ColMeta{PgName: "user_id", GoName: "UserID"},
+		ColMeta{PgName: "group_id", GoName: "GroupID"},
+		ColMeta{PgName: "created_at", GoName: "CreatedAt"},
+	)
+	reference(userGroups, 1, users)
+	reference(userGroups, 2, groups)
+	// a join table with extra data, which has to be configured explicitly
+	userTags := newTable(
+		"user_tags", "UserTag",
+		ColMeta{PgName: "user_id", GoName: "UserID"},
+		ColMeta{PgName: "tag_id", GoName: "TagID"},
+		ColMeta{PgName: "weight", GoName: "Weight"},
+	)
+	reference(userTags, 1, users)
+	reference(userTags, 2, tags)
+	// not a join table because one of the keys is nullable
+	maybeGroups := newTable(
+		"maybe_groups", "MaybeGroup",
+		ColMeta{PgName: "user_id", GoName: "UserID"},
+		ColMeta{PgName: "group_id", GoName: "GroupID", Nullable: true},
+	)
+	reference(maybeGroups, 1, users)
+	reference(maybeGroups, 2, groups)
+
+	metas := []*TableMeta{users, groups, tags, userGroups, userTags, maybeGroups}
+	infoTab := map[string]*TableMeta{}
+	var tables []config.TableConfig
+	for _, meta := range metas {
+		infoTab[meta.Info.PgName] = meta
+		tables = append(tables, *meta.Config)
+	}
+	tables[0].HasManyThrough = []config.HasManyThrough{
+		{Table: "tags", Through: "user_tags"},
+	}
+
+	err := populateThroughReferences(tables, infoTab, names.NewConverter([]string{"ID"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type refSummary struct {
+		GoFieldName, PgFieldName, Through, From, To string
+	}
+	summarize := func(refs []ThroughRefMeta) []refSummary {
+		var res []refSummary
+		for _, r := range refs {
+			res = append(res, refSummary{
+				GoFieldName: r.GoFieldName,
+				PgFieldName: r.PgFieldName,
+				Through:     r.Through.Info.PgName,
+				From:        r.ThroughFromField.PgName,
+				To:          r.ThroughToField.PgName,
+			})
+		}
+		return res
+	}
+
+	expected := map[*TableMeta][]refSummary{
+		users: {
+			// disambiguated because of the `tags` column
+			{"TagsViaUserTags", "tags_via_user_tags", "user_tags", "user_id", "tag_id"},
+			{"Groups", "groups", "user_groups", "user_id", "group_id"},
+		},
+		groups: {
+			{"Users", "users", "user_groups", "group_id", "user_id"},
+		},
+	}
+	for _, meta := range metas {
+		actual := summarize(meta.AllThroughReferences)
+		if !reflect.DeepEqual(actual, expected[meta]) {
+			t.Fatalf(
+				"%s: expected through references %v, got %v",
+				meta.Info.PgName,
+				expected[meta],
+				actual,
+			)
+		}
+	}
+}
+
+func TestPopulateThroughReferencesErrors(t *testing.T) {
+	users := &TableMeta{
+		Config: &config.TableConfig{Name: "users"},
+		Info:   PgTableInfo{PgName: "users", GoName: "User"},
+	}
+	users.Info.Cols = []ColMeta{{PgName: "id", GoName: "ID"}}
+	users.Info.PkeyCol = &users.Info.Cols[0]
+	friendships := &TableMeta{
+		Config: &config.TableConfig{Name: "friendships"},
+		Info:   PgTableInfo{PgName: "friendships", GoName: "Friendship"},
+	}
+	friendships.Info.Cols = []ColMeta{
+		{PgName: "id", GoName: "ID"},
+		{PgName: "user_id", GoName: "UserID"},
+		{PgName: "friend_id", GoName: "FriendID"},
+	}
+	friendships.Info.PkeyCol = &friendships.Info.Cols[0]
+	for _, i := range []int{1, 2} {
+		friendships.AllOutgoingReferences = append(friendships.AllOutgoingReferences, RefMeta{
+			PointsTo:        users,
+			PointsToField:   users.Info.PkeyCol,
+			PointsFrom:      friendships,
+			PointsFromField: &friendships.Info.Cols[i],
+		})
+	}
+	infoTab := map[string]*TableMeta{"users": users, "friendships": friendships}
+
+	cases := []struct {
+		hmt config.HasManyThrough
+		err string
+	}{
+		{
+			hmt: config.HasManyThrough{Through: "friendships"},
+			err: "users: has_many_through requires 'table' key",
+		},
+		{
+			hmt: config.HasManyThrough{Table: "users", Through: "follows"},
+			err: "users: has_many_through: join table 'follows' is not registered",
+		},
+		{
+			hmt: config.HasManyThrough{Table: "users", Through: "friendships"},
+			err: "users: has_many_through: key_field: table 'friendships' has more than one reference to 'users', please name the one to use",
+		},
+		{
+			hmt: config.HasManyThrough{Table: "users", Through: "friendships", KeyField: "nope"},
+			err: "users: has_many_through: key_field: table 'friendships' has no field 'nope'",
+		},
+	}
+
+	for _, c := range cases {
+		users.AllThroughReferences = nil
+		tables := []config.TableConfig{
+			{Name: "users", HasManyThrough: []config.HasManyThrough{c.hmt}},
+			{Name: "friendships"},
+		}
+		err := populateThroughReferences(tables, infoTab, names.NewConverter(nil))
+		if err == nil || err.Error() != c.err {
+			t.Fatalf("expected error '%s', got '%v'", c.err, err)
+		}
+	}
+
+	// naming the key field is enough to pick out the other one
+	users.AllThroughReferences = nil
+	tables := []config.TableConfig{
+		{Name: "users", HasManyThrough: []config.HasManyThrough{
+			{Table: "users", Through: "friendships", KeyField: "user_id", FieldName: "friends"},
+		}},
+		{Name: "friendships"},
+	}
+	err := populateThroughReferences(tables, infoTab, names.NewConverter(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users.AllThroughReferences) != 1 {
+		t.Fatalf("expected one through reference, got %d", len(users.AllThroughReferences))
+	}
+	ref := users.AllThroughReferences[0]
+	if ref.GoFieldName != "Friends" || ref.ThroughToField.PgName != "friend_id" {
+		t.Fatalf("unexpected through reference %s via %s", ref.GoFieldName, ref.ThroughToField.PgName)
+	}
+}
@@ -1,6 +1,7 @@
 package names
 
 import (
+	"go/token"
 	"strings"
 	"unicode"
 
@@ -14,41 +15,127 @@ import (
 // with a given stored function or prepared statement.
 //
 
+// DefaultInitialisms is the list of initialisms that pggen uses when the
+// `use_default_initialisms` config option is set. It is the same list
+// that golint uses.
+var DefaultInitialisms = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML", "HTTP",
+	"HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA",
+	"SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP", "UI", "UID", "UUID",
+	"URI", "URL", "UTF8", "VM", "XML", "XMPP", "XSRF", "XSS",
+}
+
+// Converter knows how to convert postgres names into go names. A nil
+// Converter is valid and behaves exactly like the package level
+// conversion functions.
+type Converter struct {
+	// A mapping from the lowercase version of each initialism to
+	// the way that it should be spelled in go code.
+	initialisms map[string]string
+}
+
+// NewConverter creates a Converter which will spell any snake_case word
+// that case-insensitively matches one of the given initialisms using the
+// spelling from the list.
+func NewConverter(initialisms []string) *Converter {
+	c := &Converter{initialisms: make(map[string]string, len(initialisms))}
+	for _, i := range initialisms {
+		c.initialisms[strings.ToLower(i)] = i
+	}
+	return c
+}
+
 func PgTableToGoModel(tableName string) string {
+	return (*Converter)(nil).PgTableToGoModel(tableName)
+}
+
+// Convert a postgres name (assumed to be snake_case)
+// to a PascalCaseName
+func PgToGoName(snakeName string) string {
+	return (*Converter)(nil).PgToGoName(snakeName)
+}
+
+func (c *Converter) PgTableToGoModel(tableName string) string {
 	parsed, err := ParsePgName(tableName)
 	if err != nil {
 		// fall back to treating the name as a single name
 		// not idea, but we want to keep this infallable
-		return PgToGoName(inflection.Singular(tableName))
+		return c.PgToGoName(inflection.Singular(tableName))
 	}
 
 	if parsed.Schema == "public" {
-		return PgToGoName(inflection.Singular(parsed.Name))
+		return c.PgToGoName(inflection.Singular(parsed.Name))
 	}
 
-	return PgToGoName(parsed.Schema) + "_" + PgToGoName(inflection.Singular(parsed.Name))
+	return c.PgToGoName(parsed.Schema) + "_" + c.PgToGoName(inflection.Singular(parsed.Name))
 }
 
 // Convert a postgres name (assumed to be snake_case)
-// to a PascalCaseName
-func PgToGoName(snakeName string) string {
-	needsUpper := true
-
+// to a PascalCaseName, spelling any initialisms the way
+// the converter was configured to.
+func (c *Converter) PgToGoName(snakeName string) string {
 	var res strings.Builder
-	for _, r := range snakeName {
-		if unicode.IsSpace(r) {
-			continue
-		} else if r == '_' {
-			needsUpper = true
-		} else if unicode.IsPunct(r) {
-			continue
-		} else if needsUpper {
-			res.WriteRune(unicode.ToUpper(r))
-			needsUpper = false
-		} else {
-			res.WriteRune(r)
+	for _, word := range strings.Split(snakeName, "_") {
+		var w strings.Builder
+		for _, r := range word {
+			if unicode.IsSpace(r) || unicode.IsPunct(r) {
+				continue
+			}
+			w.WriteRune(r)
 		}
+
+		res.WriteString(c.convertWord(w.String()))
 	}
 
 	return res.String()
 }
+
+func (c *Converter) convertWord(word string) string {
+	if len(word) == 0 {
+		return word
+	}
+
+	if c != nil {
+		lower := strings.ToLower(word)
+		if initialism, ok := c.initialisms[lower]; ok {
+			return initialism
+		}
+
+		// handle plural initialisms like `ids` -> `IDs`
+		if strings.HasSuffix(lower, "s") {
+			if initialism, ok := c.initialisms[lower[:len(lower)-1]]; ok {
+				return initialism + "s"
+			}
+		}
+	}
+
+	runes := []rune(word)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// GoArgName converts a PascalCase go name into a camelCase name suitable for
+// a function argument, lowercasing any leading initialism (so `OrgID` becomes
+// `orgID` and `URLPath` becomes `urlPath`). Names which would be go keywords
+// get an underscore appended.
+func GoArgName(goName string) string {
+	runes := []rune(goName)
+
+	nupper := 0
+	for nupper < len(runes) && unicode.IsUpper(runes[nupper]) {
+		nupper++
+	}
+	if nupper > 1 && nupper < len(runes) && unicode.IsLower(runes[nupper]) {
+		// the last upper case letter starts the next word
+		nupper--
+	}
+	for i := 0; i < nupper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	name := string(runes)
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
@@ -65,3 +65,112 @@ func TestPgTableToGoModel(t *testing.T) {
 		}
 	}
 }
+
+func TestConverterInitialisms(t *testing.T) {
+	type testCase struct {
+		src      string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			src:      "user_id",
+			expected: "UserID",
+		},
+		{
+			src:      "api_url",
+			expected: "APIURL",
+		},
+		{
+			src:      "user_ids",
+			expected: "UserIDs",
+		},
+		{
+			src:      "idle_timeout",
+			expected: "IdleTimeout",
+		},
+		{
+			src:      "uuid",
+			expected: "UUID",
+		},
+		{
+			src:      "utf8_name",
+			expected: "UTF8Name",
+		},
+	}
+
+	c := NewConverter(DefaultInitialisms)
+	for i, tc := range cases {
+		actual := c.PgToGoName(tc.src)
+		if actual != tc.expected {
+			t.Fatalf("case %d: expected '%s', got '%s'", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestConverterPgTableToGoModel(t *testing.T) {
+	type testCase struct {
+		src      string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			src:      "api_keys",
+			expected: "APIKey",
+		},
+		{
+			src:      "acl.ip_ranges",
+			expected: "ACL_IPRange",
+		},
+	}
+
+	c := NewConverter([]string{"API", "ACL", "IP"})
+	for i, tc := range cases {
+		actual := c.PgTableToGoModel(tc.src)
+		if actual != tc.expected {
+			t.Fatalf("%d: expected '%s', got '%s'", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestGoArgName(t *testing.T) {
+	type testCase struct {
+		src      string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			src:      "OrgId",
+			expected: "orgId",
+		},
+		{
+			src:      "OrgID",
+			expected: "orgID",
+		},
+		{
+			src:      "ID",
+			expected: "id",
+		},
+		{
+			src:      "URLPath",
+			expected: "urlPath",
+		},
+		{
+			src:      "Type",
+			expected: "type_",
+		},
+		{
+			src:      "email",
+			expected: "email",
+		},
+	}
+
+	for i, c := range cases {
+		actual := GoArgName(c.src)
+		if actual != c.expected {
+			t.Fatalf("case %d: expected '%s', got '%s'", i, c.expected, actual)
+		}
+	}
+}
@@ -23,7 +23,7 @@ func (r *Resolver) maybeEmitEnumType(
 	// if there are no variants, then it is not an enum
 	if len(variants) > 0 {
 		// PgTableToGoModel handles enums in non-public schemas a bit better than PgToGoName
-		goName := names.PgTableToGoModel(pgTypeName)
+		goName := r.goNames.PgTableToGoModel(pgTypeName)
 
 		typeInfo := Info{
 			Name:            goName,
@@ -51,7 +51,7 @@ func (r *Resolver) maybeEmitEnumType(
 
 		r.registerImport(`"database/sql/driver"`)
 
-		evs := variantsToEnumVars(variants)
+		evs := variantsToEnumVars(r.goNames, variants)
 
 		type enumGenCtx struct {
 			TypeName string
@@ -115,14 +115,14 @@ type enumVar struct {
 	Value  string
 }
 
-func variantsToEnumVars(variants []string) []enumVar {
+func variantsToEnumVars(goNames *names.Converter, variants []string) []enumVar {
 	varTab := map[string]bool{}
 	for _, v := range variants {
 		varTab[v] = true
 	}
 
 	var evs []enumVar
-	variantGoNames := enumValuesToGoNames(variants)
+	variantGoNames := enumValuesToGoNames(goNames, variants)
 	for i, v := range variants {
 		goName := variantGoNames[i]
 
@@ -135,16 +135,17 @@ func variantsToEnumVars(variants []string) []enumVar {
 	return evs
 }
 
-// given a set of enum values, generate valid go names that can be used to refer to them
-func enumValuesToGoNames(values []string) []string {
+// given a set of enum values, generate valid go names that can be used to refer to them,
+// spelling any configured initialisms the way 'goNames' does
+func enumValuesToGoNames(goNames *names.Converter, values []string) []string {
 	// First we iterate the list and perform a best-effort conversion.
 	// We strip out all the special chars and convert all spaces to underscores
-	// then run names.PgToGoName over it.
+	// then run goNames.PgToGoName over it.
 	varTab := map[string]bool{}
 	for _, v := range values {
 		varTab[v] = true
 	}
-	goNames := make([]string, 0, len(values))
+	variantNames := make([]string, 0, len(values))
 	for _, v := range values {
 		name := v
 		if v == "" {
@@ -165,16 +166,16 @@ func enumValuesToGoNames(values []string) []string {
 				goName.WriteRune(r)
 			}
 		}
-		goNames = append(goNames, names.PgToGoName(goName.String()))
+		variantNames = append(variantNames, goNames.PgToGoName(goName.String()))
 	}
 
 	// now we look for collisions and fixup any we find
 	seen := map[string]int{}
-	for i := range goNames {
-		name := goNames[i]
+	for i := range variantNames {
+		name := variantNames[i]
 		numSeen, inMap := seen[name]
 		if inMap {
-			goNames[i] = goNames[i] + strconv.Itoa(numSeen)
+			variantNames[i] = variantNames[i] + strconv.Itoa(numSeen)
 		} else {
 			numSeen = 0 // technically not needed because of zero values, but I just want to be explicit
 		}
@@ -182,7 +183,7 @@ func enumValuesToGoNames(values []string) []string {
 		seen[name] = numSeen + 1
 	}
 
-	return goNames
+	return variantNames
 }
 
 // Given the oid of a postgres type, return all the variants that
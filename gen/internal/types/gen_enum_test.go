@@ -3,12 +3,15 @@ package types
 import (
 	"reflect"
 	"testing"
+
+	"github.com/ferumlabs/pggen/gen/internal/names"
 )
 
 func TestEnumValuesToGoNames(t *testing.T) {
 	type testCase struct {
-		in  []string
-		out []string
+		in          []string
+		out         []string
+		initialisms []string
 	}
 	cases := []testCase{
 		{
@@ -23,10 +26,19 @@ func TestEnumValuesToGoNames(t *testing.T) {
 			in:  []string{"bar___ blip@@foo+"},
 			out: []string{"BarBlipfoo"},
 		},
+		{
+			in:          []string{"api_key", "user_id", "url"},
+			out:         []string{"APIKey", "UserID", "URL"},
+			initialisms: []string{"API", "ID", "URL"},
+		},
+		{
+			in:  []string{"api_key"},
+			out: []string{"ApiKey"},
+		},
 	}
 
 	for _, c := range cases {
-		actual := enumValuesToGoNames(c.in)
+		actual := enumValuesToGoNames(names.NewConverter(c.initialisms), c.in)
 		if !reflect.DeepEqual(actual, c.out) {
 			t.Fatalf("expected %v, got %v\n", c.out, actual)
 		}
@@ -66,6 +66,10 @@ type {{ .GoName }} struct {
 	{{- /* All outgoing references are 1-1, so we don't check the .OneToOne flag */}}
 	{{ .GoPointsToFieldName }} *{{ .PointsTo.Info.GoName }}
 	{{- end}}
+	{{- range .Meta.AllThroughReferences }}
+	{{ .GoFieldName }} []*{{ .PointsTo.Info.GoName }} ` +
+	"`" + `gorm:"many2many:{{ .Through.Info.PgName }}"` + "`" + `
+	{{- end }}
 }
 func (r *{{ .GoName }}) Scan(rs *sql.Rows) error {
 	// We assume that the columns coming in are ordered in the same way as defined in genTimeColIdxTabFor{{ .GoName }}.
@@ -81,6 +85,38 @@ func (r *{{ .GoName }}) Scan(rs *sql.Rows) error {
 		return err
 	}
 
+	r.fillFromNullableTgts(&nullableTgts)
+
+	return nil
+}
+
+// scanWithPosTab scans a row whose columns might not be in the order that they
+// were in at codegen-time. posTab maps run-time column indicies to codegen-time
+// column indicies, with -1 marking columns which did not exist at codegen-time.
+func (r *{{ .GoName }}) scanWithPosTab(rs *sql.Rows, posTab []int) error {
+	var nullableTgts nullableScanTgtsFor{{ .GoName }}
+
+	scanTgts := make([]interface{}, len(posTab))
+	for runIdx, genIdx := range posTab {
+		if genIdx == -1 {
+			// a column that was added after codegen, so just throw it away
+			scanTgts[runIdx] = new(interface{})
+		} else {
+			scanTgts[runIdx] = scannerTabFor{{ .GoName }}[genIdx](r, &nullableTgts)
+		}
+	}
+
+	err := rs.Scan(scanTgts...)
+	if err != nil {
+		return err
+	}
+
+	r.fillFromNullableTgts(&nullableTgts)
+
+	return nil
+}
+
+func (r *{{ .GoName }}) fillFromNullableTgts(nullableTgts *nullableScanTgtsFor{{ .GoName }}) {
 	{{- range .Meta.Info.Cols }}
 	{{- if .Nullable }}
 	r.{{ .GoName }} = {{ call .TypeInfo.NullConvertFunc (printf "nullableTgts.scan%s" .GoName) }}
@@ -88,8 +124,6 @@ func (r *{{ .GoName }}) Scan(rs *sql.Rows) error {
 	r.{{ .GoName }} = {{ printf "nullableTgts.scan%s" .GoName }}.Time
 	{{- end }}
 	{{- end }}
-
-	return nil
 }
 
 type nullableScanTgtsFor{{ .GoName }} struct {
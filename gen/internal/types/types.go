@@ -8,6 +8,7 @@ import (
 	"text/template"
 
 	"github.com/ferumlabs/pggen/gen/internal/config"
+	"github.com/ferumlabs/pggen/gen/internal/names"
 )
 
 type TableColumn struct {
@@ -29,6 +30,8 @@ type Resolver struct {
 	// A connection to the database we can use to get metadata about the
 	// schema.
 	db *sql.DB
+	// Used to convert postgres type names into go names
+	goNames *names.Converter
 }
 
 func NewResolver(db *sql.DB, registerImport func(string)) *Resolver {
@@ -46,6 +49,8 @@ func NewResolver(db *sql.DB, registerImport func(string)) *Resolver {
 //
 // This method _must_ be called before any other methods are called.
 func (r *Resolver) Resolve(conf *config.DbConfig) error {
+	r.goNames = names.NewConverter(conf.Initialisms)
+
 	colOverrides := make(map[TableColumn]config.ColTypeOverride)
 	for _, table := range conf.Tables {
 		for colName, override := range table.GoColTypeOverrides {
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NamedArg is an argument referenced by a named placeholder
+type NamedArg struct {
+	Name string
+	// True if the placeholder was written with a `?` suffix (as in `@email?`)
+	// to mark the argument as nullable
+	Nullable bool
+}
+
+// RewriteNamedArgs replaces named placeholders of the form `@name` or `:name`
+// in the given SQL with positional `$N` placeholders. Every use of the same
+// name gets the same `$N`, with numbers assigned in the order that names first
+// appear. It returns the rewritten query along with the arguments in order, or
+// a nil slice if the query does not use named placeholders.
+//
+// A placeholder directly followed by a `?` marks the argument as nullable. The
+// `?` is dropped from the rewritten query, so the jsonb `?` operator needs a space
+// between it and a placeholder on its left.
+//
+// Placeholders inside string literals, quoted identifiers, dollar quoted strings
+// and comments are left alone, as are `::` casts and postgres operators like
+// `@>` and `@@`. A `:name` directly following an identifier (as in an array
+// slice like `arr[lo:hi]`) is not treated as a placeholder either.
+func RewriteNamedArgs(query string) (string, []NamedArg, error) {
+	var (
+		out        strings.Builder
+		args       []NamedArg
+		argIdx     = map[string]int{}
+		positional = false
+	)
+
+	i := 0
+	for i < len(query) {
+		c := query[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				out.WriteString(query[i:])
+				i = len(query)
+				continue
+			}
+			end += i + 2
+			out.WriteString(query[i:end])
+			i = end
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i
+			}
+			out.WriteString(query[i:end])
+			i = end
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 4
+			}
+			out.WriteString(query[i:end])
+			i = end
+			continue
+		case c == '$':
+			j := i + 1
+			if j < len(query) && isDigit(query[j]) {
+				// a positional placeholder
+				for j < len(query) && isDigit(query[j]) {
+					j++
+				}
+				positional = true
+				out.WriteString(query[i:j])
+				i = j
+				continue
+			}
+
+			for j < len(query) && isIdentByte(query[j], j > i+1) {
+				j++
+			}
+			if j < len(query) && query[j] == '$' {
+				// a dollar quoted string
+				tag := query[i : j+1]
+				end := strings.Index(query[j+1:], tag)
+				if end < 0 {
+					end = len(query)
+				} else {
+					end += j + 1 + len(tag)
+				}
+				out.WriteString(query[i:end])
+				i = end
+				continue
+			}
+		case c == '@' || c == ':':
+			prevOk := i == 0 || !(isIdentByte(query[i-1], true) || query[i-1] == c)
+			if prevOk && i+1 < len(query) && isIdentByte(query[i+1], false) {
+				j := i + 1
+				for j < len(query) && isIdentByte(query[j], true) {
+					j++
+				}
+				name := query[i+1 : j]
+				nullable := j < len(query) && query[j] == '?'
+				if nullable {
+					j++
+				}
+
+				idx, seen := argIdx[name]
+				if !seen {
+					args = append(args, NamedArg{Name: name})
+					idx = len(args)
+					argIdx[name] = idx
+				}
+				if nullable {
+					args[idx-1].Nullable = true
+				}
+				fmt.Fprintf(&out, "$%d", idx)
+				i = j
+				continue
+			}
+		}
+
+		out.WriteByte(c)
+		i++
+	}
+
+	if len(args) == 0 {
+		return query, nil, nil
+	}
+	if positional {
+		return "", nil, fmt.Errorf("cannot mix named placeholders with $N placeholders")
+	}
+
+	return out.String(), args, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isIdentByte returns true if `c` can appear in an unquoted identifier.
+// Digits are only allowed if `digitOk` is true, since identifiers cannot
+// start with a digit.
+func isIdentByte(c byte, digitOk bool) bool {
+	return c == '_' ||
+		('a' <= c && c <= 'z') ||
+		('A' <= c && c <= 'Z') ||
+		c >= 0x80 ||
+		(digitOk && isDigit(c))
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -59,3 +60,66 @@ func TestNullOutArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestRewriteNamedArgs(t *testing.T) {
+	type testVec struct {
+		input    string
+		expected string
+		args     []NamedArg
+		err      string
+	}
+	vecs := []testVec{
+		{
+			input:    "SELECT * FROM users WHERE id = $1",
+			expected: "SELECT * FROM users WHERE id = $1",
+		},
+		{
+			input:    "SELECT * FROM users WHERE id = @user_id",
+			expected: "SELECT * FROM users WHERE id = $1",
+			args:     []NamedArg{{Name: "user_id"}},
+		},
+		{
+			input:    "SELECT * FROM users WHERE org_id = :org AND (id = :id OR parent_id = :id)",
+			expected: "SELECT * FROM users WHERE org_id = $1 AND (id = $2 OR parent_id = $2)",
+			args:     []NamedArg{{Name: "org"}, {Name: "id"}},
+		},
+		{
+			input:    "SELECT :a::text, tags @> @tags, doc @@ @q, arr[lo:hi] FROM t",
+			expected: "SELECT $1::text, tags @> $2, doc @@ $3, arr[lo:hi] FROM t",
+			args:     []NamedArg{{Name: "a"}, {Name: "tags"}, {Name: "q"}},
+		},
+		{
+			input:    `SELECT ':a', "@b", $$ :c $$, $tag$ @d $tag$ -- :e` + "\n/* @f */ FROM t WHERE x = @g",
+			expected: `SELECT ':a', "@b", $$ :c $$, $tag$ @d $tag$ -- :e` + "\n/* @f */ FROM t WHERE x = $1",
+			args:     []NamedArg{{Name: "g"}},
+		},
+		{
+			input:    "SELECT * FROM users WHERE (@email? IS NULL OR email = @email) AND doc ? @key AND org = :org",
+			expected: "SELECT * FROM users WHERE ($1 IS NULL OR email = $1) AND doc ? $2 AND org = $3",
+			args:     []NamedArg{{Name: "email", Nullable: true}, {Name: "key"}, {Name: "org"}},
+		},
+		{
+			input: "SELECT * FROM t WHERE a = $1 AND b = @b",
+			err:   "cannot mix named placeholders with $N placeholders",
+		},
+	}
+
+	for i, v := range vecs {
+		actual, args, err := RewriteNamedArgs(v.input)
+		if err != nil {
+			if err.Error() != v.err {
+				t.Fatalf("vec %d: unexpected error: %s", i, err.Error())
+			}
+			continue
+		}
+		if v.err != "" {
+			t.Fatalf("vec %d: expected error '%s'", i, v.err)
+		}
+		if actual != v.expected {
+			t.Fatalf("vec %d: expected '%s', got '%s'", i, v.expected, actual)
+		}
+		if !reflect.DeepEqual(args, v.args) {
+			t.Fatalf("vec %d: expected args %v, got %v", i, v.args, args)
+		}
+	}
+}
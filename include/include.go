@@ -40,18 +40,39 @@
 // `sales` table referred to the users table with the name `customer`, an include
 // spec for pulling customer data would look like `sales.customer->users`.
 //
+// Loading every record along a 1-* or *-* relationship is not always what you want,
+// so each table in an include spec can be followed by a bracketed list of options
+// which control the records loaded for it. `order=` takes a comma separated list of
+// columns, each optionally followed by `asc` or `desc`, `limit=` takes the maximum
+// number of records to load for each parent record, and `where=` takes either the
+// name of a boolean column or a SQL condition in single quotes. For example, the
+// spec `users.posts[order=created_at desc, limit=20, where=published]` loads the
+// 20 most recent published posts of each user, and
+// `users.posts[where='word_count > 1000']` loads the long ones. A record has at most
+// one parent along a *-1 relationship, such as `posts.users`, so only `where=` may
+// be used there; loading a spec with `order=` or `limit=` on such a table fails.
+//
 // More formally, the grammar for include specs is:
 //
-// spec ::= id
-//        | id '.' inner_spec
-//        | id '.' '{' spec_list '}'
-// inner_spec ::= id
-//        | rename_or_id '.' inner_spec
-//        | rename_or_id '.' '{' spec_list '}'
+// spec ::= id options
+//        | id options '.' inner_spec
+//        | id options '.' '{' spec_list '}'
+// inner_spec ::= rename_or_id options
+//        | rename_or_id options '.' inner_spec
+//        | rename_or_id options '.' '{' spec_list '}'
 // rename_or_id ::= id '->' id
 //                | id
 // spec_list ::= inner_spec
 //             | inner_spec ',' inner_spec
+// options ::= ''
+//           | '[' option_list ']'
+// option_list ::= option
+//               | option ',' option_list
+// option ::= 'order' '=' order_list
+//          | 'limit' '=' integer
+//          | 'where' '=' (id | sql_string)
+// order_list ::= id ('asc' | 'desc' | '')
+//              | id ('asc' | 'desc' | '') ',' order_list
 //
 // Cyclic Include Specs:
 //
@@ -85,6 +106,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -96,6 +118,23 @@ type Spec struct {
 	TableName string
 	// All the child tables to fill in
 	Includes map[string]*Spec
+	// The order in which to load the records for this table
+	OrderBy []Order
+	// The maximum number of records to load for each parent record, or 0
+	// to load all of them
+	Limit int
+	// A SQL condition that the records to load must satisfy, or the empty
+	// string to load all of them
+	Where string
+}
+
+// Order is one of the columns that the records for a table in an include
+// spec are sorted by.
+type Order struct {
+	// The name of the column
+	Column string
+	// Whether to sort in descending order
+	Desc bool
 }
 
 func (s *Spec) String() string {
@@ -115,6 +154,56 @@ func Must(spec *Spec, err error) *Spec {
 	return spec
 }
 
+// Merge returns a spec which includes everything included by either `a` or `b`,
+// which must both be specs for the same table. Where both specs set the same
+// option, the one from `b` wins. Neither spec is modified, though the result may
+// share sub-specs with them. Merge is used by the generated include spec builders,
+// and cyclic specs are fine.
+func Merge(a *Spec, b *Spec) *Spec {
+	return mergeSpecs(a, b, map[[2]*Spec]*Spec{})
+}
+
+func mergeSpecs(a *Spec, b *Spec, merged map[[2]*Spec]*Spec) *Spec {
+	if a == b {
+		return a
+	}
+	if ret, inMap := merged[[2]*Spec{a, b}]; inMap {
+		return ret
+	}
+
+	ret := &Spec{
+		TableName: a.TableName,
+		OrderBy:   a.OrderBy,
+		Limit:     a.Limit,
+		Where:     a.Where,
+	}
+	merged[[2]*Spec{a, b}] = ret
+	if len(b.OrderBy) > 0 {
+		ret.OrderBy = b.OrderBy
+	}
+	if b.Limit != 0 {
+		ret.Limit = b.Limit
+	}
+	if b.Where != "" {
+		ret.Where = b.Where
+	}
+
+	if len(a.Includes) > 0 || len(b.Includes) > 0 {
+		ret.Includes = make(map[string]*Spec, len(a.Includes)+len(b.Includes))
+		for name, subSpec := range a.Includes {
+			ret.Includes[name] = subSpec
+		}
+		for name, subSpec := range b.Includes {
+			if aSubSpec, inA := ret.Includes[name]; inA {
+				subSpec = mergeSpecs(aSubSpec, subSpec, merged)
+			}
+			ret.Includes[name] = subSpec
+		}
+	}
+
+	return ret
+}
+
 // Parse an Spec from the given source string or an error on failure
 func Parse(src string) (spec *Spec, err error) {
 	specRef, idx, err := parseSpec(src, 0, false)
@@ -192,6 +281,11 @@ func parseSpec(src string, idx int, inner bool) (spec specReference, nextIdx int
 		spec.parentName = spec.subSpec.TableName
 	}
 
+	idx, err = parseOptions(src, idx, spec.subSpec)
+	if err != nil {
+		return
+	}
+
 	idx = skipWS(src, idx)
 	if idx >= len(src) || src[idx] != '.' {
 		// a bare identifier or rename expression is a valid include spec
@@ -364,6 +458,223 @@ func parseRenameOrID(src string, idx int) (
 	return
 }
 
+// parse: '[' option_list ']' | ''
+func parseOptions(src string, idx int, spec *Spec) (nextIdx int, err error) {
+	idx = skipWS(src, idx)
+	if idx >= len(src) || src[idx] != '[' {
+		// no options
+		nextIdx = idx
+		return
+	}
+
+	unexpectedEOI := func(i int) error {
+		return &parseError{
+			pos: i,
+			msg: "unexpected end of input while parsing options",
+		}
+	}
+
+	var (
+		seen = map[string]bool{}
+		key  string
+	)
+	idx++
+	for {
+		idx = skipWS(src, idx)
+		if idx >= len(src) {
+			err = unexpectedEOI(idx)
+			return
+		}
+
+		keyIdx := idx
+		key, idx, err = parseID(src, idx)
+		if err != nil {
+			return
+		}
+		idx = skipWS(src, idx)
+		if idx >= len(src) || src[idx] != '=' {
+			err = &parseError{
+				pos: idx,
+				msg: fmt.Sprintf("expected '=' after option '%s'", key),
+			}
+			return
+		}
+		if seen[key] {
+			err = &parseError{
+				pos: keyIdx,
+				msg: fmt.Sprintf("duplicate option '%s'", key),
+			}
+			return
+		}
+		seen[key] = true
+		idx = skipWS(src, idx+1)
+		if idx >= len(src) {
+			err = unexpectedEOI(idx)
+			return
+		}
+
+		switch key {
+		case "order":
+			spec.OrderBy, idx, err = parseOrderList(src, idx)
+		case "limit":
+			spec.Limit, idx, err = parseLimit(src, idx)
+		case "where":
+			spec.Where, idx, err = parseWhere(src, idx)
+		default:
+			err = &parseError{
+				pos: keyIdx,
+				msg: fmt.Sprintf("unknown option '%s'", key),
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		idx = skipWS(src, idx)
+		if idx >= len(src) {
+			err = unexpectedEOI(idx)
+			return
+		}
+		if src[idx] == ']' {
+			nextIdx = idx + 1
+			return
+		}
+		if src[idx] != ',' {
+			err = &parseError{
+				pos: idx,
+				msg: "expected ',' to separate options",
+			}
+			return
+		}
+		idx++
+	}
+}
+
+// parse: id ('asc' | 'desc' | '') (',' id ('asc' | 'desc' | ''))*
+//
+// A comma followed by an id and an '=' ends the list, since it begins
+// the next option.
+func parseOrderList(src string, idx int) (order []Order, nextIdx int, err error) {
+	for {
+		var o Order
+		o.Column, idx, err = parseID(src, idx)
+		if err != nil {
+			return
+		}
+
+		afterCol := skipWS(src, idx)
+		if afterCol < len(src) && src[afterCol] != '"' && src[afterCol] != ',' && src[afterCol] != ']' {
+			var dir string
+			dir, idx, err = parseID(src, afterCol)
+			if err != nil {
+				return
+			}
+			switch strings.ToLower(dir) {
+			case "asc":
+			case "desc":
+				o.Desc = true
+			default:
+				err = &parseError{
+					pos: afterCol,
+					msg: fmt.Sprintf("expected 'asc' or 'desc', got '%s'", dir),
+				}
+				return
+			}
+		}
+		order = append(order, o)
+
+		// look ahead to see if the list continues
+		next := skipWS(src, idx)
+		if next >= len(src) || src[next] != ',' {
+			nextIdx = idx
+			return
+		}
+		next = skipWS(src, next+1)
+		if next >= len(src) {
+			nextIdx = idx
+			return
+		}
+		_, afterID, idErr := parseID(src, next)
+		afterID = skipWS(src, afterID)
+		if idErr == nil && afterID < len(src) && src[afterID] == '=' {
+			// the start of the next option
+			nextIdx = idx
+			return
+		}
+		idx = next
+	}
+}
+
+// parse: [0-9]+
+func parseLimit(src string, idx int) (limit int, nextIdx int, err error) {
+	end := idx
+	for end < len(src) && '0' <= src[end] && src[end] <= '9' {
+		end++
+	}
+	if end == idx {
+		err = &parseError{
+			pos: idx,
+			msg: "expected a number after 'limit='",
+		}
+		return
+	}
+
+	limit, err = strconv.Atoi(src[idx:end])
+	if err != nil || limit == 0 {
+		err = &parseError{
+			pos: idx,
+			msg: fmt.Sprintf("bad limit '%s'", src[idx:end]),
+		}
+		return
+	}
+
+	nextIdx = end
+	return
+}
+
+// parse: id | '[^']*' (with '' standing for a single quote)
+//
+// A quoted identifier keeps its quotes, so that the result is always SQL.
+func parseWhere(src string, idx int) (where string, nextIdx int, err error) {
+	switch src[idx] {
+	case '\'':
+		var sql strings.Builder
+		for {
+			idx++
+			if idx >= len(src) {
+				err = &parseError{
+					pos: idx,
+					msg: "unexpected end of input in quoted condition",
+				}
+				return
+			}
+
+			if src[idx] == '\'' {
+				if idx+1 < len(src) && src[idx+1] == '\'' {
+					idx++
+					sql.WriteByte('\'')
+				} else {
+					where = sql.String()
+					nextIdx = idx + 1
+					return
+				}
+			} else {
+				sql.WriteByte(src[idx])
+			}
+		}
+	case '"':
+		start := idx
+		_, nextIdx, err = parseID(src, idx)
+		if err != nil {
+			return
+		}
+		where = src[start:nextIdx]
+		return
+	default:
+		return parseID(src, idx)
+	}
+}
+
 // parse: [a-zA-Z_][a-zA-Z0-9_$]* | "[^"]"
 func parseID(src string, idx int) (id string, nextIdx int, err error) {
 	// first, we'll see if we are dealing with a quoted identifier
@@ -458,6 +769,7 @@ func (s *Spec) writeToBuilder(b *strings.Builder, seen map[*Spec]bool, stop bool
 		// the table name.
 		writeIdent(b, s.TableName)
 	}
+	s.writeOptions(b)
 
 	if stop {
 		return
@@ -500,6 +812,42 @@ func (s *Spec) writeToBuilder(b *strings.Builder, seen map[*Spec]bool, stop bool
 	}
 }
 
+func (s *Spec) writeOptions(b *strings.Builder) {
+	if len(s.OrderBy) == 0 && s.Limit == 0 && s.Where == "" {
+		return
+	}
+
+	var opts []string
+	if len(s.OrderBy) > 0 {
+		var order strings.Builder
+		order.WriteString("order=")
+		for i, o := range s.OrderBy {
+			if i > 0 {
+				order.WriteByte(',')
+			}
+			writeIdent(&order, o.Column)
+			if o.Desc {
+				order.WriteString(" desc")
+			}
+		}
+		opts = append(opts, order.String())
+	}
+	if s.Limit != 0 {
+		opts = append(opts, "limit="+strconv.Itoa(s.Limit))
+	}
+	if s.Where != "" {
+		if unquotedIdentRE.MatchString(s.Where) {
+			opts = append(opts, "where="+s.Where)
+		} else {
+			opts = append(opts, "where='"+strings.ReplaceAll(s.Where, "'", "''")+"'")
+		}
+	}
+
+	b.WriteByte('[')
+	b.WriteString(strings.Join(opts, ","))
+	b.WriteByte(']')
+}
+
 func writeIdent(b *strings.Builder, ident string) {
 	if unquotedIdentRE.Match([]byte(ident)) {
 		b.WriteString(ident)
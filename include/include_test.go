@@ -1,6 +1,7 @@
 package include
 
 import (
+	"reflect"
 	"regexp"
 	"testing"
 )
@@ -108,6 +109,30 @@ func TestParseSuccess(t *testing.T) {
 		{
 			src: `"a.b".c`,
 		},
+		// options
+		{
+			src:    "users.posts[order=created_at desc, limit=20, where=published]",
+			result: "users.posts[order=created_at desc,limit=20,where=published]",
+		},
+		{
+			src:    "users.posts[ order = created_at DESC , id asc , title ]",
+			result: "users.posts[order=created_at desc,id,title]",
+		},
+		{
+			src:    "users.{posts[where='word_count > 1000 AND title <> ''x''', limit=3].comments,orgs}",
+			result: "users.{orgs,posts[limit=3,where='word_count > 1000 AND title <> ''x'''].comments}",
+		},
+		{
+			src:    `users.latest->posts[limit = 1, order="Created At" desc]`,
+			result: `users.latest->posts[order="Created At" desc,limit=1]`,
+		},
+		{
+			src: `users.posts[where='"Is Live"']`,
+		},
+		{
+			src:    `users[limit=1].posts`,
+			result: `users[limit=1].posts`,
+		},
 	}
 
 	for i, c := range cases {
@@ -184,6 +209,42 @@ func TestParseErrors(t *testing.T) {
 			src: `top_level->rename.bad`,
 			re:  "unexpected extra token begining with '-'",
 		},
+		{
+			src: "users.posts[",
+			re:  "unexpected end of input while parsing options",
+		},
+		{
+			src: "users.posts[limit]",
+			re:  "expected '=' after option 'limit'",
+		},
+		{
+			src: "users.posts[limit=1,limit=2]",
+			re:  "duplicate option 'limit'",
+		},
+		{
+			src: "users.posts[color=red]",
+			re:  "unknown option 'color'",
+		},
+		{
+			src: "users.posts[limit=x]",
+			re:  "expected a number after 'limit='",
+		},
+		{
+			src: "users.posts[limit=0]",
+			re:  "bad limit '0'",
+		},
+		{
+			src: "users.posts[order=id sideways]",
+			re:  "expected 'asc' or 'desc', got 'sideways'",
+		},
+		{
+			src: "users.posts[where='oops]",
+			re:  "unexpected end of input in quoted condition",
+		},
+		{
+			src: "users.posts[limit=1 where=x]",
+			re:  "expected ',' to separate options",
+		},
 	}
 
 	for i, c := range cases {
@@ -236,3 +297,114 @@ func TestCyclicIncludeSpec(t *testing.T) {
 		t.Fatalf("bad txt: %s", txt)
 	}
 }
+
+func TestParseOptions(t *testing.T) {
+	spec, err := Parse("users.posts[order=created_at desc, id, limit=20, where='NOT hidden']")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := spec.Includes["posts"]
+	expected := Spec{
+		TableName: "posts",
+		OrderBy:   []Order{{Column: "created_at", Desc: true}, {Column: "id"}},
+		Limit:     20,
+		Where:     "NOT hidden",
+	}
+	if !reflect.DeepEqual(*posts, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, *posts)
+	}
+
+	// make sure that the options survive a round trip through the textual form
+	reparsed, err := Parse(spec.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spec, reparsed) {
+		t.Fatalf("expected %#v, got %#v", spec, reparsed)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	type testCase struct {
+		a      string
+		b      string
+		result string
+	}
+
+	cases := []testCase{
+		{
+			a:      "foo",
+			b:      "foo",
+			result: "foo",
+		},
+		{
+			a:      "foo",
+			b:      "foo.bar",
+			result: "foo.bar",
+		},
+		{
+			a:      "foo.bar",
+			b:      "foo.baz",
+			result: "foo.{bar,baz}",
+		},
+		{
+			a:      "foo.bar.quux",
+			b:      "foo.{bar.blip,baz}",
+			result: "foo.{bar.{blip,quux},baz}",
+		},
+		{
+			a:      "foo.customer->users",
+			b:      "foo.customer->users.orgs",
+			result: "foo.customer->users.orgs",
+		},
+		{
+			a:      "foo.bar[order=id desc,limit=3]",
+			b:      "foo.bar[limit=5,where=visible]",
+			result: "foo.bar[order=id desc,limit=5,where=visible]",
+		},
+	}
+
+	for i, c := range cases {
+		a := Must(Parse(c.a))
+		b := Must(Parse(c.b))
+		aTxt, bTxt := a.String(), b.String()
+
+		merged := Merge(a, b)
+		if !reflect.DeepEqual(merged, Must(Parse(c.result))) {
+			t.Fatalf("case %d: expected %s, got %s", i, c.result, merged.String())
+		}
+
+		if a.String() != aTxt || b.String() != bTxt {
+			t.Fatalf("case %d: merge modified its arguments", i)
+		}
+	}
+}
+
+func TestMergeCyclic(t *testing.T) {
+	cyclic := Spec{
+		TableName: "foo",
+	}
+	cyclic.Includes = map[string]*Spec{
+		"bar": {
+			TableName: "bar",
+			Includes: map[string]*Spec{
+				"foo": &cyclic,
+			},
+		},
+	}
+
+	// this would never terminate if Merge followed the cycle
+	merged := Merge(&cyclic, Must(Parse("foo.{bar.foo,baz}")))
+	if merged.Includes["baz"] == nil {
+		t.Fatalf("missing baz: %s", merged.String())
+	}
+	if merged.Includes["bar"].Includes["foo"].Includes["bar"] == nil {
+		t.Fatalf("lost the cycle: %s", merged.String())
+	}
+
+	txt := cyclic.String()
+	if txt != "foo.bar.foo" {
+		t.Fatalf("merge modified its argument: %s", txt)
+	}
+}
@@ -0,0 +1,33 @@
+package pggen
+
+// lock.go defines the row lock strengths used by the generated
+// `Get<Entity>ForUpdate`, `List<Entity>ForUpdate` and `Claim<Entity>` methods
+
+// LockStrength is the kind of row level lock that a locking read takes.
+type LockStrength int
+
+const (
+	// FOR UPDATE, which blocks every other lock on the rows. This is the default.
+	LockForUpdate LockStrength = iota
+	// FOR NO KEY UPDATE, which still lets other transactions take the FOR KEY
+	// SHARE locks used by foreign key checks, so inserting records which
+	// reference the locked rows does not block
+	LockForNoKeyUpdate
+	// FOR SHARE, which lets other transactions read lock the rows as well but
+	// keeps them from modifying the rows
+	LockForShare
+)
+
+// String returns the SQL for the lock strength, as it appears after `FOR`.
+func (s LockStrength) String() string {
+	switch s {
+	case LockForUpdate:
+		return "UPDATE"
+	case LockForNoKeyUpdate:
+		return "NO KEY UPDATE"
+	case LockForShare:
+		return "SHARE"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,19 @@
+package pggen
+
+import (
+	"testing"
+)
+
+func TestLockStrengthString(t *testing.T) {
+	cases := map[LockStrength]string{
+		LockForUpdate:      "UPDATE",
+		LockForNoKeyUpdate: "NO KEY UPDATE",
+		LockForShare:       "SHARE",
+		-1:                 "unknown",
+	}
+	for strength, expected := range cases {
+		if strength.String() != expected {
+			t.Fatalf("expected '%s', got '%s'", expected, strength.String())
+		}
+	}
+}
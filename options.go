@@ -37,6 +37,7 @@ type UpsertOptions struct {
 	UsePkey           bool
 	DefaultFields     FieldSet
 	DisableTimestamps bool
+	ConflictTarget    ConflictTarget
 }
 
 // UpsertDisableTimestamps tells an upsert method to not
@@ -62,13 +63,32 @@ func UpsertDefaultFields(fieldSet FieldSet) UpsertOpt {
 	}
 }
 
+// UpsertConflictTarget tells an upsert method which unique index or constraint
+// to check for conflicting records, in place of the 'constraintNames' argument,
+// which must be left empty. Use one of the generated `<Entity>ConflictOn<Target>`
+// values.
+func UpsertConflictTarget(target ConflictTarget) UpsertOpt {
+	return func(opts *UpsertOptions) {
+		opts.ConflictTarget = target
+	}
+}
+
 type GetOpt func(opts *GetOptions)
 type GetOptions struct {
+	IncludeDeleted bool
+}
+
+// GetIncludeDeleted tells a get method to return the record even if it has
+// been soft deleted. If soft deletes have not been configured for the table
+// (via the `deleted_at_field` config key), this flag has no effect.
+func GetIncludeDeleted(opts *GetOptions) {
+	opts.IncludeDeleted = true
 }
 
 type ListOpt func(opts *ListOptions)
 type ListOptions struct {
 	SucceedOnPartialResults bool
+	IncludeDeleted          bool
 }
 
 // ListSucceedOnPartialResults tells a list method to not
@@ -77,9 +97,17 @@ func ListSucceedOnPartialResults(opts *ListOptions) {
 	opts.SucceedOnPartialResults = true
 }
 
+// ListIncludeDeleted tells a list method to also return records which have
+// been soft deleted. If soft deletes have not been configured for the table
+// (via the `deleted_at_field` config key), this flag has no effect.
+func ListIncludeDeleted(opts *ListOptions) {
+	opts.IncludeDeleted = true
+}
+
 type DeleteOpt func(opts *DeleteOptions)
 type DeleteOptions struct {
 	DoHardDelete bool
+	Where        []Predicate
 }
 
 // DeleteDoHardDelete tells a delete method to delete the data from the database
@@ -90,9 +118,21 @@ func DeleteDoHardDelete(opts *DeleteOptions) {
 	opts.DoHardDelete = true
 }
 
+// DeleteWhere tells a delete method to only delete records which satisfy all
+// of the given predicates. If any of the records do not, the delete method
+// returns an error for which IsNotFoundError is true, though the records that
+// did satisfy the predicates are still deleted unless the call is part of a
+// transaction which gets rolled back.
+func DeleteWhere(preds ...Predicate) DeleteOpt {
+	return func(opts *DeleteOptions) {
+		opts.Where = append(opts.Where, preds...)
+	}
+}
+
 type UpdateOpt func(opts *UpdateOptions)
 type UpdateOptions struct {
 	DisableTimestamps bool
+	Where             []Predicate
 }
 
 // UpdateDisableTimestamps tells an update method to not
@@ -101,6 +141,76 @@ func UpdateDisableTimestamps(opts *UpdateOptions) {
 	opts.DisableTimestamps = true
 }
 
+// UpdateWhere tells an update method to only update the record if it satisfies
+// all of the given predicates, which is handy for compare-and-swap style state
+// transitions. If the record does not, the update method returns an error for
+// which IsNotFoundError is true.
+func UpdateWhere(preds ...Predicate) UpdateOpt {
+	return func(opts *UpdateOptions) {
+		opts.Where = append(opts.Where, preds...)
+	}
+}
+
 type IncludeOpt func(opts *IncludeOptions)
 type IncludeOptions struct {
+	IncludeDeleted bool
+}
+
+// IncludeIncludeDeleted tells a fill includes method to also load records which
+// have been soft deleted, along with soft deleted links in the join tables of
+// many-to-many relationships. If soft deletes have not been configured for a
+// table (via the `deleted_at_field` config key), this flag has no effect on it.
+func IncludeIncludeDeleted(opts *IncludeOptions) {
+	opts.IncludeDeleted = true
+}
+
+type CountOpt func(opts *CountOptions)
+type CountOptions struct {
+	IncludeDeleted bool
+}
+
+// CountIncludeDeleted tells a count method to also count records which have
+// been soft deleted. If soft deletes have not been configured for the table
+// (via the `deleted_at_field` config key), this flag has no effect.
+func CountIncludeDeleted(opts *CountOptions) {
+	opts.IncludeDeleted = true
+}
+
+type ExistsOpt func(opts *ExistsOptions)
+type ExistsOptions struct {
+	IncludeDeleted bool
+}
+
+// ExistsIncludeDeleted tells an exists method to report records which have
+// been soft deleted as existing. If soft deletes have not been configured for
+// the table (via the `deleted_at_field` config key), this flag has no effect.
+func ExistsIncludeDeleted(opts *ExistsOptions) {
+	opts.IncludeDeleted = true
+}
+
+type LockOpt func(opts *LockOptions)
+type LockOptions struct {
+	Strength   LockStrength
+	NoWait     bool
+	SkipLocked bool
+}
+
+// LockWithStrength tells a locking method which kind of row lock to take.
+// By default, methods take FOR UPDATE locks.
+func LockWithStrength(strength LockStrength) LockOpt {
+	return func(opts *LockOptions) {
+		opts.Strength = strength
+	}
+}
+
+// LockNoWait tells a locking method to fail right away rather than wait
+// when one of the rows is already locked by another transaction.
+func LockNoWait(opts *LockOptions) {
+	opts.NoWait = true
+}
+
+// LockSkipLocked tells a locking method to leave out the rows which are
+// already locked by another transaction rather than wait for them.
+func LockSkipLocked(opts *LockOptions) {
+	opts.SkipLocked = true
 }
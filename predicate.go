@@ -0,0 +1,44 @@
+package pggen
+
+// predicate.go defines the extra conditions that can be attached to
+// generated update and delete methods to make them conditional
+
+// A Predicate is an extra condition that a record must satisfy, on top of
+// having the right primary key, for a conditional update or delete to apply
+// to it. Build them with the generated `<Entity><Field>Equals` functions, with
+// FieldEquals or with SQLPredicate and pass them to the UpdateWhere or
+// DeleteWhere options.
+type Predicate struct {
+	// The table that FieldIndex belongs to, for predicates built by the generated
+	// `<Entity><Field>Equals` functions. Using the predicate with a method for
+	// another table is an error.
+	Table string
+	// The index of the field to compare, for predicates built by FieldEquals
+	FieldIndex int
+	// The value the field must have, for predicates built by FieldEquals
+	Value interface{}
+	// The SQL for predicates built by SQLPredicate
+	SQL string
+	// The arguments for the placeholders in SQL
+	Args []interface{}
+}
+
+// FieldEquals returns a predicate that holds when the field with the given
+// index (one of the generated `<Entity><Field>FieldIndex` constants) has the
+// given value. A nil value matches NULL.
+//
+// Nothing checks that the index belongs to the entity being updated or that
+// the value has the right type, so prefer the generated `<Entity><Field>Equals`
+// functions, which do.
+func FieldEquals(fieldIndex int, value interface{}) Predicate {
+	return Predicate{FieldIndex: fieldIndex, Value: value}
+}
+
+// SQLPredicate returns a predicate made up of a raw SQL boolean expression.
+// The placeholders in `sql` are numbered from $1 no matter where the predicate
+// ends up in the generated statement, for example
+// `SQLPredicate("attempts < $1", maxAttempts)`. Placeholders inside string
+// literals get renumbered too, so pass such strings as arguments instead.
+func SQLPredicate(sql string, args ...interface{}) Predicate {
+	return Predicate{FieldIndex: -1, SQL: sql, Args: args}
+}
@@ -0,0 +1,209 @@
+package unstable
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ferumlabs/pggen/include"
+)
+
+// DO NOT USE. Called by generated code.
+//
+// IncludeEdge describes how the records along an edge of an include spec are
+// found: the table that they come from and how they are matched against the
+// keys of the records which include them.
+type IncludeEdge struct {
+	// The table that the included records come from, aliased as 't'
+	Table string
+	// The primary key of Table
+	PkeyCol string
+	// The columns of Table, in the order that they get scanned in
+	Cols []string
+	// The column which is matched against the keys of the including records.
+	// It is a column of Through if that is set, and of Table otherwise.
+	KeyCol string
+	// The column of Table which marks soft deleted records, if there is one
+	DeletedAtCol string
+	// The join table for *-* edges, aliased as 'j'
+	Through string
+	// The column of Through which refers to the primary key of Table
+	ThroughCol string
+	// The column of Through which marks soft deleted links, if there is one
+	ThroughDeletedAtCol string
+}
+
+// Query builds the query which loads the included records for a batch of keys,
+// which are passed as an array in $1. Each record is followed by the key that it
+// matched, selected as 'pggen_parent_id'. The order, limit and where options from
+// 'spec' (which may be nil) are applied, with limits applying to the records for
+// each key separately. A window function takes care of that so that the whole
+// batch still loads with a single query. Soft deleted records, and records which
+// are linked through soft deleted rows of the join table, are left out unless
+// 'includeDeleted' is set.
+func (e *IncludeEdge) Query(spec *include.Spec, includeDeleted bool) string {
+	var joins strings.Builder
+	parentID := "t." + quoteIdent(e.KeyCol)
+	if e.Through != "" {
+		parentID = "j." + quoteIdent(e.KeyCol)
+		joins.WriteString("JOIN ")
+		joins.WriteString(e.Through)
+		joins.WriteString(" j ON j.")
+		joins.WriteString(quoteIdent(e.ThroughCol))
+		joins.WriteString(" = t.")
+		joins.WriteString(quoteIdent(e.PkeyCol))
+		joins.WriteString(" ")
+	}
+	joins.WriteString("WHERE ")
+	joins.WriteString(parentID)
+	joins.WriteString(" = ANY($1)")
+	if !includeDeleted && e.DeletedAtCol != "" {
+		joins.WriteString(" AND t.")
+		joins.WriteString(quoteIdent(e.DeletedAtCol))
+		joins.WriteString(" IS NULL")
+	}
+	if !includeDeleted && e.ThroughDeletedAtCol != "" {
+		joins.WriteString(" AND j.")
+		joins.WriteString(quoteIdent(e.ThroughDeletedAtCol))
+		joins.WriteString(" IS NULL")
+	}
+
+	source := e.Table
+	if spec != nil && spec.Where != "" {
+		source = "(SELECT * FROM " + e.Table + " WHERE (" + spec.Where + "))"
+	}
+
+	var order strings.Builder
+	order.WriteString(" ORDER BY ")
+	if spec != nil {
+		for _, o := range spec.OrderBy {
+			order.WriteString("t." + quoteIdent(o.Column))
+			if o.Desc {
+				order.WriteString(" DESC")
+			}
+			order.WriteString(", ")
+		}
+	}
+	order.WriteString("t." + quoteIdent(e.PkeyCol))
+
+	innerCols := make([]string, 0, len(e.Cols)+1)
+	outerCols := make([]string, 0, len(e.Cols)+1)
+	for _, col := range e.Cols {
+		innerCols = append(innerCols, "t."+quoteIdent(col))
+		outerCols = append(outerCols, quoteIdent(col))
+	}
+	innerCols = append(innerCols, parentID+" AS pggen_parent_id")
+	outerCols = append(outerCols, "pggen_parent_id")
+
+	if spec == nil || spec.Limit <= 0 {
+		return "SELECT " + strings.Join(innerCols, ", ") + " FROM " + source + " t " + joins.String() + order.String()
+	}
+
+	return fmt.Sprintf(
+		"SELECT %s FROM (SELECT %s, row_number() OVER (PARTITION BY %s%s) AS pggen_rank FROM %s t %s) ranked WHERE pggen_rank <= %d ORDER BY pggen_parent_id, pggen_rank",
+		strings.Join(outerCols, ", "),
+		strings.Join(innerCols, ", "),
+		parentID,
+		order.String(),
+		source,
+		joins.String(),
+		spec.Limit,
+	)
+}
+
+func quoteIdent(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// DO NOT USE. Called by generated code.
+//
+// IncludeFill fills in the records along an edge of an include spec for a set of
+// records. P is the type of the including (parent) records, C the type of the
+// included (child) records, K the type of the keys that children are matched to
+// their parents by and CK the type of the primary key of C.
+type IncludeFill[P any, C any, K comparable, CK comparable] struct {
+	// Key returns the key that the children of 'parent' are matched against,
+	// or false if it can't have any
+	Key func(parent *P) (K, bool)
+	// Known returns the child for 'key' if it has already been loaded and
+	// doesn't have to be queried again. May be nil.
+	Known func(key K) (*C, bool)
+	// Query loads the children for a batch of keys, calling 'yield' for each
+	// child along with the key that it matched
+	Query func(keys []K, yield func(child C, key K)) error
+	// Pkey returns the primary key of a child
+	Pkey func(child *C) CK
+	// Attach adds a child to one of its parents
+	Attach func(parent *P, child *C)
+}
+
+// Fill loads the children of 'parents', querying for at most 'batchSize' keys
+// at once, and attaches them to their parents. Parents with the same key share
+// a single lookup. 'loaded' holds the records of type C which have already been
+// loaded while filling in the include spec. A child which is already there is
+// reused rather than loaded again, so that a record reachable along several
+// paths is shared between them, and new children are added to it. Returns the
+// children, each of them once.
+func (f *IncludeFill[P, C, K, CK]) Fill(
+	parents []*P,
+	loaded map[CK]*C,
+	batchSize int,
+) ([]*C, error) {
+	var (
+		keyToParents = make(map[K][]*P, len(parents))
+		keys         = make([]K, 0, len(parents))
+		seen         = map[CK]bool{}
+		children     = []*C{}
+	)
+	addChild := func(child *C) {
+		pkey := f.Pkey(child)
+		if !seen[pkey] {
+			seen[pkey] = true
+			children = append(children, child)
+		}
+	}
+
+	for _, parent := range parents {
+		key, hasKey := f.Key(parent)
+		if !hasKey {
+			continue
+		}
+		if f.Known != nil {
+			if child, known := f.Known(key); known {
+				f.Attach(parent, child)
+				addChild(child)
+				continue
+			}
+		}
+		if _, inMap := keyToParents[key]; !inMap {
+			keys = append(keys, key)
+		}
+		keyToParents[key] = append(keyToParents[key], parent)
+	}
+
+	if batchSize <= 0 {
+		batchSize = len(keys)
+	}
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		err := f.Query(keys[start:end], func(value C, key K) {
+			pkey := f.Pkey(&value)
+			child, inMap := loaded[pkey]
+			if !inMap {
+				child = &value
+				loaded[pkey] = child
+			}
+			addChild(child)
+			for _, parent := range keyToParents[key] {
+				f.Attach(parent, child)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return children, nil
+}
@@ -0,0 +1,305 @@
+package unstable
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ferumlabs/pggen/include"
+)
+
+type testParent struct {
+	id       int64
+	groupID  *int64
+	children []*testChild
+}
+
+type testChild struct {
+	id   int64
+	name string
+}
+
+func testFill(
+	query func(keys []int64, yield func(testChild, int64)) error,
+) *IncludeFill[testParent, testChild, int64, int64] {
+	return &IncludeFill[testParent, testChild, int64, int64]{
+		Key: func(parent *testParent) (id int64, ok bool) {
+			if parent.groupID == nil {
+				return id, false
+			}
+			return *parent.groupID, true
+		},
+		Query: query,
+		Pkey: func(child *testChild) int64 {
+			return child.id
+		},
+		Attach: func(parent *testParent, child *testChild) {
+			parent.children = append(parent.children, child)
+		},
+	}
+}
+
+func groupIDs(parents []*testParent) [][]int64 {
+	var res [][]int64
+	for _, parent := range parents {
+		var ids []int64
+		for _, child := range parent.children {
+			ids = append(ids, child.id)
+		}
+		res = append(res, ids)
+	}
+	return res
+}
+
+func TestIncludeFillBatches(t *testing.T) {
+	key := func(id int64) *int64 { return &id }
+	parents := []*testParent{
+		{id: 1, groupID: key(10)},
+		{id: 2, groupID: key(20)},
+		{id: 3, groupID: nil},
+		{id: 4, groupID: key(30)},
+		{id: 5, groupID: key(10)},
+		{id: 6, groupID: key(40)},
+		{id: 7, groupID: key(50)},
+	}
+
+	var batches [][]int64
+	fill := testFill(func(keys []int64, yield func(testChild, int64)) error {
+		batches = append(batches, append([]int64{}, keys...))
+		for _, key := range keys {
+			yield(testChild{id: key + 1}, key)
+		}
+		return nil
+	})
+
+	children, err := fill.Fill(parents, map[int64]*testChild{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// parents without a key are skipped and parents which share a key share
+	// a single lookup
+	expectedBatches := [][]int64{{10, 20}, {30, 40}, {50}}
+	if !reflect.DeepEqual(batches, expectedBatches) {
+		t.Fatalf("expected batches %v, got %v", expectedBatches, batches)
+	}
+	if len(children) != 5 {
+		t.Fatalf("expected 5 children, got %d", len(children))
+	}
+
+	expectedChildren := [][]int64{{11}, {21}, nil, {31}, {11}, {41}, {51}}
+	if actual := groupIDs(parents); !reflect.DeepEqual(actual, expectedChildren) {
+		t.Fatalf("expected children %v, got %v", expectedChildren, actual)
+	}
+	if parents[0].children[0] != parents[4].children[0] {
+		t.Fatal("expected parents with the same key to share their child")
+	}
+}
+
+func TestIncludeFillSharedRecords(t *testing.T) {
+	key := func(id int64) *int64 { return &id }
+	parents := []*testParent{
+		{id: 1, groupID: key(1)},
+		{id: 2, groupID: key(2)},
+	}
+
+	// record 100 was already loaded along another path
+	preloaded := &testChild{id: 100, name: "preloaded"}
+	loaded := map[int64]*testChild{100: preloaded}
+
+	// like a *-* edge, records 100 and 200 are linked to both parents
+	fill := testFill(func(keys []int64, yield func(testChild, int64)) error {
+		for _, key := range keys {
+			yield(testChild{id: 100, name: "fresh"}, key)
+			yield(testChild{id: 200, name: "fresh"}, key)
+		}
+		return nil
+	})
+
+	children, err := fill.Fill(parents, loaded, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 2 || children[0] != preloaded || children[1] != loaded[200] {
+		t.Fatalf("expected each child to be returned once, got %v", children)
+	}
+	for _, parent := range parents {
+		if len(parent.children) != 2 {
+			t.Fatalf("parent %d: expected 2 children, got %d", parent.id, len(parent.children))
+		}
+		if parent.children[0] != preloaded {
+			t.Fatalf("parent %d: expected the already loaded record to be reused", parent.id)
+		}
+		if parent.children[1] != loaded[200] {
+			t.Fatalf("parent %d: expected the new record to be shared", parent.id)
+		}
+	}
+	if preloaded.name != "preloaded" {
+		t.Fatal("the already loaded record was overwritten")
+	}
+}
+
+func TestIncludeFillKnown(t *testing.T) {
+	key := func(id int64) *int64 { return &id }
+	parents := []*testParent{
+		{id: 1, groupID: key(1)},
+		{id: 2, groupID: key(2)},
+		{id: 3, groupID: key(1)},
+	}
+
+	known := &testChild{id: 1}
+	var queried []int64
+	fill := testFill(func(keys []int64, yield func(testChild, int64)) error {
+		queried = append(queried, keys...)
+		for _, key := range keys {
+			yield(testChild{id: key}, key)
+		}
+		return nil
+	})
+	fill.Known = func(key int64) (*testChild, bool) {
+		if key == known.id {
+			return known, true
+		}
+		return nil, false
+	}
+
+	children, err := fill.Fill(parents, map[int64]*testChild{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(queried, []int64{2}) {
+		t.Fatalf("expected only key 2 to be queried, got %v", queried)
+	}
+	if len(children) != 2 || children[0] != known {
+		t.Fatalf("expected the known record to be returned once, got %v", children)
+	}
+	if parents[0].children[0] != known || parents[2].children[0] != known {
+		t.Fatal("expected the known record to be attached to its parents")
+	}
+}
+
+func TestIncludeEdgeQuery(t *testing.T) {
+	type testCase struct {
+		edge           IncludeEdge
+		spec           *include.Spec
+		includeDeleted bool
+		expected       string
+	}
+
+	users := IncludeEdge{
+		Table:   "users",
+		PkeyCol: "id",
+		Cols:    []string{"id", "org_id"},
+		KeyCol:  "org_id",
+	}
+	softDeletedUsers := users
+	softDeletedUsers.DeletedAtCol = "deleted_at"
+	groups := IncludeEdge{
+		Table:      "groups",
+		PkeyCol:    "id",
+		Cols:       []string{"id", "title"},
+		KeyCol:     "user_id",
+		Through:    "user_groups",
+		ThroughCol: "group_id",
+	}
+	softDeletedGroups := groups
+	softDeletedGroups.DeletedAtCol = "deleted_at"
+	softDeletedGroups.ThroughDeletedAtCol = "deleted_at"
+
+	cases := []testCase{
+		{
+			edge: users,
+			expected: `SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id FROM users t ` +
+				`WHERE t."org_id" = ANY($1) ORDER BY t."id"`,
+		},
+		{
+			// a *-* edge goes through the join table, matching the keys against
+			// the join table and selecting them from there
+			edge: groups,
+			expected: `SELECT t."id", t."title", j."user_id" AS pggen_parent_id FROM groups t ` +
+				`JOIN user_groups j ON j."group_id" = t."id" WHERE j."user_id" = ANY($1) ORDER BY t."id"`,
+		},
+		{
+			// the primary key breaks ties so that the order is stable
+			edge: users,
+			spec: &include.Spec{
+				OrderBy: []include.Order{{Column: "created_at", Desc: true}, {Column: "name"}},
+			},
+			expected: `SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id FROM users t ` +
+				`WHERE t."org_id" = ANY($1) ORDER BY t."created_at" DESC, t."name", t."id"`,
+		},
+		{
+			// limits apply to the records for each key rather than the whole batch
+			edge: users,
+			spec: &include.Spec{
+				OrderBy: []include.Order{{Column: "created_at", Desc: true}},
+				Limit:   2,
+			},
+			expected: `SELECT "id", "org_id", pggen_parent_id FROM (` +
+				`SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id, ` +
+				`row_number() OVER (PARTITION BY t."org_id" ORDER BY t."created_at" DESC, t."id") AS pggen_rank ` +
+				`FROM users t WHERE t."org_id" = ANY($1)) ranked ` +
+				`WHERE pggen_rank <= 2 ORDER BY pggen_parent_id, pggen_rank`,
+		},
+		{
+			// the where clause only sees the columns of the included table
+			edge: users,
+			spec: &include.Spec{Where: "name = 'x' OR id = 1"},
+			expected: `SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id ` +
+				`FROM (SELECT * FROM users WHERE (name = 'x' OR id = 1)) t ` +
+				`WHERE t."org_id" = ANY($1) ORDER BY t."id"`,
+		},
+		{
+			// records are filtered before they are ranked so that the limit
+			// counts only the records which are kept
+			edge: softDeletedGroups,
+			spec: &include.Spec{Where: "title <> ''", Limit: 1},
+			expected: `SELECT "id", "title", pggen_parent_id FROM (` +
+				`SELECT t."id", t."title", j."user_id" AS pggen_parent_id, ` +
+				`row_number() OVER (PARTITION BY j."user_id" ORDER BY t."id") AS pggen_rank ` +
+				`FROM (SELECT * FROM groups WHERE (title <> '')) t ` +
+				`JOIN user_groups j ON j."group_id" = t."id" ` +
+				`WHERE j."user_id" = ANY($1) AND t."deleted_at" IS NULL AND j."deleted_at" IS NULL) ranked ` +
+				`WHERE pggen_rank <= 1 ORDER BY pggen_parent_id, pggen_rank`,
+		},
+		{
+			edge: softDeletedUsers,
+			expected: `SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id FROM users t ` +
+				`WHERE t."org_id" = ANY($1) AND t."deleted_at" IS NULL ORDER BY t."id"`,
+		},
+		{
+			edge:           softDeletedUsers,
+			includeDeleted: true,
+			expected: `SELECT t."id", t."org_id", t."org_id" AS pggen_parent_id FROM users t ` +
+				`WHERE t."org_id" = ANY($1) ORDER BY t."id"`,
+		},
+	}
+
+	for i, c := range cases {
+		actual := c.edge.Query(c.spec, c.includeDeleted)
+		if actual != c.expected {
+			t.Fatalf("case %d: expected\n%s\ngot\n%s", i, c.expected, actual)
+		}
+	}
+}
+
+func TestIncludeFillQueryError(t *testing.T) {
+	key := func(id int64) *int64 { return &id }
+	parents := []*testParent{{id: 1, groupID: key(1)}, {id: 2, groupID: key(2)}}
+
+	var calls int
+	fill := testFill(func(keys []int64, yield func(testChild, int64)) error {
+		calls++
+		return errors.New("query failed")
+	})
+
+	_, err := fill.Fill(parents, map[int64]*testChild{}, 1)
+	if err == nil || err.Error() != "query failed" {
+		t.Fatalf("expected the query error, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected filling to stop at the first error, got %d queries", calls)
+	}
+}
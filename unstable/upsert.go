@@ -0,0 +1,84 @@
+package unstable
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DO NOT USE. Called by generated code.
+//
+// SkipConflicts finishes an upsert which leaves conflicting records alone. It
+// must follow a `WITH pggen_new AS (INSERT INTO ... VALUES ...` clause which
+// inserts 'nrecords' records, each made of the columns in 'insertCols' in order.
+// 'cols' are all the columns of 'table' in the order that they should come back.
+//
+// Only conflicts on 'conflictTarget' are skipped, so a record which violates some
+// other constraint still makes the statement fail. The statement returns the newly
+// inserted records, and then the existing records whose 'conflictCols' match one
+// of the records which were skipped, with a flag saying whether each record was
+// inserted. If one of the conflict columns was not inserted, the existing records
+// cannot be matched and only the new ones are returned.
+func SkipConflicts(
+	into *strings.Builder,
+	table string,
+	cols []string,
+	insertCols []string,
+	nrecords int,
+	conflictTarget string,
+	conflictCols []string,
+) {
+	quotedCols := make([]string, 0, len(cols))
+	tableCols := make([]string, 0, len(cols))
+	for _, col := range cols {
+		quotedCols = append(quotedCols, `"`+col+`"`)
+		tableCols = append(tableCols, `t."`+col+`"`)
+	}
+
+	into.WriteString("ON CONFLICT ")
+	into.WriteString(conflictTarget)
+	into.WriteString(" DO NOTHING RETURNING ")
+	into.WriteString(strings.Join(quotedCols, ", "))
+	into.WriteString(") SELECT ")
+	into.WriteString(strings.Join(quotedCols, ", "))
+	into.WriteString(", true AS pggen_inserted FROM pggen_new")
+
+	insertIdx := make(map[string]int, len(insertCols))
+	for i, col := range insertCols {
+		insertIdx[col] = i
+	}
+	keyIdxs := make([]int, 0, len(conflictCols))
+	keyCols := make([]string, 0, len(conflictCols))
+	for _, col := range conflictCols {
+		col = strings.Trim(col, `"`)
+		idx, inserted := insertIdx[col]
+		if !inserted {
+			return
+		}
+		keyIdxs = append(keyIdxs, idx)
+		keyCols = append(keyCols, `t."`+col+`"`)
+	}
+	if len(keyIdxs) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, nrecords)
+	for recNo := 0; recNo < nrecords; recNo++ {
+		slots := make([]string, 0, len(keyIdxs))
+		for _, idx := range keyIdxs {
+			slots = append(slots, fmt.Sprintf("$%d", recNo*len(insertCols)+idx+1))
+		}
+		keys = append(keys, "("+strings.Join(slots, ", ")+")")
+	}
+
+	// The main query doesn't see the rows inserted by pggen_new, so these are
+	// exactly the existing records.
+	into.WriteString(" UNION ALL SELECT ")
+	into.WriteString(strings.Join(tableCols, ", "))
+	into.WriteString(", false FROM ")
+	into.WriteString(table)
+	into.WriteString(" t WHERE (")
+	into.WriteString(strings.Join(keyCols, ", "))
+	into.WriteString(") IN (")
+	into.WriteString(strings.Join(keys, ", "))
+	into.WriteString(")")
+}
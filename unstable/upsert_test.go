@@ -0,0 +1,60 @@
+package unstable
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSkipConflicts(t *testing.T) {
+	type testCase struct {
+		insertCols     []string
+		conflictTarget string
+		conflictCols   []string
+		expected       string
+	}
+
+	cases := []testCase{
+		{
+			// only conflicts on the target are skipped, so violating any other
+			// unique index is still an error
+			insertCols:     []string{"id", "name"},
+			conflictTarget: "(id)",
+			conflictCols:   []string{"id"},
+			expected: `ON CONFLICT (id) DO NOTHING RETURNING "id", "name") ` +
+				`SELECT "id", "name", true AS pggen_inserted FROM pggen_new ` +
+				`UNION ALL SELECT t."id", t."name", false FROM orgs t WHERE (t."id") IN (($1), ($3))`,
+		},
+		{
+			// the primary key is left to the database
+			insertCols:     []string{"name"},
+			conflictTarget: `("name")`,
+			conflictCols:   []string{`"name"`},
+			expected: `ON CONFLICT ("name") DO NOTHING RETURNING "id", "name") ` +
+				`SELECT "id", "name", true AS pggen_inserted FROM pggen_new ` +
+				`UNION ALL SELECT t."id", t."name", false FROM orgs t WHERE (t."name") IN (($1), ($2))`,
+		},
+		{
+			// the existing records can't be matched without the conflict columns
+			insertCols:     []string{"name"},
+			conflictTarget: "(id)",
+			conflictCols:   []string{"id"},
+			expected: `ON CONFLICT (id) DO NOTHING RETURNING "id", "name") ` +
+				`SELECT "id", "name", true AS pggen_inserted FROM pggen_new`,
+		},
+		{
+			// conflict targets for expression indexes have no columns
+			insertCols:     []string{"id", "name"},
+			conflictTarget: "(lower(name))",
+			expected: `ON CONFLICT (lower(name)) DO NOTHING RETURNING "id", "name") ` +
+				`SELECT "id", "name", true AS pggen_inserted FROM pggen_new`,
+		},
+	}
+
+	for i, c := range cases {
+		var out strings.Builder
+		SkipConflicts(&out, "orgs", []string{"id", "name"}, c.insertCols, 2, c.conflictTarget, c.conflictCols)
+		if out.String() != c.expected {
+			t.Fatalf("case %d: expected\n%s\ngot\n%s", i, c.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package pggen
+
+// upsert_outcome.go defines the per-record results reported by the generated
+// `Upsert<Entity>WithOutcome` and `BulkUpsert<Entity>WithOutcomes` methods
+
+// UpsertOutcome says what an upsert did to a particular record.
+type UpsertOutcome int
+
+const (
+	// The record did not exist, so it was inserted
+	UpsertInserted UpsertOutcome = iota + 1
+	// The record already existed and the fields in the field mask were updated
+	UpsertUpdated
+	// The record already existed and the field mask was empty, so it was
+	// left as it was
+	UpsertUnchanged
+)
+
+func (o UpsertOutcome) String() string {
+	switch o {
+	case UpsertInserted:
+		return "inserted"
+	case UpsertUpdated:
+		return "updated"
+	case UpsertUnchanged:
+		return "unchanged"
+	default:
+		return "unknown"
+	}
+}
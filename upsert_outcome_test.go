@@ -0,0 +1,19 @@
+package pggen
+
+import (
+	"testing"
+)
+
+func TestUpsertOutcomeString(t *testing.T) {
+	cases := map[UpsertOutcome]string{
+		UpsertInserted:  "inserted",
+		UpsertUpdated:   "updated",
+		UpsertUnchanged: "unchanged",
+		0:               "unknown",
+	}
+	for outcome, expected := range cases {
+		if outcome.String() != expected {
+			t.Fatalf("expected '%s', got '%s'", expected, outcome.String())
+		}
+	}
+}